@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	got "github.com/ljpurcell/got/internal"
+)
+
+// The completion scripts hand the words typed so far to "got __complete"
+// and offer what it prints, one candidate per line, falling back to file
+// names when it prints nothing.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for got; load with: source <(got completion bash)
+_got() {
+	local IFS=$'\n'
+	COMPREPLY=($(got __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _got got
+`,
+	"zsh": `#compdef got
+# zsh completion for got; load with: source <(got completion zsh)
+_got() {
+	local -a candidates
+	candidates=(${(f)"$(got __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+	if (( ${#candidates} )); then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+
+if [[ $zsh_eval_context[-1] == loadautofunc ]]; then
+	_got "$@"
+else
+	compdef _got got
+fi
+`,
+	"fish": `# fish completion for got; load with: got completion fish | source
+function __got_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	got __complete $tokens[2..-1] 2>/dev/null
+end
+function __got_has_candidates
+	set -l candidates (__got_complete)
+	test (count $candidates) -gt 0
+end
+complete -c got -f -n __got_has_candidates -a '(__got_complete)'
+complete -c got -F -n 'not __got_has_candidates'
+`,
+}
+
+func CompletionCommand() *Command {
+	return &Command{
+		Name:     "completion",
+		Short:    "Print a shell completion script",
+		Long:     "Print the script that makes bash, zsh or fish complete got commands, flags, branches, tags, remotes and tracked paths",
+		Help:     "bash|zsh|fish",
+		Complete: byPosition(func() []string { return []string{"bash", "fish", "zsh"} }),
+		Run: func(args []string) error {
+			if len(args) != 1 {
+				return errors.New("completion takes exactly one shell: bash, zsh or fish")
+			}
+
+			script, ok := completionScripts[args[0]]
+			if !ok {
+				return fmt.Errorf("no completion for %q; use bash, zsh or fish", args[0])
+			}
+
+			fmt.Fprint(os.Stdout, script)
+			return nil
+		},
+	}
+}
+
+func CompleteCommand() *Command {
+	return &Command{
+		Name:   "__complete",
+		Short:  "Complete a got command line",
+		Long:   "Print the candidates for the last of the words, which follow \"got\" on the command line being completed, one per line; used by the completion scripts",
+		Help:   "<words>...",
+		Hidden: true,
+		Run: func(args []string) error {
+			if len(args) == 0 {
+				args = []string{""}
+			}
+
+			for _, candidate := range complete(args[:len(args)-1], args[len(args)-1]) {
+				fmt.Fprintln(os.Stdout, candidate)
+			}
+
+			return nil
+		},
+	}
+}
+
+// complete returns the candidates starting with current, given the words
+// before it.
+func complete(words []string, current string) []string {
+	global, dir, _ := globalFlags()
+
+	candidates := []string{}
+	start := skipFlags(global, words)
+
+	// Complete from the repository -C names
+	if global.Parse(words[:start]) == nil && *dir != "" {
+		if os.Chdir(*dir) != nil {
+			return nil
+		}
+	}
+
+	switch {
+	case start < len(words):
+		cmd := findCommand(words[start])
+		if cmd == nil {
+			return nil
+		}
+
+		rest := words[start+1:]
+		if len(rest) > 0 && takesValue(cmd.Flags, rest[len(rest)-1]) {
+			return nil
+		}
+
+		if strings.HasPrefix(current, "-") {
+			candidates = flagNames(cmd.Flags)
+		} else if cmd.Complete != nil {
+			candidates = cmd.Complete(positionalArgs(cmd.Flags, rest))
+		}
+	case len(words) > 0 && takesValue(global, words[len(words)-1]):
+		return nil
+	case strings.HasPrefix(current, "-"):
+		candidates = flagNames(global)
+	default:
+		candidates = commandNames()
+	}
+
+	matching := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			matching = append(matching, candidate)
+		}
+	}
+
+	return matching
+}
+
+// skipFlags returns the index of the first word that is not a flag in
+// flags or the value of one, or len(words) if there is none.
+func skipFlags(flags *flag.FlagSet, words []string) int {
+	n := 0
+	for n < len(words) && strings.HasPrefix(words[n], "-") && words[n] != "-" {
+		if takesValue(flags, words[n]) {
+			n++
+		}
+		n++
+	}
+
+	// The last flag may still be waiting for its value
+	return min(n, len(words))
+}
+
+// positionalArgs drops the flags, and the values given to them, from words.
+func positionalArgs(flags *flag.FlagSet, words []string) []string {
+	args := []string{}
+
+	for n := 0; n < len(words); n++ {
+		switch {
+		case words[n] == "--":
+			return append(args, words[n+1:]...)
+		case strings.HasPrefix(words[n], "-") && words[n] != "-":
+			if takesValue(flags, words[n]) {
+				n++
+			}
+		default:
+			args = append(args, words[n])
+		}
+	}
+
+	return args
+}
+
+// takesValue reports whether word is a flag in flags that needs a value
+// and was not given one with "=".
+func takesValue(flags *flag.FlagSet, word string) bool {
+	if flags == nil || !strings.HasPrefix(word, "-") || strings.Contains(word, "=") {
+		return false
+	}
+
+	f := flags.Lookup(strings.TrimLeft(word, "-"))
+	if f == nil {
+		return false
+	}
+
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !boolFlag.IsBoolFlag()
+}
+
+func flagNames(flags *flag.FlagSet) []string {
+	names := []string{}
+	if flags != nil {
+		flags.VisitAll(func(f *flag.Flag) {
+			names = append(names, flagName(f.Name))
+		})
+	}
+
+	return names
+}
+
+func commandNames() []string {
+	names := []string{}
+	for _, cmd := range commands() {
+		if !cmd.Hidden {
+			names = append(names, cmd.Name)
+		}
+	}
+
+	return names
+}
+
+// byPosition completes the nth positional argument with the nth function,
+// and every argument after the last with the last.
+func byPosition(fns ...func() []string) func([]string) []string {
+	return func(args []string) []string {
+		return fns[min(len(args), len(fns)-1)]()
+	}
+}
+
+// subcommands completes the first argument with the names of the
+// subcommands, and later ones with the completer of the subcommand given.
+func subcommands(subs map[string]func([]string) []string) func([]string) []string {
+	return func(args []string) []string {
+		if len(args) == 0 {
+			names := []string{}
+			for name := range subs {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return names
+		}
+
+		if sub := subs[args[0]]; sub != nil {
+			return sub(args[1:])
+		}
+		return nil
+	}
+}
+
+// The completers below print nothing outside a repository.
+
+func branchNames() []string {
+	names, _ := got.RefNames(got.RefsDir + "/" + got.RefHeadsDir)
+	return names
+}
+
+func remoteNames() []string {
+	remotes, _ := got.ListRemotes()
+
+	names := []string{}
+	for _, remote := range remotes {
+		names = append(names, remote.Name)
+	}
+
+	return names
+}
+
+// revisionNames lists the names revisions most often start from: HEAD,
+// branches, tags and remote-tracking refs.
+func revisionNames() []string {
+	names := []string{got.HeadFile}
+	names = append(names, branchNames()...)
+
+	tags, _ := got.RefNames(got.RefsDir + "/tags")
+	names = append(names, tags...)
+
+	tracking, _ := got.RefNames(got.RemotesDir)
+	return append(names, tracking...)
+}
+
+func trackedPaths() []string {
+	index, err := got.GetIndex()
+	if err != nil {
+		return nil
+	}
+
+	files, err := index.TrackedFiles()
+	if err != nil {
+		return nil
+	}
+
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, file.Name)
+	}
+
+	return paths
+}
+
+func stashNames() []string {
+	stashes, _ := got.StashList()
+
+	names := []string{}
+	for n := range stashes {
+		names = append(names, fmt.Sprintf("stash@{%d}", n))
+	}
+
+	return names
+}
+
+func revisionsAndPaths() []string {
+	return append(revisionNames(), trackedPaths()...)
+}
+
+func noCandidates() []string {
+	return nil
+}
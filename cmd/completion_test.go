@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	repo := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "dir/c.txt"} {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatalf("could not create %s: %s", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatalf("could not write %s: %s", name, err)
+		}
+	}
+
+	inTestDir(t, t.TempDir())
+
+	for _, args := range [][]string{
+		{"init", repo},
+		{"-C", repo, "add", "a.txt", "dir/c.txt"},
+		{"-C", repo, "remote", "add", "origin", "../origin"},
+		{"-C", repo, "remote", "add", "upstream", "../upstream"},
+	} {
+		var err error
+		captureStdout(t, func() { err = execute(args) })
+		if err != nil {
+			t.Fatalf("could not run %q: %s", args, err)
+		}
+	}
+
+	cases := []struct {
+		name    string
+		words   []string
+		current string
+		want    []string
+	}{
+		{"commands", []string{}, "re", []string{"reset", "revert", "rebase", "reflog", "remote", "repack", "rev-parse"}},
+		{"global flags", []string{}, "-", []string{"-C", "--help", "-h"}},
+		{"directory for -C", []string{"-C"}, "", nil},
+		{"command after -C", []string{"-C", repo}, "ls-", []string{"ls-files", "ls-tree"}},
+		{"tracked paths with -C", []string{"-C", repo, "rm"}, "", []string{"a.txt", "dir/c.txt"}},
+		{"tracked paths after flags", []string{"-C", repo, "rm", "--cached", "-r"}, "d", []string{"dir/c.txt"}},
+		{"command flags", []string{"commit"}, "--a", []string{"--allow-empty", "--amend"}},
+		{"file for -F", []string{"-C", repo, "commit", "-F"}, "", nil},
+		{"message for -m", []string{"-C", repo, "commit", "-m"}, "", nil},
+		{"subcommands", []string{"-C", repo, "remote"}, "", []string{"add", "list", "remove"}},
+		{"remotes to remove", []string{"-C", repo, "remote", "remove"}, "", []string{"origin", "upstream"}},
+		{"one remote to remove", []string{"-C", repo, "remote", "remove", "origin"}, "", nil},
+		{"remotes to fetch", []string{"-C", repo, "fetch"}, "u", []string{"upstream"}},
+		{"shells", []string{"completion"}, "", []string{"bash", "fish", "zsh"}},
+		{"unknown command", []string{"bogus"}, "", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inTestDir(t, t.TempDir())
+
+			got := complete(c.words, c.current)
+			if len(got) == 0 && len(c.want) == 0 {
+				return
+			}
+
+			slices.Sort(got)
+			want := slices.Clone(c.want)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("complete(%q, %q) = %q, want %q", c.words, c.current, got, c.want)
+			}
+		})
+	}
+}
+
+func TestSkipFlags(t *testing.T) {
+	global, _, _ := globalFlags()
+
+	cases := []struct {
+		words []string
+		want  int
+	}{
+		{[]string{}, 0},
+		{[]string{"rm", "-C", "dir"}, 0},
+		{[]string{"-C", "dir", "rm"}, 2},
+		{[]string{"-C=dir", "rm"}, 1},
+		{[]string{"--help", "-C", "dir", "rm"}, 3},
+		{[]string{"-C"}, 1},
+		{[]string{"-", "rm"}, 0},
+	}
+
+	for _, c := range cases {
+		if got := skipFlags(global, c.words); got != c.want {
+			t.Errorf("skipFlags(%q) = %d, want %d", c.words, got, c.want)
+		}
+	}
+}
+
+func TestPositionalArgs(t *testing.T) {
+	flags := CommitCommand().Flags
+
+	cases := []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{}, []string{}},
+		{[]string{"a", "b"}, []string{"a", "b"}},
+		{[]string{"-m", "message", "a"}, []string{"a"}},
+		{[]string{"-m=message", "a"}, []string{"a"}},
+		{[]string{"--amend", "a", "-F", "file", "b"}, []string{"a", "b"}},
+		{[]string{"a", "--", "-m", "b"}, []string{"a", "-m", "b"}},
+		{[]string{"-", "a"}, []string{"-", "a"}},
+		{[]string{"--unknown", "a"}, []string{"a"}},
+	}
+
+	for _, c := range cases {
+		if got := positionalArgs(flags, c.words); !slices.Equal(got, c.want) {
+			t.Errorf("positionalArgs(%q) = %q, want %q", c.words, got, c.want)
+		}
+	}
+}
+
+func TestTakesValue(t *testing.T) {
+	flags := CommitCommand().Flags
+
+	cases := []struct {
+		word string
+		want bool
+	}{
+		{"-m", true},
+		{"--m", true},
+		{"-F", true},
+		{"-F=file", false},
+		{"--amend", false},
+		{"-n", false},
+		{"--unknown", false},
+		{"m", false},
+		{"-", false},
+	}
+
+	for _, c := range cases {
+		if got := takesValue(flags, c.word); got != c.want {
+			t.Errorf("takesValue(%q) = %v, want %v", c.word, got, c.want)
+		}
+	}
+
+	if takesValue(nil, "-m") {
+		t.Errorf("a command without flags takes no flag values")
+	}
+}
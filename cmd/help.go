@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+func HelpCommand() *Command {
+	return &Command{
+		Name:     "help",
+		Short:    "Show help for got or a command",
+		Long:     "List the commands, or show the usage, description and options of the given command",
+		Help:     "[<command>]",
+		Complete: byPosition(commandNames, noCandidates),
+		Run: func(args []string) error {
+			switch len(args) {
+			case 0:
+				global, _, _ := globalFlags()
+				printUsage(os.Stdout, global)
+				return nil
+			case 1:
+				cmd := findCommand(args[0])
+				if cmd == nil {
+					return unknownCommandError(args[0])
+				}
+
+				printCommandHelp(os.Stdout, cmd)
+				return nil
+			default:
+				return errors.New("help takes at most one command")
+			}
+		},
+	}
+}
+
+// printUsage lists the global flags and the commands that are not hidden.
+func printUsage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintf(w, "usage: got [options] <command> [<args>]\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+
+	width := 0
+	listed := []*Command{}
+	for _, cmd := range commands() {
+		if !cmd.Hidden {
+			listed = append(listed, cmd)
+			width = max(width, len(cmd.Name))
+		}
+	}
+
+	for _, cmd := range listed {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, cmd.Name, cmd.Short)
+	}
+
+	fmt.Fprintf(w, "\nOptions:\n")
+	printFlags(w, global)
+
+	fmt.Fprintf(w, "\nRun \"got help <command>\" for more about a command.\n")
+}
+
+// printCommandHelp prints the usage line of the command, built from its
+// name, flags and Help, followed by its description and flags.
+func printCommandHelp(w io.Writer, cmd *Command) {
+	usage := "got " + cmd.Name
+	if hasFlags(cmd.Flags) {
+		usage += " [options]"
+	}
+	if cmd.Help != "" {
+		usage += " " + cmd.Help
+	}
+
+	fmt.Fprintf(w, "usage: %s\n\n", usage)
+
+	for _, line := range wrapText(cmd.Long, 76) {
+		fmt.Fprintln(w, line)
+	}
+
+	if hasFlags(cmd.Flags) {
+		fmt.Fprintf(w, "\nOptions:\n")
+		printFlags(w, cmd.Flags)
+	}
+}
+
+func hasFlags(flags *flag.FlagSet) bool {
+	found := false
+	if flags != nil {
+		flags.VisitAll(func(*flag.Flag) { found = true })
+	}
+	return found
+}
+
+// printFlags lists the flags in a set with their usage and any default,
+// written -x for single letters and --name otherwise. Flags sharing a value
+// are aliases, so they are listed together with the usage of the longest.
+func printFlags(w io.Writer, flags *flag.FlagSet) {
+	type entry struct {
+		flags []*flag.Flag
+		name  string
+		usage string
+	}
+
+	entries := []*entry{}
+	flags.VisitAll(func(f *flag.Flag) {
+		for _, e := range entries {
+			if e.flags[0].Value == f.Value {
+				e.flags = append(e.flags, f)
+				return
+			}
+		}
+		entries = append(entries, &entry{flags: []*flag.Flag{f}})
+	})
+
+	width := 0
+	for _, e := range entries {
+		slices.SortFunc(e.flags, func(a, b *flag.Flag) int {
+			return len(a.Name) - len(b.Name)
+		})
+
+		names := []string{}
+		for _, f := range e.flags {
+			names = append(names, flagName(f.Name))
+		}
+
+		longest := e.flags[len(e.flags)-1]
+		argument, usage := flag.UnquoteUsage(longest)
+
+		e.name = strings.Join(names, ", ")
+		if argument != "" {
+			e.name += " <" + argument + ">"
+		}
+
+		if longest.DefValue != "" && longest.DefValue != "false" {
+			usage += fmt.Sprintf(" (default %s)", longest.DefValue)
+		}
+
+		e.usage = usage
+		width = max(width, len(e.name))
+	}
+
+	for _, e := range entries {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, e.name, e.usage)
+	}
+}
+
+// flagName writes a flag the way it is usually typed.
+func flagName(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// unknownCommandError reports a command that does not exist, suggesting
+// the ones it may have been a typo for.
+func unknownCommandError(name string) error {
+	suggestions := suggestCommands(name)
+
+	switch len(suggestions) {
+	case 0:
+		return fmt.Errorf("%q is not a got command; run \"got help\" for a list", name)
+	case 1:
+		return fmt.Errorf("%q is not a got command; did you mean %q?", name, suggestions[0])
+	default:
+		quoted := make([]string, len(suggestions))
+		for n, suggestion := range suggestions {
+			quoted[n] = fmt.Sprintf("%q", suggestion)
+		}
+		return fmt.Errorf("%q is not a got command; did you mean one of %s?", name, strings.Join(quoted, ", "))
+	}
+}
+
+// suggestCommands returns the commands that name is within two edits of,
+// but not so short that two edits could make anything, or a prefix of,
+// closest first.
+func suggestCommands(name string) []string {
+	type suggestion struct {
+		name     string
+		distance int
+	}
+
+	found := []suggestion{}
+	for _, cmd := range commands() {
+		if cmd.Hidden {
+			continue
+		}
+
+		distance := editDistance(name, cmd.Name)
+		if distance <= 2 && distance < len(name) || len(name) >= 2 && strings.HasPrefix(cmd.Name, name) {
+			found = append(found, suggestion{cmd.Name, distance})
+		}
+	}
+
+	slices.SortStableFunc(found, func(a, b suggestion) int {
+		return a.distance - b.distance
+	})
+
+	names := make([]string, len(found))
+	for n, s := range found {
+		names[n] = s.name
+	}
+
+	return names
+}
+
+// editDistance counts the insertions, deletions and substitutions needed
+// to turn a into b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous = current
+	}
+
+	return previous[len(b)]
+}
+
+// wrapText splits text into lines of at most width characters, breaking
+// between words.
+func wrapText(text string, width int) []string {
+	lines := []string{}
+	line := ""
+
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	return lines
+}
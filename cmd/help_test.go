@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// inTestDir runs the test from dir, returning to the working directory
+// it started in once the test is done.
+func inTestDir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("could not get working directory: %s", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err = os.Chdir(dir); err != nil {
+		t.Fatalf("could not enter %s: %s", dir, err)
+	}
+}
+
+// captureStdout returns what fn prints to stdout, throwing away what it
+// prints to stderr.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("could not create pipe: %s", err)
+	}
+
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("could not open %s: %s", os.DevNull, err)
+	}
+	defer null.Close()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, null
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+
+	fn()
+	w.Close()
+
+	return <-out
+}
+
+func TestSuggestCommands(t *testing.T) {
+	cases := []struct {
+		name string
+		want []string
+	}{
+		{"comit", []string{"commit"}},
+		{"stsh", []string{"stash", "push"}},
+		{"pussh", []string{"push"}},
+		{"checkout", []string{"checkout"}},
+		{"rebsae", []string{"rebase"}},
+		// One or two letters are within two edits of too much to guess
+		{"x", []string{}},
+		{"zz", []string{}},
+		// Unless they start a command, which comes after the closer ones
+		{"re", []string{"rm", "reset", "revert", "rebase", "reflog", "remote", "repack", "rev-parse"}},
+		{"fs", []string{"fsck"}},
+		{"xyzzy", []string{}},
+		// Hidden commands are never suggested
+		{"__complet", []string{}},
+	}
+
+	for _, c := range cases {
+		if got := suggestCommands(c.name); !slices.Equal(got, c.want) {
+			t.Errorf("suggestCommands(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"commit", "commit", 0},
+		{"comit", "commit", 1},
+		{"stahs", "stash", 2},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, c := range cases {
+		if got := editDistance(c.a, c.b); got != c.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	cases := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"", 10, []string{}},
+		{"one two three", 20, []string{"one two three"}},
+		{"one two three", 7, []string{"one two", "three"}},
+		{"  spaced   out  ", 20, []string{"spaced out"}},
+		{"unbreakable words", 5, []string{"unbreakable", "words"}},
+	}
+
+	for _, c := range cases {
+		if got := wrapText(c.text, c.width); !slices.Equal(got, c.want) {
+			t.Errorf("wrapText(%q, %d) = %q, want %q", c.text, c.width, got, c.want)
+		}
+	}
+}
+
+func TestPrintFlags(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	noVerify := flags.Bool("no-verify", false, "skip the hooks")
+	flags.BoolVar(noVerify, "n", false, "short for --no-verify")
+	flags.String("file", "", "read the message from `path`")
+	flags.String("addr", ":8080", "listen on `address`")
+	force := flags.Bool("f", false, "short for --force")
+	flags.BoolVar(force, "force", false, "allow anything")
+
+	var b strings.Builder
+	printFlags(&b, flags)
+
+	want := []string{
+		"  --addr <address>  listen on address (default :8080)",
+		"  -f, --force       allow anything",
+		"  --file <path>     read the message from path",
+		"  -n, --no-verify   skip the hooks",
+	}
+	if got := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n"); !slices.Equal(got, want) {
+		t.Errorf("aliases should be listed together with the usage of the longest name, got\n%s", b.String())
+	}
+}
+
+func TestExecute(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("a\n"), 0666); err != nil {
+		t.Fatalf("could not write a.txt: %s", err)
+	}
+
+	inTestDir(t, t.TempDir())
+
+	var err error
+	captureStdout(t, func() { err = execute([]string{"init", repo}) })
+	if err != nil {
+		t.Fatalf("could not init: %s", err)
+	}
+
+	cases := []struct {
+		name string
+		args []string
+		out  string
+		err  string
+	}{
+		{"usage with --help", []string{"--help"}, "usage: got [options] <command>", ""},
+		{"usage with -h", []string{"-h"}, "usage: got [options] <command>", ""},
+		{"no command", []string{}, "", "no command given"},
+		{"unknown flag", []string{"--bogus"}, "", `run "got help" for usage`},
+		{"unknown command", []string{"comit"}, "", `did you mean "commit"?`},
+		{"help command", []string{"help", "commit"}, "usage: got commit [options]", ""},
+		{"--help after the command", []string{"commit", "--help"}, "usage: got commit [options]", ""},
+		{"-h after the command", []string{"commit", "-h"}, "usage: got commit [options]", ""},
+		{"--help before the command", []string{"--help", "commit"}, "usage: got commit [options]", ""},
+		{"--help with -C", []string{"-C", repo, "--help", "ls-files"}, "usage: got ls-files [options]", ""},
+		{"-C runs in the repository", []string{"-C", repo, "add", "a.txt"}, "", ""},
+		{"-C lists the repository", []string{"-C", repo, "ls-files"}, "a.txt\n", ""},
+		{"-C to a missing directory", []string{"-C", filepath.Join(repo, "missing"), "ls-files"}, "", "could not change to"},
+		{"command errors are named", []string{"-C", repo, "rev-parse", "nothing"}, "", "rev-parse command error"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inTestDir(t, t.TempDir())
+
+			var err error
+			out := captureStdout(t, func() { err = execute(c.args) })
+
+			if c.err == "" && err != nil {
+				t.Fatalf("execute(%q) failed: %s", c.args, err)
+			}
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Fatalf("execute(%q) should fail with %q, got %v", c.args, c.err, err)
+			}
+			if !strings.Contains(out, c.out) {
+				t.Errorf("execute(%q) should print %q, got %q", c.args, c.out, out)
+			}
+		})
+	}
+}
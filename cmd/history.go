@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	got "github.com/ljpurcell/got/internal"
+)
+
+func CherryPickCommand() *Command {
+	flags := flag.NewFlagSet("cherry-pick", flag.ContinueOnError)
+	actions := sequencerFlags(flags)
+
+	return &Command{
+		Name:     "cherry-pick",
+		Short:    "Apply the changes made by existing commits",
+		Long:     "Apply the change each commit made to its parent onto HEAD as a new commit with the same author and message, stopping at conflicts until --continue, --skip or --abort",
+		Help:     "<commits>...",
+		Complete: byPosition(revisionNames),
+		Flags:    flags,
+		Run: func(args []string) error {
+			return runSequencer(flags, actions, args, got.CherryPick)
+		},
+	}
+}
+
+func RevertCommand() *Command {
+	flags := flag.NewFlagSet("revert", flag.ContinueOnError)
+	actions := sequencerFlags(flags)
+
+	return &Command{
+		Name:     "revert",
+		Short:    "Undo commits with new commits",
+		Long:     "Make a commit undoing the changes of each given commit, with a \"Revert ...\" message naming it, stopping at conflicts until --continue, --skip or --abort",
+		Help:     "<commits>...",
+		Complete: byPosition(revisionNames),
+		Flags:    flags,
+		Run: func(args []string) error {
+			return runSequencer(flags, actions, args, got.Revert)
+		},
+	}
+}
+
+func RebaseCommand() *Command {
+	flags := flag.NewFlagSet("rebase", flag.ContinueOnError)
+	onto := flags.String("onto", "", "replay the commits onto this `commit` instead of upstream")
+	interactive := flags.Bool("i", false, "edit the todo list before starting")
+	actions := sequencerFlags(flags)
+
+	return &Command{
+		Name:     "rebase",
+		Short:    "Replay commits onto another base",
+		Long:     "Replay the commits on the current branch that upstream does not have onto upstream, or onto --onto, and move the branch to the result; with -i the todo list is first opened in $GOT_SEQUENCE_EDITOR to pick, reword, edit, squash, fixup or drop commits",
+		Help:     "<upstream>",
+		Complete: byPosition(revisionNames, noCandidates),
+		Flags:    flags,
+		Run: func(args []string) error {
+			return runSequencer(flags, actions, args, func(revs []string) ([]got.PickResult, error) {
+				if len(revs) != 1 {
+					return nil, errors.New("rebase takes exactly one upstream")
+				}
+				return got.Rebase(revs[0], *onto, *interactive)
+			})
+		},
+	}
+}
+
+func BlameCommand() *Command {
+	flags := flag.NewFlagSet("blame", flag.ContinueOnError)
+	lineRange := flags.String("L", "", "only blame the `lines` start,end or start,+count")
+	porcelain := flags.Bool("porcelain", false, "print each commit's details once, for other tools to read")
+
+	return &Command{
+		Name:     "blame",
+		Short:    "Show what last changed each line of a file",
+		Long:     "Show, for each line of a file in HEAD or the given revision, the commit that last changed it with its author and date; -L limits it to a range of lines and --porcelain prints a format for other tools to read",
+		Help:     "<file> [<rev>]",
+		Complete: byPosition(trackedPaths, revisionNames, noCandidates),
+		Flags:    flags,
+		Run: func(args []string) error {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			if flags.NArg() < 1 || flags.NArg() > 2 {
+				return errors.New("blame takes a file and at most one revision")
+			}
+
+			start, end, err := parseLineRange(*lineRange)
+			if err != nil {
+				return err
+			}
+
+			name, rev := flags.Arg(0), flags.Arg(1)
+
+			lines, err := got.Blame(name, rev, start, end)
+			if err != nil {
+				return err
+			}
+
+			if *porcelain {
+				printBlamePorcelain(name, lines)
+				return nil
+			}
+
+			nameWidth, numberWidth := 0, len(strconv.Itoa(len(lines)))
+			if len(lines) > 0 {
+				numberWidth = len(strconv.Itoa(lines[len(lines)-1].Line))
+			}
+			for _, line := range lines {
+				author, _ := splitIdentity(line.Commit.Author)
+				nameWidth = max(nameWidth, len(author))
+			}
+
+			for _, line := range lines {
+				author, _ := splitIdentity(line.Commit.Author)
+				fmt.Fprintf(os.Stdout, "%s (%-*s %s %*d) %s\n",
+					got.FindUniqueAbbrev(line.Commit.Id), nameWidth, author,
+					line.Commit.AuthoredAt.Format("2006-01-02 15:04:05 -0700"),
+					numberWidth, line.Line, line.Content)
+			}
+
+			return nil
+		},
+	}
+}
+
+// parseLineRange reads a -L range of start,end or start,+count, where
+// either side may be left out.
+func parseLineRange(lineRange string) (int, int, error) {
+	if lineRange == "" {
+		return 0, 0, nil
+	}
+
+	first, last, _ := strings.Cut(lineRange, ",")
+
+	start, end := 0, 0
+	var err error
+
+	if first != "" {
+		if start, err = strconv.Atoi(first); err != nil || start < 1 {
+			return 0, 0, fmt.Errorf("invalid line range %q", lineRange)
+		}
+	}
+
+	if count, ok := strings.CutPrefix(last, "+"); ok {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid line range %q", lineRange)
+		}
+		end = max(start, 1) + n - 1
+	} else if last != "" {
+		if end, err = strconv.Atoi(last); err != nil || end < max(start, 1) {
+			return 0, 0, fmt.Errorf("invalid line range %q", lineRange)
+		}
+	}
+
+	return start, end, nil
+}
+
+// printBlamePorcelain prints each line as "<id> <orig line> <line>" and a
+// tab before its content. The first line of each run of consecutive lines
+// from one commit also gives the number of lines in the run, and the first
+// line blamed on a commit is followed by the commit's details.
+func printBlamePorcelain(name string, lines []got.BlameLine) {
+	seen := map[string]bool{}
+
+	for i, line := range lines {
+		commit := line.Commit
+
+		if i == 0 || !continuesBlameGroup(lines[i-1], line) {
+			count := 1
+			for count < len(lines)-i && continuesBlameGroup(lines[i+count-1], lines[i+count]) {
+				count++
+			}
+			fmt.Fprintf(os.Stdout, "%s %d %d %d\n", commit.Id, line.OrigLine, line.Line, count)
+		} else {
+			fmt.Fprintf(os.Stdout, "%s %d %d\n", commit.Id, line.OrigLine, line.Line)
+		}
+
+		if !seen[commit.Id] {
+			seen[commit.Id] = true
+
+			for _, person := range []struct {
+				role, identity string
+				at             time.Time
+			}{
+				{"author", commit.Author, commit.AuthoredAt},
+				{"committer", commit.Committer, commit.CreatedAt},
+			} {
+				who, mail := splitIdentity(person.identity)
+				fmt.Fprintf(os.Stdout, "%s %s\n%s-mail %s\n%s-time %d\n%s-tz %s\n",
+					person.role, who, person.role, mail, person.role, person.at.Unix(), person.role, person.at.Format("-0700"))
+			}
+
+			subject, _, _ := strings.Cut(commit.Message, "\n")
+			fmt.Fprintf(os.Stdout, "summary %s\n", subject)
+			fmt.Fprintf(os.Stdout, "filename %s\n", name)
+		}
+
+		fmt.Fprintf(os.Stdout, "\t%s\n", line.Content)
+	}
+}
+
+// continuesBlameGroup reports whether line follows on from prev in both
+// the blamed commit and the final file.
+func continuesBlameGroup(prev, line got.BlameLine) bool {
+	return line.Commit.Id == prev.Commit.Id && line.OrigLine == prev.OrigLine+1 && line.Line == prev.Line+1
+}
+
+// splitIdentity splits "Name <email>" into the name and "<email>".
+func splitIdentity(identity string) (string, string) {
+	name, email, ok := strings.Cut(identity, " <")
+	if !ok {
+		return identity, ""
+	}
+	return name, "<" + email
+}
+
+// sequencerActions are the flags that carry on or stop a sequence of
+// commits.
+type sequencerActions struct {
+	cont, skip, abort *bool
+}
+
+// sequencerFlags adds the --continue, --skip and --abort flags to flags.
+func sequencerFlags(flags *flag.FlagSet) sequencerActions {
+	return sequencerActions{
+		cont:  flags.Bool("continue", false, "commit the resolved conflicts and carry on"),
+		skip:  flags.Bool("skip", false, "drop the commit that stopped and carry on"),
+		abort: flags.Bool("abort", false, "go back to where HEAD was before starting"),
+	}
+}
+
+// runSequencer handles the commands that apply commits one after another.
+func runSequencer(flags *flag.FlagSet, opts sequencerActions, args []string, start func([]string) ([]got.PickResult, error)) error {
+	name := flags.Name()
+	cont, skip, abort := opts.cont, opts.skip, opts.abort
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	actions := 0
+	for _, set := range []bool{*cont, *skip, *abort} {
+		if set {
+			actions++
+		}
+	}
+
+	if actions > 1 || actions == 1 && flags.NArg() > 0 {
+		return errors.New("--continue, --skip and --abort take no other arguments")
+	}
+
+	var results []got.PickResult
+	var err error
+
+	switch {
+	case *abort:
+		return got.AbortSequence()
+	case *cont:
+		results, err = got.ContinueSequence()
+	case *skip:
+		results, err = got.SkipSequence()
+	case flags.NArg() == 0:
+		return errors.New("not enough arguments")
+	default:
+		results, err = start(flags.Args())
+	}
+
+	for _, result := range results {
+		if result.Commit == "" {
+			fmt.Fprintf(os.Stdout, "Skipped %s (%s): its changes are already present\n", got.FindUniqueAbbrev(result.Source), result.Subject)
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "[%s] %s\n", got.FindUniqueAbbrev(result.Commit), result.Subject)
+	}
+
+	if errors.Is(err, got.ErrSequenceStopped) {
+		fmt.Fprintf(os.Stdout, "Stopped so the commit can be amended; stage any changes, then run \"got %s --continue\"\n", name)
+		return nil
+	}
+
+	var conflict *got.MergeConflictError
+	if errors.As(err, &conflict) {
+		return fmt.Errorf("%w, then run \"got %s --continue\"", err, name)
+	}
+
+	return err
+}
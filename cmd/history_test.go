@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBlamePorcelain(t *testing.T) {
+	inTestDir(t, t.TempDir())
+
+	run := func(args ...string) string {
+		t.Helper()
+
+		var err error
+		out := captureStdout(t, func() { err = execute(args) })
+		if err != nil {
+			t.Fatalf("got %s failed: %s", strings.Join(args, " "), err)
+		}
+		return out
+	}
+
+	write := func(content string) {
+		t.Helper()
+
+		if err := os.WriteFile("a.txt", []byte(content), 0666); err != nil {
+			t.Fatalf("could not write a.txt: %s", err)
+		}
+	}
+
+	run("init")
+	write("1\n2\n3\n4\n")
+	run("add", "a.txt")
+	run("commit", "-m", "first")
+	first := strings.TrimSpace(run("rev-parse", "HEAD"))
+
+	write("1\ntwo\nthree\n4\n5\n")
+	run("add", "a.txt")
+	run("commit", "-m", "second")
+	second := strings.TrimSpace(run("rev-parse", "HEAD"))
+
+	headers := []string{}
+	for _, line := range strings.Split(run("blame", "--porcelain", "a.txt"), "\n") {
+		if strings.HasPrefix(line, first) || strings.HasPrefix(line, second) {
+			headers = append(headers, line)
+		}
+	}
+
+	// Each run of lines from one commit gives its length on its first line
+	want := []string{
+		first + " 1 1 1",
+		second + " 2 2 2",
+		second + " 3 3",
+		first + " 4 4 1",
+		second + " 5 5 1",
+	}
+	if !slices.Equal(headers, want) {
+		t.Fatalf("the line headers should be\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(headers, "\n"))
+	}
+}
@@ -1,78 +1,170 @@
 package main
 
 import (
-	"bytes"
-	"compress/zlib"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
 
 	got "github.com/ljpurcell/got/internal"
 )
 
+// Command is a got subcommand. Help holds the arguments it takes, as
+// shown in its usage line. Flags, when set, is the command's own flag set,
+// which Run parses from the arguments it is given and which help and
+// completion read. Complete, when set, returns the candidates for the next
+// argument given those before it. Hidden commands are left out of the
+// command list.
 type Command struct {
-	Name  string
-	Short string
-	Long  string
-	Help  string
-	Run   func([]string) error
+	Name     string
+	Short    string
+	Long     string
+	Help     string
+	Hidden   bool
+	Flags    *flag.FlagSet
+	Complete func([]string) []string
+	Run      func([]string) error
+}
+
+// commands returns every command, in the order help lists them.
+func commands() []*Command {
+	return []*Command{
+		InitCommand(),
+		AddCommand(),
+		RemoveCommand(),
+		CommitCommand(),
+		ResetCommand(),
+		CheckoutCommand(),
+		StashCommand(),
+		CherryPickCommand(),
+		RevertCommand(),
+		RebaseCommand(),
+		BlameCommand(),
+		ReflogCommand(),
+		CloneCommand(),
+		FetchCommand(),
+		PushCommand(),
+		RemoteCommand(),
+		ServeCommand(),
+		UploadPackCommand(),
+		RevParseCommand(),
+		HashObjectCommand(),
+		LsFilesCommand(),
+		LsTreeCommand(),
+		FsckCommand(),
+		GcCommand(),
+		PruneCommand(),
+		RepackCommand(),
+		CompletionCommand(),
+		HelpCommand(),
+		CompleteCommand(),
+	}
+}
+
+// findCommand returns the command called name, or nil if there is none.
+func findCommand(name string) *Command {
+	for _, cmd := range commands() {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+
+	return nil
 }
 
 func main() {
-	if err := execute(); err != nil {
+	if err := execute(os.Args[1:]); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
-func execute() error {
-	if len(os.Args) < 2 {
-		return errors.New("not enough arguments")
+// globalFlags returns the flags given before the command, with where they
+// are stored.
+func globalFlags() (flags *flag.FlagSet, dir *string, help *bool) {
+	flags = flag.NewFlagSet("got", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	dir = flags.String("C", "", "run as if got was started in `path`")
+	help = flags.Bool("help", false, "show this help, or the help for the command")
+	flags.BoolVar(help, "h", false, "short for --help")
+
+	return flags, dir, help
+}
+
+// execute runs the command line args, which follow the program name.
+func execute(args []string) error {
+	global, dir, help := globalFlags()
+
+	if err := global.Parse(args); err != nil {
+		return fmt.Errorf("%w; run \"got help\" for usage", err)
+	}
+
+	if *dir != "" {
+		if err := os.Chdir(*dir); err != nil {
+			return fmt.Errorf("could not change to %s: %w", *dir, err)
+		}
+	}
+
+	if global.NArg() == 0 {
+		if *help {
+			printUsage(os.Stdout, global)
+			return nil
+		}
+
+		printUsage(os.Stderr, global)
+		return errors.New("no command given")
 	}
 
-	var cmd *Command
-	subCmd := os.Args[1]
+	name, args := global.Arg(0), global.Args()[1:]
 
-	switch subCmd {
-	case "init":
-		cmd = InitCommand()
-	case "add":
-		cmd = AddCommand()
-	case "commit":
-		cmd = CommitCommand()
-	case "checkout":
-		cmd = CheckoutCommand()
-	default:
-		cmd = UnknownCommand(subCmd)
+	cmd := findCommand(name)
+	if cmd == nil {
+		return unknownCommandError(name)
 	}
 
-	if err := cmd.Run(os.Args[2:]); err != nil {
-		return fmt.Errorf("%s command error: %w", subCmd, err)
+	if *help || len(args) > 0 && isHelpFlag(args[0]) {
+		printCommandHelp(os.Stdout, cmd)
+		return nil
 	}
 
-	return nil
-}
+	// Flag errors are returned, and help printed, by execute instead
+	if cmd.Flags != nil {
+		cmd.Flags.SetOutput(io.Discard)
+		cmd.Flags.Usage = func() {}
+	}
 
-func UnknownCommand(cmd string) *Command {
-	return &Command{
-		Name:  "unknown",
-		Short: "Got did not recognise the subcommand",
-		Long:  "Got did not recognise the subcommand; try running \"got --help\" for more",
-		Run: func(_ []string) error {
-			return fmt.Errorf("did not recognise subcommand %q", cmd)
-		},
+	err := cmd.Run(args)
+	if errors.Is(err, flag.ErrHelp) {
+		printCommandHelp(os.Stdout, cmd)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s command error: %w", name, err)
 	}
+
+	return nil
 }
 
 func InitCommand() *Command {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	bare := flags.Bool("bare", false, "create a bare repository, with no working tree, to serve and push to")
+
 	return &Command{
 		Name:  "init",
 		Short: "Initialises a got repository",
-		Long:  "Initialises a got repository with a hidden .got file to hold data",
+		Long:  "Initialises a got repository with a hidden .got file to hold data, or with --bare a repository holding that data directly for others to clone and push to",
+		Help:  "[--bare] [<dir>]",
+		Flags: flags,
 		Run: func(args []string) error {
-			if len(args) > 1 {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			if flags.NArg() > 1 {
 				return errors.New("too many arguments")
 			}
 
@@ -81,15 +173,24 @@ func InitCommand() *Command {
 				return fmt.Errorf("could not get working directory: %w", err)
 			}
 
-			if len(args) == 1 {
-				path = args[0]
+			if flags.NArg() == 1 {
+				path = flags.Arg(0)
+			}
+
+			create := got.Init
+			if *bare {
+				create = got.InitBare
 			}
 
-			if err := got.Init(path); err != nil {
+			if err := create(path); err != nil {
 				return fmt.Errorf("could not initialise got repo: %w", err)
 			}
 
-			fmt.Fprintf(os.Stdout, "Initialised an empty got repository\n")
+			if *bare {
+				fmt.Fprintf(os.Stdout, "Initialised an empty bare got repository\n")
+			} else {
+				fmt.Fprintf(os.Stdout, "Initialised an empty got repository\n")
+			}
 			return nil
 		},
 	}
@@ -100,6 +201,7 @@ func AddCommand() *Command {
 		Name:  "add",
 		Short: "Add objects to the index",
 		Long:  "Add files or directories to the index (staging area)",
+		Help:  "<paths>...",
 		Run: func(args []string) error {
 			if len(args) < 1 {
 				return errors.New("not enough arguments")
@@ -122,12 +224,24 @@ func AddCommand() *Command {
 }
 
 func RemoveCommand() *Command {
+	flags := flag.NewFlagSet("rm", flag.ContinueOnError)
+	cached := flags.Bool("cached", false, "only untrack the files, keeping them in the working directory")
+	recursive := flags.Bool("r", false, "remove directories and everything tracked beneath them")
+	force := flags.Bool("f", false, "remove files even if they have changes that are not staged")
+
 	return &Command{
-		Name:  "remove",
-		Short: "Remove objects from the working directory",
-		Long:  "Remove files or directories from the index (staging area)",
+		Name:     "rm",
+		Short:    "Remove files from the index and working directory",
+		Long:     "Stage the deletion of tracked files, so the next commit no longer contains them, and delete them from the working directory unless --cached is given",
+		Help:     "<paths>...",
+		Complete: byPosition(trackedPaths),
+		Flags:    flags,
 		Run: func(args []string) error {
-			if len(args) < 1 {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			if flags.NArg() < 1 {
 				return errors.New("not enough arguments")
 			}
 
@@ -136,10 +250,15 @@ func RemoveCommand() *Command {
 				return err
 			}
 
-			for _, file := range args {
-				if _, err = index.RemoveFile(file); err != nil {
+			for _, file := range flags.Args() {
+				removed, err := index.RemoveFile(file, *cached, *recursive, *force)
+				if err != nil {
 					return fmt.Errorf("could not remove file %s: %w", file, err)
 				}
+
+				for _, name := range removed {
+					fmt.Fprintf(os.Stdout, "rm '%s'\n", name)
+				}
 			}
 
 			return index.Save()
@@ -147,14 +266,72 @@ func RemoveCommand() *Command {
 	}
 }
 
+// messageFlag collects the values of a flag that can be given many times.
+type messageFlag []string
+
+func (m *messageFlag) String() string {
+	return strings.Join(*m, "\n\n")
+}
+
+func (m *messageFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
 func CommitCommand() *Command {
+	flags := flag.NewFlagSet("commit", flag.ContinueOnError)
+	var messages messageFlag
+	flags.Var(&messages, "m", "use the `message`, each one given making a paragraph")
+	file := flags.String("F", "", "take the message from the `file`, or stdin for -")
+	edit := flags.Bool("e", false, "edit the message from -m, -F or the amended commit")
+	noVerify := flags.Bool("no-verify", false, "skip the pre-commit and commit-msg hooks")
+	flags.BoolVar(noVerify, "n", false, "short for --no-verify")
+	amend := flags.Bool("amend", false, "replace the last commit, keeping its message unless one is given")
+	resetAuthor := flags.Bool("reset-author", false, "with --amend, make yourself the author")
+	allowEmpty := flags.Bool("allow-empty", false, "commit even if nothing changed")
+
 	return &Command{
 		Name:  "commit",
 		Short: "Commit the current index",
-		Long:  "Create a commit (snapshot) of the current state of the objects listed in the index",
+		Long:  "Create a commit (snapshot) of the current state of the objects listed in the index, or replace the last commit with --amend. The message comes from -m, -F or, failing those, $GOT_EDITOR or $EDITOR",
+		Help:  "[<message>]",
+		Flags: flags,
 		Run: func(args []string) error {
-			if len(args) != 1 {
-				return errors.New("you can only pass exactly one argument [commit message] to this command")
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			if *resetAuthor && !*amend {
+				return errors.New("--reset-author can only be used with --amend")
+			}
+
+			if len(messages) > 0 && *file != "" {
+				return errors.New("only one of -m and -F can be given")
+			}
+
+			// A lone argument is still taken as the message
+			if flags.NArg() > 1 || flags.NArg() == 1 && (len(messages) > 0 || *file != "") {
+				return errors.New("the message is given with -m or -F, so no other arguments are taken")
+			}
+
+			message := messages.String()
+			given := len(messages) > 0 || *file != "" || flags.NArg() == 1
+
+			switch {
+			case flags.NArg() == 1:
+				message = flags.Arg(0)
+			case *file == "-":
+				b, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("could not read message from stdin: %w", err)
+				}
+				message = string(b)
+			case *file != "":
+				b, err := os.ReadFile(*file)
+				if err != nil {
+					return fmt.Errorf("could not read message file: %w", err)
+				}
+				message = string(b)
 			}
 
 			index, err := got.GetIndex()
@@ -162,53 +339,186 @@ func CommitCommand() *Command {
 				return errors.New("could not get index file")
 			}
 
-			if index.Length() == 0 {
-				return errors.New("index file empty")
+			// Amending keeps the old message unless asked to edit it
+			if *edit || !given && !*amend {
+				if message, err = index.EditCommitMessage(message, *amend); err != nil {
+					return err
+				}
+			}
+
+			if strings.TrimSpace(message) == "" && !*amend {
+				return errors.New("aborting commit due to empty commit message")
 			}
 
-			return index.Commit(args[0])
+			return index.Commit(message, got.CommitOptions{
+				Amend:       *amend,
+				ResetAuthor: *resetAuthor,
+				AllowEmpty:  *allowEmpty,
+				NoVerify:    *noVerify,
+			})
 		},
 	}
 }
 
-func CheckoutCommand() *Command {
+func ResetCommand() *Command {
+	flags := flag.NewFlagSet("reset", flag.ContinueOnError)
+	soft := flags.Bool("soft", false, "only move the branch")
+	mixed := flags.Bool("mixed", false, "move the branch and reset the index")
+	hard := flags.Bool("hard", false, "move the branch and reset the index and working directory")
+
 	return &Command{
-		Name:  "checkout",
-		Short: "Checkout a specific commit",
-		Long:  "Checkout a specific commit, causing the working directory to revert to the state contained in the commit",
+		Name:     "reset",
+		Short:    "Move the current branch or unstage files",
+		Long:     "Point the current branch at a commit, updating the index (--mixed, the default), nothing else (--soft) or the index and working directory (--hard); or, given paths, unstage them back to their version in HEAD or the given commit",
+		Help:     "[<rev>] [--] [<paths>...]",
+		Complete: byPosition(revisionsAndPaths),
+		Flags:    flags,
 		Run: func(args []string) error {
-			if len(args) != 1 {
-				return errors.New("you can only pass exactly one argument [commit hash] to this command")
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			mode := got.RESET_MIXED
+			switch {
+			case *soft && (*mixed || *hard), *mixed && *hard:
+				return errors.New("only one of --soft, --mixed and --hard can be given")
+			case *soft:
+				mode = got.RESET_SOFT
+			case *hard:
+				mode = got.RESET_HARD
+			}
+
+			rev, paths := got.HeadFile, flags.Args()
+
+			// A "--" separates the revision from the paths; without one the
+			// first argument is a revision if it names a commit
+			rest := flags.Args()
+			if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+				paths = rest
+			} else if sep := slices.Index(rest, "--"); sep >= 0 {
+				if sep > 1 {
+					return errors.New("only one revision can come before \"--\"")
+				}
+				if sep == 1 {
+					rev = rest[0]
+				}
+				paths = rest[sep+1:]
+			} else if len(rest) > 0 {
+				if _, err := got.ResolveCommit(rest[0]); err == nil {
+					rev, paths = rest[0], rest[1:]
+				}
 			}
 
-			id := args[0]
+			if len(paths) == 0 {
+				if err := got.Reset(rev, mode); err != nil {
+					return err
+				}
+
+				if mode == got.RESET_HARD {
+					head, err := got.ResolveRevision(got.HeadFile)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(os.Stdout, "HEAD is now at %s\n", got.FindUniqueAbbrev(head))
+				}
+				return nil
+			}
 
-			if len(id) < 6 {
-				return errors.New("you must provid at least 6 characters of the commit ID")
+			if mode != got.RESET_MIXED {
+				return fmt.Errorf("cannot do a --%s reset with paths", mode)
 			}
 
-			file, err := got.GetObjectFile(id)
+			index, err := got.GetIndex()
 			if err != nil {
-				return fmt.Errorf("error getting object file: %w", err)
+				return err
+			}
+
+			if err = index.ResetPaths(rev, paths); err != nil {
+				return err
 			}
 
-			decompressor, err := zlib.NewReader(file)
+			return index.Save()
+		},
+	}
+}
+
+func CheckoutCommand() *Command {
+	flags := flag.NewFlagSet("checkout", flag.ContinueOnError)
+	newBranch := flags.String("b", "", "create a branch with this `name` and check it out")
+	noVerify := flags.Bool("no-verify", false, "skip the post-checkout hook")
+
+	return &Command{
+		Name:     "checkout",
+		Short:    "Checkout a branch or commit",
+		Long:     "Checkout a branch or commit, causing the working directory to revert to the state contained in the commit",
+		Help:     "[<rev>]",
+		Complete: byPosition(revisionNames),
+		Flags:    flags,
+		Run: func(args []string) error {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			rev := got.HeadFile
+			switch {
+			case flags.NArg() == 1:
+				rev = flags.Arg(0)
+			case flags.NArg() > 1 || flags.NArg() == 0 && *newBranch == "":
+				return errors.New("you can only pass exactly one argument [branch or commit] to this command")
+			}
+
+			if err := got.Checkout(rev, *newBranch, *noVerify); err != nil {
+				return err
+			}
+
+			head, err := got.ResolveRevision(got.HeadFile)
 			if err != nil {
-				return fmt.Errorf("could not create decompressor: %w ", err)
+				return err
 			}
 
-			decompressor.Close()
-			var out bytes.Buffer
-			if _, err = io.Copy(&out, decompressor); err != nil {
+			fmt.Fprintf(os.Stdout, "HEAD is now at %s\n", got.FindUniqueAbbrev(head))
+			return nil
+		},
+	}
+}
+
+func ReflogCommand() *Command {
+	return &Command{
+		Name:     "reflog",
+		Short:    "Show where a ref has pointed",
+		Long:     "Show the recorded moves of HEAD or the given ref, newest first, which can be named as <ref>@{n} in revisions",
+		Help:     "[<ref>]",
+		Complete: byPosition(revisionNames, noCandidates),
+		Run: func(args []string) error {
+			if len(args) > 1 {
+				return errors.New("reflog takes at most one ref")
+			}
+
+			name := got.HeadFile
+			if len(args) == 1 {
+				name = args[0]
+			}
+
+			ref, err := got.ReflogRef(name)
+			if err != nil {
 				return err
 			}
 
-			lines := strings.Split(out.String(), "\n")
-			for _, line := range lines {
-				fmt.Println(line + "\n")
+			entries, err := got.ReadReflog(ref)
+			if err != nil {
+				return err
 			}
 
-			// 3. Update HEAD to point at provided commit
+			for n := 0; n < len(entries); n++ {
+				entry := entries[len(entries)-1-n]
+
+				abbrev := "0000000"
+				if entry.New != "" {
+					abbrev = got.FindUniqueAbbrev(entry.New)
+				}
+
+				fmt.Fprintf(os.Stdout, "%s %s@{%d}: %s\n", abbrev, name, n, entry.Reason)
+			}
 
 			return nil
 		},
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	got "github.com/ljpurcell/got/internal"
+)
+
+func GcCommand() *Command {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	options := pruneFlags(flags)
+
+	return &Command{
+		Name:  "gc",
+		Short: "Clean up the repository",
+		Long:  "Clean up the repository by packing every reachable object and deleting unreachable objects older than the grace period",
+		Flags: flags,
+		Run: func(args []string) error {
+			return runPrune(flags, options, args, true)
+		},
+	}
+}
+
+func PruneCommand() *Command {
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	options := pruneFlags(flags)
+
+	return &Command{
+		Name:  "prune",
+		Short: "Delete unreachable objects",
+		Long:  "Delete loose objects that cannot be reached from any ref, HEAD, the index or a reflog and are older than the grace period",
+		Flags: flags,
+		Run: func(args []string) error {
+			return runPrune(flags, options, args, false)
+		},
+	}
+}
+
+func RepackCommand() *Command {
+	return &Command{
+		Name:  "repack",
+		Short: "Pack objects into a single packfile",
+		Long:  "Write every reachable object into a single packfile with a sorted index, replacing existing packs and the loose copies of packed objects",
+		Run: func(args []string) error {
+			if len(args) > 0 {
+				return errors.New("too many arguments")
+			}
+
+			return runRepack()
+		},
+	}
+}
+
+func runRepack() error {
+	result, err := got.Repack()
+	if err != nil {
+		return err
+	}
+
+	if result.Packed == 0 {
+		fmt.Fprintln(os.Stdout, "Nothing to pack")
+		return nil
+	}
+
+	fmt.Fprintf(os.Stdout, "Packed %d objects (%d as deltas) into %s, removing %d loose objects\n", result.Packed, result.Deltas, filepath.Base(result.Pack), result.Removed)
+	return nil
+}
+
+// pruneOptions are the flags gc and prune share.
+type pruneOptions struct {
+	dryRun *bool
+	expire *string
+}
+
+func pruneFlags(flags *flag.FlagSet) pruneOptions {
+	return pruneOptions{
+		dryRun: flags.Bool("dry-run", false, "report what would be deleted without deleting it"),
+		expire: flags.String("expire", "14d", "only delete unreachable objects older than this `age` (e.g. 14d, 12h or now)"),
+	}
+}
+
+// runPrune deletes unreachable objects, first packing the reachable ones
+// when repack is set.
+func runPrune(flags *flag.FlagSet, options pruneOptions, args []string, repack bool) error {
+	dryRun, expire := options.dryRun, options.expire
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() > 0 {
+		return errors.New("too many arguments")
+	}
+
+	grace, err := parseExpiry(*expire)
+	if err != nil {
+		return err
+	}
+
+	if repack && !*dryRun {
+		if err = runRepack(); err != nil {
+			return err
+		}
+	}
+
+	result, err := got.Prune(grace, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+		for _, id := range result.Removed {
+			fmt.Fprintln(os.Stdout, id)
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "%s %d unreachable objects, reclaiming %d bytes\n", verb, len(result.Removed), result.Bytes)
+	return nil
+}
+
+// parseExpiry reads a grace period given as "now", a number of days such
+// as "14d", or a Go duration such as "36h".
+func parseExpiry(expire string) (time.Duration, error) {
+	if expire == "now" {
+		return 0, nil
+	}
+
+	if days, ok := strings.CutSuffix(expire, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid expiry %q", expire)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	grace, err := time.ParseDuration(expire)
+	if err != nil || grace < 0 {
+		return 0, fmt.Errorf("invalid expiry %q", expire)
+	}
+
+	return grace, nil
+}
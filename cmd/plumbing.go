@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	got "github.com/ljpurcell/got/internal"
+)
+
+func HashObjectCommand() *Command {
+	flags := flag.NewFlagSet("hash-object", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the object into the object database")
+	objType := flags.String("t", got.BLOB, "`type` of object to create")
+	stdin := flags.Bool("stdin", false, "read the content from standard input")
+
+	return &Command{
+		Name:  "hash-object",
+		Short: "Compute the object id for content",
+		Long:  "Compute the object id for the content of each file (or stdin), optionally writing the object to the object database",
+		Help:  "[<files>...]",
+		Flags: flags,
+		Run: func(args []string) error {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			if !*stdin && flags.NArg() == 0 {
+				return errors.New("not enough arguments")
+			}
+
+			if !got.IsObjectType(*objType) {
+				return fmt.Errorf("invalid object type %q", *objType)
+			}
+
+			hash := func(r io.Reader) error {
+				id, err := got.HashObject(r, *objType, *write)
+				if err != nil {
+					return err
+				}
+
+				fmt.Fprintln(os.Stdout, id)
+				return nil
+			}
+
+			if *stdin {
+				if err := hash(os.Stdin); err != nil {
+					return fmt.Errorf("could not hash standard input: %w", err)
+				}
+			}
+
+			for _, name := range flags.Args() {
+				file, err := os.Open(name)
+				if err != nil {
+					return err
+				}
+
+				err = hash(file)
+				file.Close()
+				if err != nil {
+					return fmt.Errorf("could not hash %s: %w", name, err)
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func LsFilesCommand() *Command {
+	flags := flag.NewFlagSet("ls-files", flag.ContinueOnError)
+	stage := flags.Bool("stage", false, "show the mode, object id and stage of each file")
+	others := flags.Bool("others", false, "show untracked files instead")
+	ignored := flags.Bool("ignored", false, "show only ignored untracked files")
+
+	return &Command{
+		Name:  "ls-files",
+		Short: "List the files in the index",
+		Long:  "List the files the index tracks, or the untracked files in the working directory",
+		Flags: flags,
+		Run: func(args []string) error {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			if flags.NArg() > 0 {
+				return errors.New("too many arguments")
+			}
+
+			index, err := got.GetIndex()
+			if err != nil {
+				return err
+			}
+
+			if *others || *ignored {
+				files, err := index.UntrackedFiles(*ignored)
+				if err != nil {
+					return err
+				}
+
+				for _, file := range files {
+					fmt.Fprintln(os.Stdout, file)
+				}
+				return nil
+			}
+
+			files, err := index.TrackedFiles()
+			if err != nil {
+				return err
+			}
+
+			unmerged, err := index.UnmergedFiles()
+			if err != nil {
+				return err
+			}
+
+			// Conflicted files are listed by their merge stages instead
+			entries := []got.UnmergedEntry{}
+			for _, file := range files {
+				if !slices.ContainsFunc(unmerged, func(e got.UnmergedEntry) bool { return e.Name == file.Name }) {
+					entries = append(entries, got.UnmergedEntry{TreeEntry: file})
+				}
+			}
+			entries = append(entries, unmerged...)
+
+			slices.SortStableFunc(entries, func(a, b got.UnmergedEntry) int {
+				return strings.Compare(a.Name, b.Name)
+			})
+
+			for n, entry := range entries {
+				if *stage {
+					fmt.Fprintf(os.Stdout, "%s %s %d\t%s\n", entry.Mode, entry.Id, entry.Stage, entry.Name)
+				} else if n == 0 || entries[n-1].Name != entry.Name {
+					fmt.Fprintln(os.Stdout, entry.Name)
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func LsTreeCommand() *Command {
+	flags := flag.NewFlagSet("ls-tree", flag.ContinueOnError)
+	recursive := flags.Bool("r", false, "recurse into subtrees")
+	nameOnly := flags.Bool("name-only", false, "only show the path of each entry")
+
+	return &Command{
+		Name:     "ls-tree",
+		Short:    "List the contents of a tree",
+		Long:     "List the contents of the tree held by a commit or tree object, optionally limited to the given paths",
+		Help:     "<tree-ish> [<paths>...]",
+		Complete: byPosition(revisionNames, trackedPaths),
+		Flags:    flags,
+		Run: func(args []string) error {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			if flags.NArg() < 1 {
+				return errors.New("not enough arguments")
+			}
+
+			entries, err := got.ListTree(flags.Arg(0), *recursive, flags.Args()[1:])
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range entries {
+				if *nameOnly {
+					fmt.Fprintln(os.Stdout, entry.Name)
+				} else {
+					fmt.Fprintf(os.Stdout, "%s %s %s\t%s\n", entry.Mode, entry.Type, entry.Id, entry.Name)
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func RevParseCommand() *Command {
+	flags := flag.NewFlagSet("rev-parse", flag.ContinueOnError)
+	short := flags.Bool("short", false, "print the shortest unambiguous abbreviation of each id")
+
+	return &Command{
+		Name:     "rev-parse",
+		Short:    "Resolve revisions to object ids",
+		Long:     "Resolve each revision expression (branch, tag, HEAD~n, rev^n, rev^{tree}, rev:path, @{-n} or short id) to a full object id",
+		Help:     "<revs>...",
+		Complete: byPosition(revisionNames),
+		Flags:    flags,
+		Run: func(args []string) error {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			if flags.NArg() < 1 {
+				return errors.New("not enough arguments")
+			}
+
+			for _, rev := range flags.Args() {
+				id, err := got.ResolveRevision(rev)
+				if err != nil {
+					return err
+				}
+
+				if *short {
+					id = got.FindUniqueAbbrev(id)
+				}
+
+				fmt.Fprintln(os.Stdout, id)
+			}
+
+			return nil
+		},
+	}
+}
+
+func FsckCommand() *Command {
+	return &Command{
+		Name:  "fsck",
+		Short: "Verify the integrity of the repository",
+		Long:  "Check that every object hashes to its id and that commits, trees, refs and HEAD only point at valid objects, reporting corrupt and dangling objects",
+		Run: func(args []string) error {
+			if len(args) > 0 {
+				return errors.New("too many arguments")
+			}
+
+			result, err := got.Fsck()
+			if err != nil {
+				return err
+			}
+
+			for _, problem := range result.Problems {
+				fmt.Fprintln(os.Stdout, problem)
+			}
+
+			for _, dangling := range result.Dangling {
+				fmt.Fprintln(os.Stdout, dangling)
+			}
+
+			if len(result.Problems) > 0 {
+				return fmt.Errorf("found %d problems", len(result.Problems))
+			}
+
+			return nil
+		},
+	}
+}
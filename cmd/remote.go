@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	got "github.com/ljpurcell/got/internal"
+)
+
+func CloneCommand() *Command {
+	return &Command{
+		Name:  "clone",
+		Short: "Copy a repository",
+		Long:  "Copy the repository at a path or url into a new directory, named after it unless given, with the source as the origin remote and its HEAD branch checked out",
+		Help:  "<url> [<dir>]",
+		Run: func(args []string) error {
+			if len(args) < 1 || len(args) > 2 {
+				return errors.New("clone takes a repository and at most one directory")
+			}
+
+			url := args[0]
+
+			dir := ""
+			if len(args) == 2 {
+				dir = args[1]
+			} else {
+				dir = strings.TrimSuffix(filepath.Base(strings.TrimRight(url, "/")), got.Repo)
+				dir = strings.TrimSuffix(dir, ".")
+			}
+
+			if dir == "" || dir == "." || dir == "/" {
+				return fmt.Errorf("could not pick a directory name for %s; give one", url)
+			}
+
+			fmt.Fprintf(os.Stdout, "Cloning into '%s'...\n", dir)
+			return got.Clone(url, dir)
+		},
+	}
+}
+
+func FetchCommand() *Command {
+	return &Command{
+		Name:     "fetch",
+		Short:    "Download objects and refs from a remote",
+		Long:     "Copy the objects of a remote's branches that are missing here and update the remote-tracking refs under refs/remotes/<remote>/",
+		Help:     "<remote>",
+		Complete: byPosition(remoteNames, noCandidates),
+		Run: func(args []string) error {
+			if len(args) != 1 {
+				return errors.New("fetch takes exactly one remote")
+			}
+
+			changes, err := got.Fetch(args[0])
+			if err != nil {
+				return err
+			}
+
+			for _, change := range changes {
+				remote := strings.TrimPrefix(change.Ref, got.RemotesDir+"/")
+				_, branch, _ := strings.Cut(remote, "/")
+				printRefChange(change, branch, remote)
+			}
+
+			return nil
+		},
+	}
+}
+
+func PushCommand() *Command {
+	flags := flag.NewFlagSet("push", flag.ContinueOnError)
+	force := flags.Bool("force", false, "move the remote branch even if it is not an ancestor")
+
+	return &Command{
+		Name:     "push",
+		Short:    "Update a remote branch",
+		Long:     "Send a branch and the objects it needs to a remote and move the remote's branch of the same name, which is refused unless it only moves forward or --force is given, and always when that branch is checked out in the remote",
+		Help:     "<remote> <branch>",
+		Complete: byPosition(remoteNames, branchNames, noCandidates),
+		Flags:    flags,
+		Run: func(args []string) error {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			if flags.NArg() != 2 {
+				return errors.New("push takes a remote and a branch")
+			}
+
+			branch := flags.Arg(1)
+
+			change, err := got.Push(flags.Arg(0), branch, *force)
+			if err != nil {
+				return err
+			}
+
+			if change == nil {
+				fmt.Fprintln(os.Stdout, "Everything up-to-date")
+				return nil
+			}
+
+			printRefChange(*change, branch, branch)
+			return nil
+		},
+	}
+}
+
+// printRefChange prints a moved ref as "<old>..<new> from -> to", marking
+// new refs and forced updates.
+func printRefChange(change got.RefChange, from, to string) {
+	switch {
+	case change.Old == "":
+		fmt.Fprintf(os.Stdout, " * %-17s %s -> %s\n", "[new branch]", from, to)
+	case change.Forced:
+		span := got.FindUniqueAbbrev(change.Old) + "..." + got.FindUniqueAbbrev(change.New)
+		fmt.Fprintf(os.Stdout, " + %-17s %s -> %s (forced update)\n", span, from, to)
+	default:
+		span := got.FindUniqueAbbrev(change.Old) + ".." + got.FindUniqueAbbrev(change.New)
+		fmt.Fprintf(os.Stdout, "   %-17s %s -> %s\n", span, from, to)
+	}
+}
+
+func RemoteCommand() *Command {
+	return &Command{
+		Name:  "remote",
+		Short: "Manage the remotes",
+		Long:  "List the remotes (list, the default), name a repository with \"add <name> <url>\", or forget one and its remote-tracking refs with \"remove <name>\"",
+		Help:  "[list | add <name> <url> | remove <name>]",
+		Complete: subcommands(map[string]func([]string) []string{
+			"list":   nil,
+			"add":    nil,
+			"remove": byPosition(remoteNames, noCandidates),
+		}),
+		Run: func(args []string) error {
+			sub := "list"
+			if len(args) > 0 {
+				sub, args = args[0], args[1:]
+			}
+
+			switch sub {
+			case "list":
+				if len(args) > 0 {
+					return errors.New("remote list takes no arguments")
+				}
+
+				remotes, err := got.ListRemotes()
+				if err != nil {
+					return err
+				}
+
+				for _, remote := range remotes {
+					fmt.Fprintf(os.Stdout, "%s\t%s\n", remote.Name, remote.URL)
+				}
+				return nil
+			case "add":
+				if len(args) != 2 {
+					return errors.New("remote add takes a name and a url")
+				}
+				return got.AddRemote(args[0], args[1])
+			case "remove":
+				if len(args) != 1 {
+					return errors.New("remote remove takes a name")
+				}
+				return got.RemoveRemote(args[0])
+			default:
+				return fmt.Errorf("unknown remote subcommand %q", sub)
+			}
+		},
+	}
+}
+
+func ServeCommand() *Command {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", ":8080", "the `address` to listen on")
+
+	return &Command{
+		Name:  "serve",
+		Short: "Serve a repository over HTTP",
+		Long:  "Serve the repository in the given directory, or the current one, over HTTP so that clone, fetch and push can use it with an http:// url",
+		Help:  "[<dir>]",
+		Flags: flags,
+		Run: func(args []string) error {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+
+			if flags.NArg() > 1 {
+				return errors.New("serve takes at most one directory")
+			}
+
+			dir := "."
+			if flags.NArg() == 1 {
+				dir = flags.Arg(0)
+			}
+
+			handler, err := got.NewServer(dir)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stdout, "Serving %s on %s\n", dir, *addr)
+			return http.ListenAndServe(*addr, handler)
+		},
+	}
+}
+
+func UploadPackCommand() *Command {
+	return &Command{
+		Name:  "upload-pack",
+		Short: "Serve a repository over stdin and stdout",
+		Long:  "Serve the repository in the given directory to a single clone, fetch or push over stdin and stdout; remotes with an ext::<command> url run a command that ends up running this",
+		Help:  "<dir>",
+		Run: func(args []string) error {
+			if len(args) != 1 {
+				return errors.New("upload-pack takes exactly one directory")
+			}
+
+			return got.ServePipe(args[0], os.Stdin, os.Stdout)
+		},
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	got "github.com/ljpurcell/got/internal"
+)
+
+func StashCommand() *Command {
+	return &Command{
+		Name:  "stash",
+		Short: "Shelve uncommitted changes",
+		Long:  "Save staged and unstaged changes to tracked files and revert them (push, the default), then list, show, apply, pop or drop the saved stashes, which are named stash@{n} with stash@{0} the newest",
+		Help:  "[push [-m <message>] [<paths>...] | list | show | apply | pop | drop [<stash>]]",
+		Complete: subcommands(map[string]func([]string) []string{
+			"push":  byPosition(trackedPaths),
+			"list":  nil,
+			"show":  byPosition(stashNames, noCandidates),
+			"apply": byPosition(stashNames, noCandidates),
+			"pop":   byPosition(stashNames, noCandidates),
+			"drop":  byPosition(stashNames, noCandidates),
+		}),
+		Run: func(args []string) error {
+			sub := "push"
+			if len(args) > 0 {
+				sub, args = args[0], args[1:]
+			}
+
+			if sub == "push" {
+				return runStashPush(args)
+			}
+
+			if sub != "list" && len(args) > 1 {
+				return fmt.Errorf("stash %s takes at most one stash", sub)
+			}
+
+			name := ""
+			if len(args) == 1 {
+				name = args[0]
+			}
+
+			switch sub {
+			case "list":
+				stashes, err := got.StashList()
+				if err != nil {
+					return err
+				}
+
+				for n, stash := range stashes {
+					fmt.Fprintf(os.Stdout, "stash@{%d}: %s\n", n, stash.Reason)
+				}
+				return nil
+			case "show":
+				changes, err := got.StashShow(name)
+				if err != nil {
+					return err
+				}
+
+				for _, change := range changes {
+					fmt.Fprintf(os.Stdout, "%s\t%s\n", change.Status, change.Name)
+				}
+				return nil
+			case "apply":
+				return got.StashApply(name)
+			case "pop", "drop":
+				drop := got.StashDrop
+				if sub == "pop" {
+					drop = got.StashPop
+				}
+
+				stashId, err := drop(name)
+				if err != nil {
+					return err
+				}
+
+				if name == "" {
+					name = "stash@{0}"
+				}
+				fmt.Fprintf(os.Stdout, "Dropped %s (%s)\n", name, got.FindUniqueAbbrev(stashId))
+				return nil
+			default:
+				return fmt.Errorf("unknown stash subcommand %q", sub)
+			}
+		},
+	}
+}
+
+func runStashPush(args []string) error {
+	flags := flag.NewFlagSet("stash push", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	message := flags.String("m", "", "describe the stash")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	stashId, err := got.StashPush(*message, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Saved working directory and index state as stash@{0} (%s)\n", got.FindUniqueAbbrev(stashId))
+	return nil
+}
@@ -0,0 +1,146 @@
+package got
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BlameLine is one line of a file with the commit that last changed it.
+// Line is its number in the blamed revision and OrigLine its number in
+// Commit, both counting from 1.
+type BlameLine struct {
+	Commit   *Commit
+	Line     int
+	OrigLine int
+	Content  string
+}
+
+// Blame finds the commit that last changed each line of name in rev, or
+// HEAD when rev is empty. Lines are carried back along the first parent
+// chain for as long as the diff between a commit and its parent keeps
+// them, and are blamed on the first commit where they were not kept. A
+// start and end above zero limit the lines blamed, counting from 1.
+func Blame(name, rev string, start, end int) ([]BlameLine, error) {
+	if rev == "" {
+		rev = HeadFile
+	}
+
+	commitId, err := ResolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	name = cleanPath(name)
+
+	files, err := commitFiles(commitId)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("no such path %q in %s", name, rev)
+	}
+
+	content, err := readBlob(entry.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := splitLines(content)
+
+	if start <= 0 {
+		start = 1
+	}
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if len(lines) > 0 && start > len(lines) {
+		return nil, fmt.Errorf("%s has only %d lines", name, len(lines))
+	}
+	if start > end+1 || len(lines) > 0 && start > end {
+		return nil, fmt.Errorf("invalid line range %d,%d", start, end)
+	}
+
+	blamed := make([]BlameLine, 0, end-start+1)
+	for n := start; n <= end; n++ {
+		blamed = append(blamed, BlameLine{Line: n, Content: strings.TrimSuffix(lines[n-1], "\n")})
+	}
+
+	// pending maps the line numbers still to blame in the commit being
+	// looked at to where they are in blamed
+	pending := map[int]int{}
+	for i := range blamed {
+		pending[start-1+i] = i
+	}
+
+	for len(pending) > 0 {
+		commit, err := readCommit(commitId)
+		if err != nil {
+			return nil, err
+		}
+
+		parentLines, parentBlob, err := blameParent(commit, name)
+		if err != nil {
+			return nil, err
+		}
+
+		kept := map[int]int{}
+		if parentBlob == entry.Id {
+			for n := range lines {
+				kept[n] = n
+			}
+		} else if parentLines != nil {
+			for _, edit := range diffLines(parentLines, lines) {
+				if edit.Op == diffEqual {
+					kept[edit.New] = edit.Old
+				}
+			}
+		}
+
+		carried := map[int]int{}
+		for n, i := range pending {
+			if old, ok := kept[n]; ok {
+				carried[old] = i
+				continue
+			}
+
+			blamed[i].Commit = commit
+			blamed[i].OrigLine = n + 1
+		}
+
+		if len(carried) == 0 {
+			break
+		}
+
+		commitId, pending, lines = commit.Parents[0], carried, parentLines
+		entry.Id = parentBlob
+	}
+
+	return blamed, nil
+}
+
+// blameParent returns the lines of name in the first parent of commit and
+// its blob id, or nil when there is no parent or it has no such file.
+func blameParent(commit *Commit, name filePath) ([]string, id, error) {
+	if len(commit.Parents) == 0 {
+		return nil, "", nil
+	}
+
+	files, err := commitFiles(commit.Parents[0])
+	if err != nil {
+		return nil, "", err
+	}
+
+	entry, ok := files[name]
+	if !ok {
+		return nil, "", nil
+	}
+
+	content, err := readBlob(entry.Id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return splitLines(content), entry.Id, nil
+}
@@ -0,0 +1,71 @@
+package got
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBlame(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "f.txt", "one\ntwo\nthree\n")
+	commitTestFiles(t, "first", "f.txt")
+	first := mustResolve(t, HeadFile)
+
+	writeTestFile(t, "other.txt", "unrelated\n")
+	commitTestFiles(t, "other", "other.txt")
+
+	writeTestFile(t, "f.txt", "zero\none\nTWO\nthree\n")
+	commitTestFiles(t, "second", "f.txt")
+	second := mustResolve(t, HeadFile)
+
+	lines, err := Blame("f.txt", "", 0, 0)
+	if err != nil {
+		t.Fatalf("could not blame: %s", err)
+	}
+
+	contents := []string{}
+	for _, line := range lines {
+		contents = append(contents, line.Content)
+		want := second
+		if line.Content == "one" || line.Content == "three" {
+			want = first
+		}
+		if line.Commit.Id != want {
+			t.Errorf("line %q should be blamed on %s, got %s", line.Content, want, line.Commit.Id)
+		}
+	}
+	if !slices.Equal(contents, []string{"zero", "one", "TWO", "three"}) {
+		t.Fatalf("blame should cover every line, got %q", contents)
+	}
+
+	if lines[3].Line != 4 || lines[3].OrigLine != 3 {
+		t.Errorf("\"three\" should be line 4, and line 3 where it was added, got %d and %d", lines[3].Line, lines[3].OrigLine)
+	}
+	if lines[0].Commit.AuthoredAt.IsZero() {
+		t.Errorf("blamed commits should carry their author date")
+	}
+
+	lines, err = Blame("f.txt", HeadFile, 2, 3)
+	if err != nil {
+		t.Fatalf("could not blame a range: %s", err)
+	}
+	if len(lines) != 2 || lines[0].Content != "one" || lines[1].Content != "TWO" {
+		t.Fatalf("the range should limit the lines blamed, got %+v", lines)
+	}
+
+	lines, err = Blame("f.txt", "HEAD~", 0, 0)
+	if err != nil {
+		t.Fatalf("could not blame an older revision: %s", err)
+	}
+	if len(lines) != 3 || lines[1].Commit.Id != first {
+		t.Fatalf("blaming HEAD~ should see the first version, got %+v", lines)
+	}
+
+	if _, err = Blame("f.txt", "", 5, 0); err == nil {
+		t.Errorf("a range past the end of the file should be refused")
+	}
+	if _, err = Blame("missing.txt", "", 0, 0); err == nil {
+		t.Errorf("blaming a file not in the revision should fail")
+	}
+}
@@ -0,0 +1,280 @@
+package got
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Checkout switches the working directory to rev. When rev names a branch
+// HEAD is attached to it, otherwise HEAD is detached at the commit. Passing
+// newBranch creates that branch at rev and checks it out instead. Unless
+// noVerify is set, the post-checkout hook runs afterwards.
+func Checkout(rev string, newBranch string, noVerify bool) error {
+	index, err := GetIndex()
+	if err != nil {
+		return err
+	}
+
+	if index.Length() != 0 {
+		return errors.New("you have staged changes; commit them before checking out")
+	}
+
+	target, err := ResolveCommit(rev)
+	if err != nil {
+		return err
+	}
+
+	branch, isBranch, err := BranchName(rev)
+	if err != nil {
+		return err
+	}
+
+	if newBranch != "" {
+		if !isValidRefName(newBranch) {
+			return fmt.Errorf("%q is not a valid branch name", newBranch)
+		}
+
+		existing, err := readRef(branchRef(newBranch))
+		if err != nil {
+			return err
+		}
+		if existing != "" {
+			return fmt.Errorf("a branch named %q already exists", newBranch)
+		}
+
+		branch, isBranch = newBranch, true
+	}
+
+	currentRef, current, err := readHead()
+	if err != nil {
+		return err
+	}
+
+	if err = switchWorkingTree(current, target); err != nil {
+		return err
+	}
+
+	if newBranch != "" {
+		if err = updateRef(branchRef(newBranch), target, "branch: Created from "+rev); err != nil {
+			return err
+		}
+	}
+
+	from := current
+	if currentRef != "" {
+		from = strings.TrimPrefix(currentRef, RefsDir+"/"+RefHeadsDir+"/")
+	}
+
+	to := target
+	headRef := ""
+	if isBranch {
+		to = branch
+		headRef = branchRef(branch)
+	}
+
+	if err = writeHead(headRef, target); err != nil {
+		return err
+	}
+
+	if err = appendReflog(HeadFile, current, target, fmt.Sprintf("checkout: moving from %s to %s", from, to)); err != nil {
+		return err
+	}
+
+	if !noVerify {
+		previous := current
+		if previous == "" {
+			previous = zeroId
+		}
+
+		// The checkout is done, so a failing hook changes nothing
+		runHook("post-checkout", previous, target, "1")
+	}
+
+	return nil
+}
+
+// commitFiles returns the files in the commit's tree keyed by path, or no
+// files for the empty id.
+func commitFiles(commitId id) (map[filePath]TreeEntry, error) {
+	if commitId == "" {
+		return map[filePath]TreeEntry{}, nil
+	}
+
+	commit, err := readCommit(commitId)
+	if err != nil {
+		return nil, err
+	}
+
+	return flattenTree(commit.Tree)
+}
+
+// switchWorkingTree rewrites the working directory from the tree of commit
+// from to that of commit to. It refuses, before touching anything, when a
+// local change or an untracked file would be overwritten.
+func switchWorkingTree(from, to id) error {
+	current, err := commitFiles(from)
+	if err != nil {
+		return err
+	}
+
+	target, err := commitFiles(to)
+	if err != nil {
+		return err
+	}
+
+	return updateWorkingTree(current, target)
+}
+
+// updateWorkingTree makes the working directory hold target where it
+// currently holds current, leaving files that are the same in both alone.
+func updateWorkingTree(current, target map[filePath]TreeEntry) error {
+	conflicts := []filePath{}
+
+	for name, entry := range current {
+		if t, ok := target[name]; ok && sameEntry(t, entry) {
+			continue
+		}
+
+		if modified, err := workingFileDiffers(name, entry); err != nil {
+			return err
+		} else if modified {
+			conflicts = append(conflicts, name)
+		}
+	}
+
+	for name := range target {
+		if _, tracked := current[name]; tracked {
+			continue
+		}
+
+		if _, err := os.Lstat(name); err == nil {
+			conflicts = append(conflicts, name)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("local changes would be overwritten: %s", strings.Join(conflicts, ", "))
+	}
+
+	for name := range current {
+		if _, ok := target[name]; !ok {
+			if err := removeWorkingFile(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, entry := range target {
+		if c, ok := current[name]; ok && sameEntry(c, entry) {
+			continue
+		}
+
+		if err := writeWorkingFile(name, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// workingFileDiffers reports whether the working copy of name no longer has
+// the content and mode of entry. A missing file counts as differing.
+func workingFileDiffers(name filePath, entry TreeEntry) (bool, error) {
+	mode, err := workingFileMode(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	workingId, _, err := formatHexId(name, BLOB)
+	if err != nil {
+		return false, err
+	}
+
+	return workingId != entry.Id || mode != entry.Mode, nil
+}
+
+func readBlob(blobId id) ([]byte, error) {
+	t, content, err := ReadObject(blobId)
+	if err != nil {
+		return nil, err
+	}
+
+	if t != BLOB {
+		return nil, fmt.Errorf("object %s is a %s, not a blob", blobId, t)
+	}
+
+	return content, nil
+}
+
+// writeWorkingFile writes the blob of entry to name, as a symlink or with
+// the permissions its mode calls for.
+func writeWorkingFile(name filePath, entry TreeEntry) error {
+	content, err := readBlob(entry.Id)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.FromSlash(name)
+
+	if entry.Mode == MODE_SYMLINK {
+		if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return err
+		}
+		if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return os.Symlink(filepath.FromSlash(string(content)), path)
+	}
+
+	if err = writeWorkingContent(name, content); err != nil {
+		return err
+	}
+
+	perm := fs.FileMode(0644)
+	if entry.Mode == MODE_EXECUTABLE {
+		perm = 0755
+	}
+
+	return os.Chmod(path, perm)
+}
+
+// writeWorkingContent writes content to name as a regular file, replacing
+// a symlink there rather than writing through it.
+func writeWorkingContent(name filePath, content []byte) error {
+	path := filepath.FromSlash(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(path, content, 0666)
+}
+
+// removeWorkingFile deletes the file along with any directories left empty
+// by its removal.
+func removeWorkingFile(name filePath) error {
+	path := filepath.FromSlash(name)
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package got
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// A delta rebuilds a target object from a base object. It starts with the
+// sizes of the base and the target as little-endian base-128 numbers, then
+// holds a sequence of instructions:
+//
+//   - copy, with the top bit set: the low four bits say which bytes of a
+//     little-endian offset into the base follow, the next three which bytes
+//     of the length (where zero means 0x10000)
+//   - insert, with the top bit clear: the byte gives the count, 1 to 127,
+//     of literal bytes that follow
+const (
+	// deltaBlock is the length of the base chunks matched against a target
+	deltaBlock = 16
+	// deltaWindow is how many preceding objects are tried as a delta base
+	deltaWindow = 10
+	// maxDeltaDepth bounds how long a chain of deltas may get
+	maxDeltaDepth = 50
+	// maxCopySize is the most one copy instruction can encode
+	maxCopySize = 0xffffff
+)
+
+// makeDelta returns a delta that rebuilds target from base, or nil when it
+// would be larger than maxSize.
+func makeDelta(base, target []byte, maxSize int) []byte {
+	delta := appendDeltaSize(nil, uint64(len(base)))
+	delta = appendDeltaSize(delta, uint64(len(target)))
+
+	index := map[string]int{}
+	for i := 0; i+deltaBlock <= len(base); i += deltaBlock {
+		if _, ok := index[string(base[i:i+deltaBlock])]; !ok {
+			index[string(base[i:i+deltaBlock])] = i
+		}
+	}
+
+	pending := 0
+	for i := 0; i+deltaBlock <= len(target); {
+		offset, ok := index[string(target[i:i+deltaBlock])]
+		if !ok {
+			i++
+			continue
+		}
+
+		// Grow the match backwards into bytes not yet written, then forwards
+		for offset > 0 && i > pending && base[offset-1] == target[i-1] {
+			offset--
+			i--
+		}
+
+		length := 0
+		for offset+length < len(base) && i+length < len(target) && base[offset+length] == target[i+length] {
+			length++
+		}
+
+		delta = appendDeltaInsert(delta, target[pending:i])
+		delta = appendDeltaCopy(delta, offset, length)
+
+		i += length
+		pending = i
+
+		if len(delta) > maxSize {
+			return nil
+		}
+	}
+
+	delta = appendDeltaInsert(delta, target[pending:])
+	if len(delta) > maxSize {
+		return nil
+	}
+
+	return delta
+}
+
+func appendDeltaSize(delta []byte, size uint64) []byte {
+	for size >= 0x80 {
+		delta = append(delta, byte(size)|0x80)
+		size >>= 7
+	}
+	return append(delta, byte(size))
+}
+
+func appendDeltaInsert(delta []byte, data []byte) []byte {
+	for len(data) > 0 {
+		n := min(len(data), 0x7f)
+		delta = append(delta, byte(n))
+		delta = append(delta, data[:n]...)
+		data = data[n:]
+	}
+	return delta
+}
+
+func appendDeltaCopy(delta []byte, offset, length int) []byte {
+	for length > 0 {
+		n := min(length, maxCopySize)
+
+		op := byte(0x80)
+		args := []byte{}
+		for i := 0; i < 4; i++ {
+			if b := byte(offset >> (8 * i)); b != 0 {
+				op |= 1 << i
+				args = append(args, b)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if b := byte(n >> (8 * i)); b != 0 {
+				op |= 1 << (4 + i)
+				args = append(args, b)
+			}
+		}
+
+		delta = append(delta, op)
+		delta = append(delta, args...)
+
+		offset += n
+		length -= n
+	}
+	return delta
+}
+
+func readDeltaSize(delta []byte) (uint64, []byte, error) {
+	var size uint64
+	for shift := 0; ; shift += 7 {
+		if len(delta) == 0 || shift > 63 {
+			return 0, nil, errors.New("truncated delta size")
+		}
+
+		b := delta[0]
+		delta = delta[1:]
+		size |= uint64(b&0x7f) << shift
+
+		if b&0x80 == 0 {
+			return size, delta, nil
+		}
+	}
+}
+
+// applyDelta rebuilds the target a delta describes from its base.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	if baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("delta expects a %d byte base but got %d", baseSize, len(base))
+	}
+
+	targetSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	target := make([]byte, 0, targetSize)
+
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		switch {
+		case op&0x80 != 0:
+			var offset, length uint64
+			for i := 0; i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta copy")
+				}
+
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					length |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+
+			if length == 0 {
+				length = 0x10000
+			}
+
+			if offset+length > uint64(len(base)) {
+				return nil, errors.New("delta copies past the end of its base")
+			}
+			target = append(target, base[offset:offset+length]...)
+		case op != 0:
+			if int(op) > len(delta) {
+				return nil, errors.New("truncated delta insert")
+			}
+			target = append(target, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errors.New("invalid delta instruction")
+		}
+	}
+
+	if uint64(len(target)) != targetSize {
+		return nil, fmt.Errorf("delta produced %d bytes but promised %d", len(target), targetSize)
+	}
+
+	return target, nil
+}
+
+// packObject is an object on its way into a pack.
+type packObject struct {
+	Id      id
+	Type    objectType
+	Name    string
+	Content []byte
+
+	// base is the object this one is stored as a delta against, if any
+	base  *packObject
+	delta []byte
+	depth int
+}
+
+// chooseDeltas sorts the objects so similar ones sit together, by type,
+// then by file name and then from largest to smallest, and looks back over
+// a sliding window for the base giving each object its smallest delta.
+// Bases always come before the objects stored against them.
+func chooseDeltas(objects []*packObject) int {
+	slices.SortStableFunc(objects, func(a, b *packObject) int {
+		if c := strings.Compare(a.Type, b.Type); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return len(b.Content) - len(a.Content)
+	})
+
+	deltas := 0
+
+	for i, obj := range objects {
+		// A delta is only worth it when it is well under the object's size
+		best := len(obj.Content) / 2
+
+		for j := max(0, i-deltaWindow); j < i; j++ {
+			base := objects[j]
+			if base.Type != obj.Type || base.depth >= maxDeltaDepth || len(base.Content) == 0 {
+				continue
+			}
+
+			if delta := makeDelta(base.Content, obj.Content, best-1); delta != nil {
+				obj.base, obj.delta, obj.depth = base, delta, base.depth+1
+				best = len(delta)
+			}
+		}
+
+		if obj.base != nil {
+			deltas++
+		}
+	}
+
+	return deltas
+}
@@ -0,0 +1,160 @@
+package got
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	base := make([]byte, 100000)
+	rng.Read(base)
+
+	target := append([]byte{}, base[:40000]...)
+	target = append(target, []byte("an insertion in the middle")...)
+	target = append(target, base[40100:]...)
+	target = append(target, base[:5000]...)
+
+	delta := makeDelta(base, target, len(target))
+	if delta == nil {
+		t.Fatal("similar content should produce a delta")
+	}
+
+	if len(delta) > 200 {
+		t.Fatalf("delta for a small edit should be small but is %d bytes", len(delta))
+	}
+
+	rebuilt, err := applyDelta(base, delta)
+	if err != nil {
+		t.Fatalf("could not apply delta: %s", err)
+	}
+
+	if !bytes.Equal(rebuilt, target) {
+		t.Fatal("applying the delta should rebuild the target")
+	}
+
+	unrelated := make([]byte, 1000)
+	rng.Read(unrelated)
+	if makeDelta(base, unrelated, len(unrelated)/2) != nil {
+		t.Fatal("unrelated content should not produce a delta under the limit")
+	}
+
+	if _, err = applyDelta(base[1:], delta); err == nil {
+		t.Fatal("applying a delta to the wrong base should fail")
+	}
+
+	for _, distance := range []uint64{1, 127, 128, 16511, 16512, 1 << 40} {
+		encoded := appendOffsetDistance(nil, distance)
+		decoded, err := readOffsetDistance(bufio.NewReader(bytes.NewReader(encoded)))
+		if err != nil || decoded != distance {
+			t.Fatalf("offset distance %d decoded as %d (%v)", distance, decoded, err)
+		}
+	}
+}
+
+func TestRepackWithDeltas(t *testing.T) {
+	initTestRepo(t)
+
+	lines := make([]string, 2000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d of a large file that changes a little each commit", i)
+	}
+
+	versions := []string{}
+	for i := 0; i < 5; i++ {
+		lines[i*100] = fmt.Sprintf("edited in version %d", i)
+		version := strings.Join(lines, "\n")
+		versions = append(versions, version)
+
+		writeTestFile(t, "large.txt", version)
+		commitTestFiles(t, fmt.Sprintf("version %d", i), "large.txt")
+	}
+
+	result, err := Repack()
+	if err != nil {
+		t.Fatalf("could not repack: %s", err)
+	}
+
+	if result.Deltas < len(versions)-1 {
+		t.Fatalf("at least %d objects should be stored as deltas, got %d", len(versions)-1, result.Deltas)
+	}
+
+	info, err := os.Stat(result.Pack)
+	if err != nil {
+		t.Fatalf("could not stat pack: %s", err)
+	}
+
+	compressed, err := deflate([]byte(versions[0]))
+	if err != nil {
+		t.Fatalf("could not compress: %s", err)
+	}
+
+	if info.Size() > int64(len(compressed))*2 {
+		t.Fatalf("pack of %d bytes should be far smaller than %d full copies of %d bytes", info.Size(), len(versions), len(compressed))
+	}
+
+	for i, version := range versions {
+		rev := fmt.Sprintf("HEAD~%d:large.txt", len(versions)-1-i)
+		content, err := readBlob(mustResolve(t, rev))
+		if err != nil {
+			t.Fatalf("could not read %s: %s", rev, err)
+		}
+
+		if string(content) != version {
+			t.Fatalf("%s should rebuild version %d", rev, i)
+		}
+	}
+
+	fsck, err := Fsck()
+	if err != nil || len(fsck.Problems) > 0 {
+		t.Fatalf("repacked repository should pass fsck: %v %v", err, fsck)
+	}
+}
+
+func TestIndexPack(t *testing.T) {
+	initTestRepo(t)
+
+	base := strings.Repeat("a line that every version shares\n", 100)
+	ids := []id{}
+	for i := 0; i < 3; i++ {
+		blobId, err := HashObject(strings.NewReader(base+fmt.Sprintf("version %d\n", i)), BLOB, true)
+		if err != nil {
+			t.Fatalf("could not write object: %s", err)
+		}
+		ids = append(ids, blobId)
+	}
+
+	pack, err := encodePack(ids, nil)
+	if err != nil {
+		t.Fatalf("could not encode pack: %s", err)
+	}
+	if pack.deltas == 0 {
+		t.Fatalf("the versions should be stored as deltas")
+	}
+
+	offsets, err := indexPack(pack.data)
+	if err != nil {
+		t.Fatalf("could not index pack: %s", err)
+	}
+
+	if len(offsets) != len(pack.offsets) {
+		t.Fatalf("indexing found %d objects, want %d", len(offsets), len(pack.offsets))
+	}
+	for objId, offset := range pack.offsets {
+		if offsets[objId] != offset {
+			t.Errorf("%s should be at offset %d, got %d", objId, offset, offsets[objId])
+		}
+	}
+
+	corrupt := append([]byte{}, pack.data...)
+	corrupt[20] ^= 0xff
+	if _, err = indexPack(corrupt); err == nil {
+		t.Errorf("a pack with a bad checksum should be refused")
+	}
+}
@@ -0,0 +1,156 @@
+package got
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+)
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+// diffEdit is one line of an edit script. Equal lines carry both line
+// numbers, deleted lines only Old and inserted lines only New; the other
+// is -1.
+type diffEdit struct {
+	Op  diffOp
+	Old int
+	New int
+}
+
+// splitLines splits content into lines that keep their trailing newline,
+// so joining them gives back the content exactly.
+func splitLines(content []byte) []string {
+	lines := []string{}
+	for len(content) > 0 {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 {
+			lines = append(lines, string(content))
+			break
+		}
+		lines = append(lines, string(content[:i+1]))
+		content = content[i+1:]
+	}
+	return lines
+}
+
+// diffLines returns a shortest edit script turning a into b, using Myers'
+// O(ND) algorithm.
+func diffLines(a, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+
+	v := make([]int, 2*maxD+3)
+
+	// Step d only reaches diagonals -d to d, so backtracking from it needs
+	// no more of v than the band of diagonals -(d+1) to d+1 it started
+	// with. Keeping just that band holds the trace to O(D*D) rather than
+	// O((N+M)*D).
+	trace := [][]int{}
+
+	found := false
+	for d := 0; d <= maxD && !found; d++ {
+		trace = append(trace, slices.Clone(v[offset-d-1:offset+d+2]))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	edits := []diffEdit{}
+	x, y := n, m
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		band, bandOffset := trace[d], d+1
+		k := x - y
+
+		var prevK int
+		if k == -d || k != d && band[bandOffset+k-1] < band[bandOffset+k+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := band[bandOffset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, diffEdit{Op: diffEqual, Old: x, New: y})
+		}
+
+		if d == 0 {
+			break
+		}
+
+		if x == prevX {
+			y--
+			edits = append(edits, diffEdit{Op: diffInsert, Old: -1, New: y})
+		} else {
+			x--
+			edits = append(edits, diffEdit{Op: diffDelete, Old: x, New: -1})
+		}
+	}
+
+	slices.Reverse(edits)
+	return edits
+}
+
+// FileChange is a file that differs between two trees.
+type FileChange struct {
+	Status status
+	Name   filePath
+}
+
+// diffTrees lists the files added, modified and deleted going from the
+// files in a to those in b, sorted by path.
+func diffTrees(a, b map[filePath]TreeEntry) []FileChange {
+	changes := []FileChange{}
+
+	for name, entry := range b {
+		before, ok := a[name]
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Status: STATUS_ADD, Name: name})
+		case !sameEntry(before, entry):
+			changes = append(changes, FileChange{Status: STATUS_MODIFY, Name: name})
+		}
+	}
+
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			changes = append(changes, FileChange{Status: STATUS_DELETE, Name: name})
+		}
+	}
+
+	slices.SortFunc(changes, func(x, y FileChange) int {
+		return strings.Compare(x.Name, y.Name)
+	})
+
+	return changes
+}
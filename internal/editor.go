@@ -0,0 +1,211 @@
+package got
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const CommitEditMsgFile = "COMMIT_EDITMSG"
+
+// runEditor opens path in the command held by the first of the environment
+// variables that is set. The command goes through the shell, so it may
+// carry its own arguments. It reports false when none of them is set.
+func runEditor(path string, vars ...string) (bool, error) {
+	for _, v := range vars {
+		command := os.Getenv(v)
+		if command == "" {
+			continue
+		}
+
+		cmd := exec.Command("sh", "-c", command+` "$@"`, command, path)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return true, fmt.Errorf("editor %q failed: %w", command, err)
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// editMessage lets the user edit a commit message in $GOT_EDITOR or
+// $EDITOR, with help shown as comment lines beneath it. Comment lines and
+// surrounding blank lines are dropped from the result. It reports false,
+// returning the message untouched, when no editor is set.
+func editMessage(message string, help []string) (string, bool, error) {
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return "", false, fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	content := strings.TrimRight(message, "\n") + "\n\n"
+	for _, line := range help {
+		content += strings.TrimRight("# "+line, " ") + "\n"
+	}
+
+	path := filepath.Join(repoPath, CommitEditMsgFile)
+	if err = os.WriteFile(path, []byte(content), 0666); err != nil {
+		return "", false, fmt.Errorf("could not write commit message file: %w", err)
+	}
+
+	edited, err := runEditor(path, "GOT_EDITOR", "EDITOR")
+	if err != nil || !edited {
+		return message, edited, err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", true, fmt.Errorf("could not read commit message file: %w", err)
+	}
+
+	return stripComments(string(b)), true, nil
+}
+
+// stripComments drops the lines starting with # and trims blank lines and
+// trailing space.
+func stripComments(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+var commitChangeLabels = map[status]string{
+	STATUS_ADD:    "new file:",
+	STATUS_MODIFY: "modified:",
+	STATUS_DELETE: "deleted:",
+}
+
+// EditCommitMessage has the user write the message for the next commit in
+// $GOT_EDITOR or $EDITOR. The file starts with message, or with the
+// configured commit template when there is none, above comment lines
+// summarising what will be committed. When amending, an empty message
+// starts from the message of the commit being replaced.
+func (i *Index) EditCommitMessage(message string, amend bool) (string, error) {
+	headRef, headId, err := readHead()
+	if err != nil {
+		return "", err
+	}
+
+	base := headId
+	if amend {
+		if headId == "" {
+			return "", errors.New("there is no commit to amend")
+		}
+
+		head, err := readCommit(headId)
+		if err != nil {
+			return "", err
+		}
+
+		if message == "" {
+			message = head.Message
+		}
+
+		base = ""
+		if len(head.Parents) > 0 {
+			base = head.Parents[0]
+		}
+	}
+
+	if message == "" {
+		if message, err = readCommitTemplate(); err != nil {
+			return "", err
+		}
+	}
+
+	before, err := commitFiles(base)
+	if err != nil {
+		return "", err
+	}
+
+	files, err := i.Snapshot()
+	if err != nil {
+		return "", err
+	}
+
+	help := []string{
+		"Please enter the commit message for your changes. Lines starting",
+		"with '#' will be ignored, and an empty message aborts the commit.",
+		"",
+	}
+
+	if headRef != "" {
+		help = append(help, "On branch "+strings.TrimPrefix(headRef, RefsDir+"/"+RefHeadsDir+"/"))
+	} else {
+		help = append(help, "HEAD detached at "+FindUniqueAbbrev(headId))
+	}
+
+	if changes := diffTrees(before, files); len(changes) == 0 {
+		help = append(help, "No changes")
+	} else {
+		help = append(help, "Changes to be committed:")
+		for _, change := range changes {
+			help = append(help, fmt.Sprintf("\t%-12s%s", commitChangeLabels[change.Status], change.Name))
+		}
+	}
+
+	message, edited, err := editMessage(message, help)
+	if err != nil {
+		return "", err
+	}
+
+	if !edited {
+		return "", errors.New("no commit message given; use -m or -F, or set $GOT_EDITOR or $EDITOR")
+	}
+
+	if message == "" {
+		return "", errors.New("aborting commit due to empty commit message")
+	}
+
+	return message, nil
+}
+
+// readCommitTemplate returns the content of the configured commit template,
+// or nothing when there is none. A relative path is taken from the top of
+// the working tree and a leading ~/ from the home directory.
+func readCommitTemplate() (string, error) {
+	config, err := GetConfig()
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if config.Commit.Template == "" {
+		return "", nil
+	}
+
+	path := config.Commit.Template
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, rest)
+	} else if !filepath.IsAbs(path) {
+		repoPath, err := getRepoPath()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(filepath.Dir(repoPath), path)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read commit template: %w", err)
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,185 @@
+package got
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"slices"
+)
+
+// FsckResult lists what Fsck found. Problems are corrupt objects, broken
+// links between objects and refs that point at something invalid. Dangling
+// objects are unreachable and unreferenced, which is not an error.
+type FsckResult struct {
+	Problems []string
+	Dangling []string
+}
+
+// Fsck checks the integrity of every object and ref in the repository.
+func Fsck() (*FsckResult, error) {
+	result := &FsckResult{Problems: []string{}, Dangling: []string{}}
+
+	ids, err := allObjectIds()
+	if err != nil {
+		return nil, fmt.Errorf("could not list objects: %w", err)
+	}
+
+	types := map[id]objectType{}
+	links := map[id][]objectLink{}
+
+	for _, objId := range ids {
+		t, objLinks, problem := checkObject(objId)
+		if problem != "" {
+			result.Problems = append(result.Problems, fmt.Sprintf("corrupt object %s: %s", objId, problem))
+			continue
+		}
+
+		types[objId] = t
+		links[objId] = objLinks
+	}
+
+	referenced := map[id]bool{}
+	for objId, objLinks := range links {
+		for _, link := range objLinks {
+			referenced[link.Id] = true
+
+			t, ok := types[link.Id]
+			switch {
+			case !ok:
+				result.Problems = append(result.Problems, fmt.Sprintf("broken link from %s %s to missing %s %s", types[objId], objId, link.Type, link.Id))
+			case t != link.Type:
+				result.Problems = append(result.Problems, fmt.Sprintf("broken link from %s %s to %s %s, which is a %s", types[objId], objId, link.Type, link.Id, t))
+			}
+		}
+	}
+
+	roots, problems, err := fsckRoots(types)
+	if err != nil {
+		return nil, err
+	}
+	result.Problems = append(result.Problems, problems...)
+
+	reachable := map[id]bool{}
+	pending := roots
+	for len(pending) > 0 {
+		objId := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if reachable[objId] {
+			continue
+		}
+		reachable[objId] = true
+
+		for _, link := range links[objId] {
+			pending = append(pending, link.Id)
+		}
+	}
+
+	for objId, t := range types {
+		if !reachable[objId] && !referenced[objId] {
+			result.Dangling = append(result.Dangling, fmt.Sprintf("dangling %s %s", t, objId))
+		}
+	}
+
+	slices.Sort(result.Problems)
+	slices.Sort(result.Dangling)
+
+	return result, nil
+}
+
+// checkObject decompresses and parses an object, checking that its content
+// hashes to its id. A non-empty problem describes why it is corrupt.
+func checkObject(objId id) (t objectType, links []objectLink, problem string) {
+	data, err := readObjectData(objId)
+	if err != nil {
+		return "", nil, err.Error()
+	}
+
+	sum := sha1.Sum(data)
+	if actual := hex.EncodeToString(sum[:]); actual != objId {
+		return "", nil, fmt.Sprintf("content hashes to %s", actual)
+	}
+
+	t, content, err := parseObject(data)
+	if err != nil {
+		return "", nil, err.Error()
+	}
+
+	if !IsObjectType(t) {
+		return "", nil, fmt.Sprintf("unknown object type %q", t)
+	}
+
+	if t == COMMIT {
+		if _, err = readCommit(objId); err != nil {
+			return "", nil, err.Error()
+		}
+	}
+
+	if links, err = objectLinks(t, content); err != nil {
+		return "", nil, err.Error()
+	}
+
+	return t, links, ""
+}
+
+// fsckRoots checks that HEAD and every ref point at valid commits and
+// returns them, along with staged blobs and reflog entries, as the roots of
+// reachability.
+func fsckRoots(types map[id]objectType) (roots []id, problems []string, err error) {
+	refs, err := listRefs()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list refs: %w", err)
+	}
+
+	headRef, head, err := readHead()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if headRef == "" || head != "" {
+		refs[HeadFile] = head
+	}
+
+	for name, objId := range refs {
+		t, ok := types[objId]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s points at missing object %q", name, objId))
+		case t != COMMIT:
+			problems = append(problems, fmt.Sprintf("%s points at a %s, not a commit", name, t))
+		default:
+			roots = append(roots, objId)
+		}
+	}
+
+	logged, err := reflogIds()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read reflogs: %w", err)
+	}
+
+	for _, objId := range logged {
+		if _, ok := types[objId]; ok {
+			roots = append(roots, objId)
+		}
+	}
+
+	index, err := GetIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, entry := range index.Entries() {
+		if entry.Status == STATUS_DELETE {
+			continue
+		}
+
+		if _, ok := types[entry.Id]; !ok {
+			problems = append(problems, fmt.Sprintf("index entry %s points at missing blob %s", entry.Name, entry.Id))
+			continue
+		}
+
+		roots = append(roots, entry.Id)
+	}
+
+	return roots, problems, nil
+}
@@ -0,0 +1,72 @@
+package got
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFsck(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a")
+	writeTestFile(t, "src/b.txt", "b")
+	commitTestFiles(t, "one", ".")
+
+	result, err := Fsck()
+	if err != nil {
+		t.Fatalf("could not run fsck: %s", err)
+	}
+
+	if len(result.Problems) != 0 || len(result.Dangling) != 0 {
+		t.Fatalf("fresh repository should be clean, got %v and %v", result.Problems, result.Dangling)
+	}
+
+	dangling, err := HashObject(strings.NewReader("nobody points at me"), BLOB, true)
+	if err != nil {
+		t.Fatalf("could not write object: %s", err)
+	}
+
+	// Corrupt the blob a.txt points at and remove the subtree for src
+	blob := mustResolve(t, "HEAD:a.txt")
+	if err = os.WriteFile(filepath.Join(Repo, ObjectsDir, blob[:2], blob[2:]), []byte("garbage"), 0666); err != nil {
+		t.Fatalf("could not corrupt object: %s", err)
+	}
+
+	subtree := mustResolve(t, "HEAD:src")
+	if err = os.Remove(filepath.Join(Repo, ObjectsDir, subtree[:2], subtree[2:])); err != nil {
+		t.Fatalf("could not remove object: %s", err)
+	}
+
+	result, err = Fsck()
+	if err != nil {
+		t.Fatalf("could not run fsck: %s", err)
+	}
+
+	problems := strings.Join(result.Problems, "\n")
+	for _, want := range []string{"corrupt object " + blob, "to missing tree " + subtree} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("problems should mention %q:\n%s", want, problems)
+		}
+	}
+
+	// b.txt is only referenced by the missing subtree, so it dangles too
+	danglingObjects := strings.Join(result.Dangling, "\n")
+	for _, want := range []string{dangling, mustResolveBlob(t, "src/b.txt")} {
+		if !strings.Contains(danglingObjects, want) {
+			t.Errorf("%s should be dangling, got %v", want, result.Dangling)
+		}
+	}
+}
+
+func mustResolveBlob(t *testing.T, name string) id {
+	t.Helper()
+
+	blobId, _, err := formatHexId(name, BLOB)
+	if err != nil {
+		t.Fatalf("could not hash %s: %s", name, err)
+	}
+
+	return blobId
+}
@@ -0,0 +1,118 @@
+package got
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// PruneResult lists the unreachable objects that were (or, for a dry run,
+// would be) deleted and the bytes they took up.
+type PruneResult struct {
+	Removed []id
+	Bytes   int64
+}
+
+// Prune deletes loose objects that cannot be reached from any ref, HEAD,
+// the index or a reflog and that are older than grace, so objects written
+// or written again by a command still in progress survive. Nothing is
+// deleted when dryRun is set.
+func Prune(grace time.Duration, dryRun bool) (*PruneResult, error) {
+	roots, err := reachabilityRoots()
+	if err != nil {
+		return nil, err
+	}
+
+	reachable, err := reachableObjects(roots)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to prune a damaged repository: %w", err)
+	}
+
+	ids, err := looseObjectIds()
+	if err != nil {
+		return nil, fmt.Errorf("could not list objects: %w", err)
+	}
+
+	objectDb, err := getObjectsDirPath()
+	if err != nil {
+		return nil, fmt.Errorf("could not get object directory path: %w", err)
+	}
+
+	result := &PruneResult{Removed: []id{}}
+	cutoff := time.Now().Add(-grace)
+
+	for _, objId := range ids {
+		if _, ok := reachable[objId]; ok {
+			continue
+		}
+
+		path := filepath.Join(objectDb, objId[:2], objId[2:])
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.ModTime().After(cutoff) {
+			continue
+		}
+
+		result.Removed = append(result.Removed, objId)
+		result.Bytes += info.Size()
+
+		if dryRun {
+			continue
+		}
+
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("could not remove object %s: %w", objId, err)
+		}
+
+		// Only succeeds once the fan-out directory is empty
+		os.Remove(filepath.Dir(path))
+	}
+
+	slices.Sort(result.Removed)
+
+	return result, nil
+}
+
+// reachabilityRoots returns the ids every live object can be reached from:
+// refs, HEAD, staged blobs and everything recorded in the reflogs.
+func reachabilityRoots() ([]id, error) {
+	roots := []id{}
+
+	refs, err := listRefs()
+	if err != nil {
+		return nil, fmt.Errorf("could not list refs: %w", err)
+	}
+
+	for _, objId := range refs {
+		roots = append(roots, objId)
+	}
+
+	_, head, err := readHead()
+	if err != nil {
+		return nil, err
+	}
+	roots = append(roots, head)
+
+	index, err := GetIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range index.Entries() {
+		if entry.Status != STATUS_DELETE {
+			roots = append(roots, entry.Id)
+		}
+	}
+
+	logged, err := reflogIds()
+	if err != nil {
+		return nil, fmt.Errorf("could not read reflogs: %w", err)
+	}
+
+	return append(roots, logged...), nil
+}
@@ -0,0 +1,100 @@
+package got
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "first")
+	index, err := GetIndex()
+	if err != nil {
+		t.Fatalf("could not get index: %s", err)
+	}
+	if err = index.UpdateOrAddEntry("a.txt"); err != nil {
+		t.Fatalf("could not add a.txt: %s", err)
+	}
+	superseded := mustResolveBlob(t, "a.txt")
+
+	writeTestFile(t, "a.txt", "second")
+	commitTestFiles(t, "one", "a.txt")
+
+	fresh, err := HashObject(strings.NewReader("just written"), BLOB, true)
+	if err != nil {
+		t.Fatalf("could not write object: %s", err)
+	}
+
+	// Age every object so only the fresh one is inside the grace period
+	old := time.Now().Add(-time.Hour)
+	ids, err := allObjectIds()
+	if err != nil {
+		t.Fatalf("could not list objects: %s", err)
+	}
+	for _, objId := range ids {
+		if objId != fresh {
+			os.Chtimes(filepath.Join(Repo, ObjectsDir, objId[:2], objId[2:]), old, old)
+		}
+	}
+
+	result, err := Prune(time.Minute, true)
+	if err != nil {
+		t.Fatalf("could not prune: %s", err)
+	}
+
+	if want := []id{superseded}; !slices.Equal(result.Removed, want) {
+		t.Fatalf("prune should remove %v but would remove %v", want, result.Removed)
+	}
+
+	if result.Bytes == 0 {
+		t.Fatal("prune should report the bytes reclaimed")
+	}
+
+	if _, _, err = ReadObject(superseded); err != nil {
+		t.Fatalf("dry run should not delete %s: %s", superseded, err)
+	}
+
+	if _, err = Prune(time.Minute, false); err != nil {
+		t.Fatalf("could not prune: %s", err)
+	}
+
+	if _, _, err = ReadObject(superseded); err == nil {
+		t.Fatalf("%s should have been pruned", superseded)
+	}
+
+	for _, rev := range []string{"HEAD", "HEAD:a.txt", fresh} {
+		if _, _, err = ReadObject(mustResolve(t, rev)); err != nil {
+			t.Fatalf("%s should survive pruning: %s", rev, err)
+		}
+	}
+}
+
+func TestPruneRewrittenObject(t *testing.T) {
+	initTestRepo(t)
+
+	blob, err := HashObject(strings.NewReader("written twice"), BLOB, true)
+	if err != nil {
+		t.Fatalf("could not write object: %s", err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(Repo, ObjectsDir, blob[:2], blob[2:]), old, old)
+
+	// Writing it again is as good as writing it for the first time
+	if _, err = HashObject(strings.NewReader("written twice"), BLOB, true); err != nil {
+		t.Fatalf("could not write object: %s", err)
+	}
+
+	result, err := Prune(time.Minute, true)
+	if err != nil {
+		t.Fatalf("could not prune: %s", err)
+	}
+	if len(result.Removed) != 0 {
+		t.Fatalf("an object written again should be inside the grace period, but prune would remove %v", result.Removed)
+	}
+}
@@ -8,10 +8,12 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -34,8 +36,15 @@ type user struct {
 	Email string
 }
 
+type commitConfig struct {
+	// Template is the path of a file whose content starts the message when
+	// a commit message is written in the editor.
+	Template string
+}
+
 type Config struct {
-	User user
+	User   user
+	Commit commitConfig
 }
 
 type GotObject interface {
@@ -57,12 +66,14 @@ type Tree struct {
 
 type Commit struct {
 	object
-	Author    string
-	CreatedAt time.Time
-	Message   string
-	Parent    id
-	Tree      id
-	Entries   map[filePath]id
+	Author     string
+	AuthoredAt time.Time
+	Committer  string
+	CreatedAt  time.Time
+	Message    string
+	Parents    []id
+	Tree       id
+	Entries    map[filePath]id
 }
 
 func (o object) HexId() string {
@@ -73,64 +84,20 @@ type commitBuilder struct {
 	commit *Commit
 }
 
-func (cb *commitBuilder) entries(entries []indexEntry) error {
-	cb.commit.Entries = make(map[filePath]id, len(entries))
-
-	entryNamesForTree := make([]string, 0, len(entries))
-
-	for i, entry := range entries {
-		cb.commit.Entries[entry.Name] = entry.Id
-		entryNamesForTree[i] = entry.Name
-	}
-
-	slices.Sort(entryNamesForTree)
+func (cb *commitBuilder) entries(files map[filePath]TreeEntry) error {
+	cb.commit.Entries = make(map[filePath]id, len(files))
 
-	var tree string
-
-	for _, name := range entryNamesForTree {
-		id, objectType := WriteObject(name)
-		tree += fmt.Sprintf("%v %v %v %v\n", 100644, objectType, id, name)
+	for name, entry := range files {
+		cb.commit.Entries[name] = entry.Id
 	}
 
-	treeId, treeString, err := formatHexId(tree, TREE)
+	treeId, err := buildTree(files)
 	if err != nil {
 		return err
 	}
 
 	cb.commit.Tree = treeId
 
-	objectDb, err := getObjectsDirPath()
-	if err != nil {
-		return fmt.Errorf("could not get object directory path: %w", err)
-	}
-
-	objDir := filepath.Join(objectDb, treeId[:2])
-	objFile := filepath.Join(objDir, treeId[2:])
-
-	if err = os.MkdirAll(objDir, 0700); err != nil {
-		return err
-	}
-
-	file, err := os.Create(objFile)
-	if err != nil {
-		return err
-	}
-
-	defer file.Close()
-
-	var b bytes.Buffer
-	compressor := zlib.NewWriter(&b)
-
-	if _, err = compressor.Write([]byte(treeString)); err != nil {
-		return err
-	}
-
-	compressor.Close()
-
-	if err = os.WriteFile(objFile, b.Bytes(), 0700); err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -138,88 +105,69 @@ func (cb *commitBuilder) message(msg string) {
 	cb.commit.Message = msg
 }
 
-func (cb *commitBuilder) setParent() error {
-	headFile, err := getHeadPath()
-	if err != nil {
-		return fmt.Errorf("could not get head path: %w", err)
-	}
+func (cb *commitBuilder) tree(treeId id) {
+	cb.commit.Tree = treeId
+}
 
-	headRef, err := os.ReadFile(headFile)
-	if err != nil {
-		return err
-	}
+func (cb *commitBuilder) parents(ids ...id) {
+	cb.commit.Parents = ids
+}
 
-	ref := strings.Split(string(headRef), ":")
-	pathBits := strings.Split(strings.TrimSpace(ref[1]), "/")
+func (cb *commitBuilder) author(author string, at time.Time) {
+	cb.commit.Author = author
+	cb.commit.AuthoredAt = at
+}
 
-	repo, err := getRepoPath()
+func (cb *commitBuilder) setParent() error {
+	_, head, err := readHead()
 	if err != nil {
-		return fmt.Errorf("could not get repo path: %w", err)
-	}
-	pathToRef := append([]string{repo}, pathBits...)
-	path := filepath.Join(pathToRef...)
-
-	if _, err = os.Stat(path); err != nil {
 		return err
 	}
 
-	contents, err := os.ReadFile(path)
-	if err != nil {
-		return err
+	cb.commit.Parents = nil
+	if head != "" {
+		cb.commit.Parents = []id{head}
 	}
-
-	cb.commit.Parent = string(contents)
 	return nil
 }
 
 func (cb *commitBuilder) build() (*Commit, error) {
-	var parentListing string
+	data := fmt.Sprintf("tree %v\n", cb.commit.Tree)
 
-	if cb.commit.Parent != "" {
-		parentListing = fmt.Sprintf("parent %v", cb.commit.Parent)
+	for _, parent := range cb.commit.Parents {
+		data += fmt.Sprintf("parent %v\n", parent)
 	}
 
-	committer := "ljpurcell" // TODO: work on Got config
-
-	data := fmt.Sprintf("tree %v\n%v\ncommiter %v\n\n%v", cb.commit.Tree, parentListing, committer, cb.commit.Message)
+	committer := getIdentity()
+	now := time.Now()
 
-	id, commitString, err := formatHexId(data, COMMIT)
-	if err != nil {
-		return nil, err
+	// The author is whoever wrote the change, which differs from whoever
+	// committed it when a commit is cherry-picked or rebased
+	author, authoredAt := cb.commit.Author, cb.commit.AuthoredAt
+	if author == "" {
+		author = committer
 	}
-
-	objectDb, err := getObjectsDirPath()
-	if err != nil {
-		return nil, fmt.Errorf("could not get object directory path: %w", err)
+	if authoredAt.IsZero() {
+		authoredAt = now
 	}
-	objDir := filepath.Join(objectDb, id[:2])
-	objFile := filepath.Join(objDir, id[2:])
 
-	if err = os.MkdirAll(objDir, 0700); err != nil {
-		return nil, err
-	}
+	data += fmt.Sprintf("author %v\ncommiter %v\n\n%v", formatSignature(author, authoredAt), formatSignature(committer, now), cb.commit.Message)
 
-	file, err := os.Create(objFile)
+	id, commitString, err := formatHexId(data, COMMIT)
 	if err != nil {
 		return nil, err
 	}
 
-	defer file.Close()
-
-	var b bytes.Buffer
-	compressor := zlib.NewWriter(&b)
-
-	if _, err = compressor.Write([]byte(commitString)); err != nil {
-		return nil, err
-	}
-
-	compressor.Close()
-
-	if err = os.WriteFile(objFile, b.Bytes(), 0700); err != nil {
+	if err = writeObjectData(id, commitString); err != nil {
 		return nil, err
 	}
 
-	fmt.Printf("Created commit %s", id)
+	cb.commit.Id = id
+	cb.commit.Type = COMMIT
+	cb.commit.Author = author
+	cb.commit.AuthoredAt = authoredAt
+	cb.commit.Committer = committer
+	cb.commit.CreatedAt = now
 
 	return cb.commit, nil
 }
@@ -231,7 +179,11 @@ func newCommitBuilder() *commitBuilder {
 }
 
 func GetConfig() (Config, error) {
-	configPath, err := getConfigPath()
+	return workingRepo.getConfig()
+}
+
+func (r *repository) getConfig() (Config, error) {
+	configPath, err := r.path(ConfigFile)
 	if err != nil {
 		return Config{}, fmt.Errorf("could not get config path: %w", err)
 	}
@@ -240,14 +192,16 @@ func GetConfig() (Config, error) {
 	if err != nil {
 		return Config{}, fmt.Errorf("could not open config file: %w", err)
 	}
+	defer configFile.Close()
 
 	c := Config{User: user{}}
 
 	scanner := bufio.NewScanner(configFile)
 	for scanner.Scan() {
-		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		line := strings.TrimSpace(scanner.Text())
+		key := strings.ToLower(line)
 
-		if strings.HasPrefix(line, "name") {
+		if strings.HasPrefix(key, "name") {
 			v, err := getValueFromConfigLine(line)
 			if err != nil {
 				return Config{}, fmt.Errorf("could not parse name in config file: %w", err)
@@ -255,7 +209,7 @@ func GetConfig() (Config, error) {
 			c.User.Name = v
 		}
 
-		if strings.HasPrefix(line, "email") {
+		if strings.HasPrefix(key, "email") {
 			v, err := getValueFromConfigLine(line)
 			if err != nil {
 				return Config{}, fmt.Errorf("could not parse email in config file: %w", err)
@@ -263,13 +217,70 @@ func GetConfig() (Config, error) {
 			c.User.Email = v
 		}
 
+		if strings.HasPrefix(key, "template") {
+			v, err := getValueFromConfigLine(line)
+			if err != nil {
+				return Config{}, fmt.Errorf("could not parse template in config file: %w", err)
+			}
+			c.Commit.Template = v
+		}
+
 	}
 
 	return c, nil
 }
 
+// getIdentity returns the "Name <email>" of the configured user, falling
+// back to placeholders when the config does not say.
+func getIdentity() string {
+	return workingRepo.getIdentity()
+}
+
+func (r *repository) getIdentity() string {
+	name, email := "unknown", "unknown"
+
+	if config, err := r.getConfig(); err == nil {
+		if config.User.Name != "" {
+			name = config.User.Name
+		}
+		if config.User.Email != "" {
+			email = config.User.Email
+		}
+	}
+
+	return fmt.Sprintf("%s <%s>", name, email)
+}
+
+// formatSignature stamps an identity with a time, as the seconds since the
+// epoch and the zone offset.
+func formatSignature(identity string, at time.Time) string {
+	return fmt.Sprintf("%s %d %s", identity, at.Unix(), at.Format("-0700"))
+}
+
+// parseSignature splits a stamped identity back into the identity and time.
+// The identity may contain spaces, so the time is taken from the end. When
+// there is no time the whole value is the identity and ok is false.
+func parseSignature(value string) (identity string, at time.Time, ok bool) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return value, time.Time{}, false
+	}
+
+	unix, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	if err != nil {
+		return value, time.Time{}, false
+	}
+
+	zone, err := time.Parse("-0700", fields[len(fields)-1])
+	if err != nil {
+		return value, time.Time{}, false
+	}
+
+	return strings.Join(fields[:len(fields)-2], " "), time.Unix(unix, 0).In(zone.Location()), true
+}
+
 func getValueFromConfigLine(line string) (string, error) {
-	bits := strings.Split(line, "=")
+	bits := strings.SplitN(line, "=", 2)
 	if len(bits) != 2 {
 		return "", errors.New("incorrect format")
 	}
@@ -285,164 +296,424 @@ func newTree(id id) *Tree {
 }
 
 func Init(path filePath) error {
-	repoPath, err := getRepoPath()
-	if err != nil {
-		return fmt.Errorf("could not get repo path: %w", err)
-	}
+	repoPath := filepath.Join(path, Repo)
 	if _, err := os.Stat(repoPath); err == nil {
 		return fmt.Errorf("%s already exists", repoPath)
 	}
 
-	configPath, err := getConfigPath()
+	if err := initRepoDir(repoPath); err != nil {
+		return err
+	}
+
+	indexPath := filepath.Join(repoPath, IndexFile)
+	index, err := os.Create(indexPath)
 	if err != nil {
-		return fmt.Errorf("could not get config path: %w", err)
+		return fmt.Errorf("could not create index file: %w", err)
 	}
+	defer index.Close()
+
+	return nil
+}
 
-	if _, err := os.Stat(configPath); err == nil {
-		return fmt.Errorf("%s already exists", configPath)
+// InitBare creates a bare repository at path: the contents of a .got
+// directory with no working tree around them, for serving to clones and
+// taking pushes to any branch.
+func InitBare(path filePath) error {
+	if _, err := os.Stat(filepath.Join(path, HeadFile)); err == nil {
+		return fmt.Errorf("%s already holds a repository", path)
 	}
 
+	return initRepoDir(path)
+}
+
+// initRepoDir creates the objects and refs directories and a HEAD on main
+// in repoPath.
+func initRepoDir(repoPath filePath) error {
 	rw := fs.FileMode(0777)
 
-	headPath, err := getHeadPath()
-	if err != nil {
-		return fmt.Errorf("could not get head path: %w", err)
+	for _, dir := range []filePath{
+		repoPath,
+		filepath.Join(repoPath, ObjectsDir),
+		filepath.Join(repoPath, RefsDir, RefHeadsDir),
+	} {
+		if err := os.MkdirAll(dir, rw); err != nil {
+			return fmt.Errorf("could not create directory %s: %w", dir, err)
+		}
 	}
 
+	headPath := filepath.Join(repoPath, HeadFile)
 	if err := os.WriteFile(headPath, []byte("ref: refs/heads/main"), rw); err != nil {
 		return fmt.Errorf("could not write to HEAD file: %w", err)
 	}
 
-	refsDirPath, err := getRefsDirPath()
+	return nil
+}
+
+const (
+	// minAbbrev is the shortest prefix accepted when looking up an object.
+	minAbbrev = 4
+	// defaultAbbrev is the shortest abbreviation FindUniqueAbbrev returns.
+	defaultAbbrev = 7
+)
+
+var ErrAmbiguousId = errors.New("ambiguous object id")
+
+// GetObjectFile opens the loose object whose id is, or starts with, the
+// given id. A prefix matching more than one object is an error wrapping
+// ErrAmbiguousId that lists the candidates. Objects that only exist in a
+// pack have no file of their own; use ReadObject to read any object.
+func GetObjectFile(id id) (*os.File, error) {
+	return workingRepo.getObjectFile(id)
+}
+
+func (r *repository) getObjectFile(id id) (*os.File, error) {
+	ids, err := r.findLooseObjectIds(id)
 	if err != nil {
-		return fmt.Errorf("could not get refs directory path: %w", err)
+		return nil, err
 	}
 
-	if err := os.MkdirAll(refsDirPath, rw); err != nil {
-		return fmt.Errorf("could not create refs directory path: %w", err)
+	fullId, err := pickObjectId(id, ids)
+	if err != nil {
+		return nil, err
 	}
 
-	indexPath, err := getIndexPath()
+	objectDb, err := r.path(ObjectsDir)
 	if err != nil {
-		return fmt.Errorf("could not get index path: %w", err)
+		return nil, fmt.Errorf("could not get object directory path: %w", err)
 	}
 
-	index, err := os.Create(indexPath)
+	return os.Open(filepath.Join(objectDb, fullId[:2], fullId[2:]))
+}
+
+// expandObjectId returns the full id of the one object, loose or packed,
+// whose id starts with prefix.
+func expandObjectId(prefix string) (id, error) {
+	return workingRepo.expandObjectId(prefix)
+}
+
+func (r *repository) expandObjectId(prefix string) (id, error) {
+	ids, err := r.findObjectIds(prefix)
 	if err != nil {
-		return fmt.Errorf("could not create index file: %w", err)
+		return "", err
 	}
-	defer index.Close()
 
-	return nil
+	return pickObjectId(prefix, ids)
 }
 
-func GetObjectFile(id id) (*os.File, error) {
-	objectDb, err := getObjectsDirPath()
+func pickObjectId(prefix string, ids []id) (id, error) {
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("could not find object file for %q", prefix)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("%w %q matches %d objects:\n  %s", ErrAmbiguousId, prefix, len(ids), strings.Join(ids, "\n  "))
+	}
+}
+
+// findObjectIds returns the ids of every loose or packed object starting
+// with prefix.
+func findObjectIds(prefix string) ([]id, error) {
+	return workingRepo.findObjectIds(prefix)
+}
+
+func (r *repository) findObjectIds(prefix string) ([]id, error) {
+	ids, err := r.findLooseObjectIds(prefix)
 	if err != nil {
-		return nil, fmt.Errorf("could not get object directory path: %w", err)
+		return nil, err
 	}
-	objects, err := os.ReadDir(objectDb)
+
+	packs, err := r.loadPackIndexes()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, dir := range objects {
-		if dir.Name() == id[:2] {
-			dPath := filepath.Join(objectDb, dir.Name())
-			files, err := os.ReadDir(dPath)
-			if err != nil {
-				return nil, err
+	for _, pack := range packs {
+		for _, packed := range pack.findPrefix(prefix) {
+			if !slices.Contains(ids, packed) {
+				ids = append(ids, packed)
 			}
+		}
+	}
 
-			for _, file := range files {
-				if strings.HasPrefix(file.Name(), id[2:]) {
-					fPath := filepath.Join(dPath, file.Name())
-					return os.Open(fPath)
-				}
-			}
+	return ids, nil
+}
+
+// findLooseObjectIds returns the ids of every loose object starting with
+// prefix. A full id is checked directly, and a prefix only reads the one
+// fan-out directory it could live in.
+func (r *repository) findLooseObjectIds(prefix string) ([]id, error) {
+	if len(prefix) < minAbbrev || len(prefix) > sha1.Size*2 || !isHex(prefix) {
+		return nil, fmt.Errorf("%q is not a valid object id or prefix of at least %d characters", prefix, minAbbrev)
+	}
+
+	objectDb, err := r.path(ObjectsDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not get object directory path: %w", err)
+	}
+
+	dir := filepath.Join(objectDb, prefix[:2])
+
+	if len(prefix) == sha1.Size*2 {
+		if _, err := os.Stat(filepath.Join(dir, prefix[2:])); err != nil {
+			return []id{}, nil
 		}
+		return []id{prefix}, nil
 	}
 
-	return nil, fmt.Errorf("could not find object file for %q\n", id)
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []id{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []id{}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), prefix[2:]) {
+			ids = append(ids, prefix[:2]+file.Name())
+		}
+	}
+
+	return ids, nil
 }
 
-func getIdFromRef(ref filePath) (id, error) {
-	repoPath, err := getRepoPath()
-	path := filepath.Join(repoPath, ref)
+// FindUniqueAbbrev returns the shortest prefix of id, at least
+// defaultAbbrev characters long, that no other object shares.
+func FindUniqueAbbrev(id id) string {
+	if len(id) <= defaultAbbrev {
+		return id
+	}
+
+	length := defaultAbbrev
 
-	b, err := os.ReadFile(path)
+	neighbours, err := findObjectIds(id[:minAbbrev])
 	if err != nil {
-		return "", fmt.Errorf("could not get ref %q: %w", path, err)
+		return id
 	}
 
-	if id(b) == "" {
-		return "", errors.New("no head commit")
+	for _, other := range neighbours {
+		if other == id {
+			continue
+		}
+
+		common := 0
+		for common < len(id) && common < len(other) && id[common] == other[common] {
+			common++
+		}
+
+		if common+1 > length {
+			length = common + 1
+		}
 	}
 
-	return id(b), nil
+	return id[:min(length, len(id))]
 }
 
-// TODO: unfinished
-func getHeadCommit() (*Commit, error) {
-	headPath, err := getHeadPath()
-	b, err := os.ReadFile(headPath)
+// ReadObject returns the type and content of the object with the given id.
+func ReadObject(id id) (objectType, []byte, error) {
+	return workingRepo.readObject(id)
+}
+
+func (r *repository) readObject(id id) (objectType, []byte, error) {
+	data, err := r.readObjectData(id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return parseObject(data)
+}
+
+// readObjectData returns the decompressed, serialised form of an object,
+// whether it is stored loose or in a pack.
+func readObjectData(id id) ([]byte, error) {
+	return workingRepo.readObjectData(id)
+}
+
+func (r *repository) readObjectData(id id) ([]byte, error) {
+	fullId, err := r.expandObjectId(id)
 	if err != nil {
 		return nil, err
 	}
 
-	ref := string(b)
+	file, err := r.getObjectFile(fullId)
+	if err != nil {
+		return r.readPackedObjectData(fullId)
+	}
+	defer file.Close()
 
-	var head id
+	decompressor, err := zlib.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not create decompressor for %s: %w", id, err)
+	}
+	defer decompressor.Close()
 
-	if strings.HasPrefix(ref, "ref") {
-		refPath := strings.Split(ref, ": ")[1]
-		head, err = getIdFromRef(refPath)
-		if err != nil {
-			return nil, err
+	data, err := io.ReadAll(decompressor)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress object %s: %w", id, err)
+	}
+
+	return data, nil
+}
+
+// allObjectIds lists the id of every object in the object database, loose
+// or packed.
+func allObjectIds() ([]id, error) {
+	ids, err := looseObjectIds()
+	if err != nil {
+		return nil, err
+	}
+
+	packs, err := loadPackIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[id]bool, len(ids))
+	for _, objId := range ids {
+		seen[objId] = true
+	}
+
+	for _, pack := range packs {
+		for _, packed := range pack.allIds() {
+			if !seen[packed] {
+				seen[packed] = true
+				ids = append(ids, packed)
+			}
 		}
 	}
 
-	// Get Object file using ID - GetObjectFile
-	commitFile, err := GetObjectFile(head)
+	return ids, nil
+}
+
+// looseObjectIds lists the id of every object stored in its own file.
+func looseObjectIds() ([]id, error) {
+	objectDb, err := getObjectsDirPath()
+	if err != nil {
+		return nil, fmt.Errorf("could not get object directory path: %w", err)
+	}
+
+	dirs, err := os.ReadDir(objectDb)
 	if err != nil {
 		return nil, err
 	}
-	defer commitFile.Close()
 
-	// Get tree ID from commit
-	scanner := bufio.NewScanner(commitFile)
+	ids := []id{}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !isHex(dir.Name()) {
+			continue
+		}
 
-	var tree id
-	line := 1
-	for scanner.Scan() {
-		if line == 1 && !strings.HasPrefix(scanner.Text(), "commit") {
-			return nil, fmt.Errorf("file %s does not contain commit object", head)
+		files, err := os.ReadDir(filepath.Join(objectDb, dir.Name()))
+		if err != nil {
+			return nil, err
 		}
 
-		if line == 2 {
-			if !strings.HasPrefix(scanner.Text(), "tree") {
-				return nil, fmt.Errorf("commit %v incorrectly formatted", head)
+		for _, file := range files {
+			objId := dir.Name() + file.Name()
+			if len(objId) == sha1.Size*2 && isHex(objId) {
+				ids = append(ids, objId)
 			}
+		}
+	}
 
-			tree = strings.Split(scanner.Text(), " ")[1]
-			break
+	return ids, nil
+}
+
+// parseObject splits a serialised object into its type and content.
+func parseObject(data []byte) (objectType, []byte, error) {
+	header, content, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return "", nil, errors.New("object has no header")
+	}
+
+	var t objectType
+	var size int
+	if _, err := fmt.Sscanf(string(header), "%s %d", &t, &size); err != nil {
+		return "", nil, fmt.Errorf("malformed object header %q: %w", header, err)
+	}
+
+	if size != len(content) {
+		return "", nil, fmt.Errorf("object header claims %d bytes but has %d", size, len(content))
+	}
+
+	return t, content, nil
+}
+
+func readCommit(id id) (*Commit, error) {
+	return workingRepo.readCommit(id)
+}
+
+func (r *repository) readCommit(id id) (*Commit, error) {
+	t, content, err := r.readObject(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if t != COMMIT {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", id, t)
+	}
+
+	commit := &Commit{object: object{Id: id, Type: COMMIT}}
+
+	headers, message, _ := strings.Cut(string(content), "\n\n")
+	commit.Message = message
+
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			commit.Tree = value
+		case "parent":
+			commit.Parents = append(commit.Parents, value)
+		case "author":
+			commit.Author, commit.AuthoredAt, _ = parseSignature(value)
+		case "commiter":
+			commit.Committer, commit.CreatedAt, _ = parseSignature(value)
 		}
+	}
+
+	// Commits from before authors were recorded only name the committer
+	if commit.Author == "" {
+		commit.Author, commit.AuthoredAt = commit.Committer, commit.CreatedAt
+	}
+
+	if commit.Tree == "" {
+		return nil, fmt.Errorf("commit %v incorrectly formatted", id)
+	}
+
+	return commit, nil
+}
 
-		line++
+// getHeadCommit loads the commit HEAD points at, with Entries holding every
+// file in its tree. It returns nil when there are no commits yet.
+func getHeadCommit() (*Commit, error) {
+	_, head, err := readHead()
+	if err != nil {
+		return nil, err
 	}
 
-	treeFile, err := GetObjectFile(tree)
+	if head == "" {
+		return nil, nil
+	}
+
+	commit, err := readCommit(head)
 	if err != nil {
 		return nil, err
 	}
-	defer treeFile.Close()
 
-	contents, err := os.ReadFile(treeFile.Name())
+	files, err := flattenTree(commit.Tree)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Printf("Content of tree file:\n\n%s", contents)
+	commit.Entries = make(map[filePath]id, len(files))
+	for name, entry := range files {
+		commit.Entries[name] = entry.Id
+	}
 
-	// Load into commit struct
-	return nil, nil
+	return commit, nil
 }
 
 func WriteObject(op objectPath) (GotObject, error) {
@@ -474,40 +745,31 @@ func writeBlob(op objectPath) (*Blob, error) {
 		return nil, err
 	}
 
-	objectDb, err := getObjectsDirPath()
-	if err != nil {
-		return nil, fmt.Errorf("could not get object directory path: %w", err)
+	if err = writeObjectData(id, blobString); err != nil {
+		return nil, fmt.Errorf("could not write compressed contents of %v: %w", op, err)
 	}
 
-	objDir := filepath.Join(objectDb, id[:2])
-	objFile := filepath.Join(objDir, id[2:])
-
-	if err = os.MkdirAll(objDir, 0700); err != nil {
-		return nil, err
-	}
+	return newBlob(id), nil
+}
 
-	file, err := os.Create(objFile)
+// workingFileMode returns the tree entry mode for the file at path, which
+// is not followed if it is a symlink.
+func workingFileMode(path string) (string, error) {
+	info, err := os.Lstat(path)
 	if err != nil {
-		return nil, err
-	}
-
-	defer file.Close()
-
-	var b bytes.Buffer
-	compressor := zlib.NewWriter(&b)
-
-	if _, err = compressor.Write([]byte(blobString)); err != nil {
-		return nil, err
+		return "", err
 	}
 
-	compressor.Close()
-
-	err = os.WriteFile(objFile, b.Bytes(), 0700)
-	if err != nil {
-		return nil, fmt.Errorf("could not write compressed contents of %v to %v", op, objFile)
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		return MODE_SYMLINK, nil
+	case info.IsDir():
+		return MODE_TREE, nil
+	case info.Mode()&0111 != 0:
+		return MODE_EXECUTABLE, nil
+	default:
+		return MODE_FILE, nil
 	}
-
-	return newBlob(id), nil
 }
 
 func writeTree(op objectPath) (*Tree, error) {
@@ -529,13 +791,18 @@ func writeTree(op objectPath) (*Tree, error) {
 			if err != nil {
 				return nil, err
 			}
-			content += fmt.Sprintf("%v tree %v %v\n", 100644, tree.Id, file.Name())
+			content += fmt.Sprintf("%v tree %v %v\n", MODE_TREE, tree.Id, file.Name())
 		} else {
 			blob, err := writeBlob(filePath)
 			if err != nil {
 				return nil, err
 			}
-			content += fmt.Sprintf("%v blob %v %v\n", 100644, blob.Id, file.Name())
+
+			mode, err := workingFileMode(filePath)
+			if err != nil {
+				return nil, err
+			}
+			content += fmt.Sprintf("%v blob %v %v\n", mode, blob.Id, file.Name())
 		}
 
 	}
@@ -545,36 +812,7 @@ func writeTree(op objectPath) (*Tree, error) {
 		return nil, err
 	}
 
-	objectDb, err := getObjectsDirPath()
-	if err != nil {
-		return nil, fmt.Errorf("could not get object directory path: %w", err)
-	}
-
-	objDir := filepath.Join(objectDb, id[:2])
-	objFile := filepath.Join(objDir, id[2:])
-
-	if err = os.MkdirAll(objDir, 0700); err != nil {
-		return nil, err
-	}
-
-	file, err := os.Create(objFile)
-	if err != nil {
-		return nil, err
-	}
-
-	defer file.Close()
-
-	var b bytes.Buffer
-	compressor := zlib.NewWriter(&b)
-
-	if _, err = compressor.Write([]byte(treeString)); err != nil {
-		return nil, err
-	}
-
-	compressor.Close()
-
-	err = os.WriteFile(objFile, b.Bytes(), 0700)
-	if err != nil {
+	if err = writeObjectData(id, treeString); err != nil {
 		return nil, err
 	}
 
@@ -582,21 +820,42 @@ func writeTree(op objectPath) (*Tree, error) {
 }
 
 func formatHexId(obj string, t objectType) (id, objString string, err error) {
-	size, content := len(obj), obj
 	if t == BLOB {
-		fileContents, err := os.ReadFile(obj)
+		info, err := os.Lstat(obj)
 		if err != nil {
 			return "", "", err
 		}
-		info, err := os.Stat(obj)
+
+		// A symlink is stored as the path it points to, not followed
+		if info.Mode()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(obj)
+			if err != nil {
+				return "", "", err
+			}
+			return hashReader(strings.NewReader(filepath.ToSlash(target)), t)
+		}
+
+		file, err := os.Open(obj)
 		if err != nil {
 			return "", "", err
 		}
-		size = int(info.Size())
-		content = string(fileContents)
+		defer file.Close()
+
+		return hashReader(file, t)
 	}
 
-	objString = fmt.Sprintf("%v %d\n%v", t, size, content)
+	return hashReader(strings.NewReader(obj), t)
+}
+
+// hashReader reads everything from r and returns the id and serialised form
+// of it as an object of type t.
+func hashReader(r io.Reader, t objectType) (id, objString string, err error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	objString = fmt.Sprintf("%v %d\n%s", t, len(content), content)
 	hasher := sha1.New()
 
 	if _, err = hasher.Write([]byte(objString)); err != nil {
@@ -607,3 +866,75 @@ func formatHexId(obj string, t objectType) (id, objString string, err error) {
 
 	return id, objString, nil
 }
+
+// HashObject returns the id of the content read from r as an object of type
+// t. The object is only added to the object database when write is true.
+func HashObject(r io.Reader, t objectType, write bool) (id, error) {
+	if !IsObjectType(t) {
+		return "", fmt.Errorf("invalid object type %q", t)
+	}
+
+	id, objString, err := hashReader(r, t)
+	if err != nil {
+		return "", err
+	}
+
+	if write {
+		if err = writeObjectData(id, objString); err != nil {
+			return "", err
+		}
+	}
+
+	return id, nil
+}
+
+// IsObjectType reports whether t names one of the object types got stores.
+func IsObjectType(t string) bool {
+	return t == BLOB || t == TREE || t == COMMIT
+}
+
+// writeObjectData compresses a serialised object and stores it under its id.
+// Objects are immutable, so one that already exists is not written again,
+// but a loose one has its modification time moved to now: whatever is
+// writing it may be about to make it reachable, and prune's grace period
+// runs from that time. Packed objects need no such care, since repack
+// writes the unreachable ones back out as new loose objects before prune
+// can see them.
+func writeObjectData(id id, objString string) error {
+	packed, err := packedObjectExists(id)
+	if err != nil {
+		return err
+	}
+
+	if packed {
+		return nil
+	}
+
+	return writeLooseObjectData(id, objString)
+}
+
+func writeLooseObjectData(id id, objString string) error {
+	objectDb, err := getObjectsDirPath()
+	if err != nil {
+		return fmt.Errorf("could not get object directory path: %w", err)
+	}
+
+	objDir := filepath.Join(objectDb, id[:2])
+	objFile := filepath.Join(objDir, id[2:])
+
+	if _, err = os.Stat(objFile); err == nil {
+		now := time.Now()
+		return os.Chtimes(objFile, now, now)
+	}
+
+	if err = os.MkdirAll(objDir, 0700); err != nil {
+		return err
+	}
+
+	compressed, err := deflate([]byte(objString))
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(objFile, compressed, 0700)
+}
@@ -1,13 +1,38 @@
 package got
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/ljpurcell/got/tests"
 )
 
+// initTestRepo initialises a repository in a temporary directory and makes
+// it the working directory for the remainder of the test.
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("could not get working directory: %s", err)
+	}
+
+	if err = os.Chdir(dir); err != nil {
+		t.Fatalf("could not change to test directory: %s", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err = Init(dir); err != nil {
+		t.Fatalf("could not initialise repository: %s", err)
+	}
+
+	return dir
+}
+
 func TestInit(t *testing.T) {
 	td, err := tests.GetTestDataDirectory(t)
 	if err != nil {
@@ -20,3 +45,96 @@ func TestInit(t *testing.T) {
 
 	os.RemoveAll(filepath.Join(td, ".got"))
 }
+
+func TestHashObject(t *testing.T) {
+	initTestRepo(t)
+
+	if err := os.WriteFile("hello.txt", []byte("hello\n"), 0666); err != nil {
+		t.Fatalf("could not write test file: %s", err)
+	}
+
+	fileId, _, err := formatHexId("hello.txt", BLOB)
+	if err != nil {
+		t.Fatalf("could not hash file: %s", err)
+	}
+
+	id, err := HashObject(strings.NewReader("hello\n"), BLOB, false)
+	if err != nil {
+		t.Fatalf("could not hash reader: %s", err)
+	}
+
+	if id != fileId {
+		t.Fatalf("reader id %s should match file id %s", id, fileId)
+	}
+
+	// Objects are hashed with a "<type> <size>\n" header, where git ends
+	// the header with a NUL, so these ids are got's own rather than git's
+	for content, want := range map[string]string{
+		"":        "086fdd7631d586d121a6192c5987834ac6cbf9f0",
+		"hello\n": "ed21d0efeb66c573cd1bf4e6b17c00c66d3fca15",
+	} {
+		if got, err := HashObject(strings.NewReader(content), BLOB, false); err != nil || got != want {
+			t.Fatalf("the blob %q should hash to %s, got %s (%v)", content, want, got, err)
+		}
+	}
+
+	objFile := filepath.Join(Repo, ObjectsDir, id[:2], id[2:])
+	if _, err = os.Stat(objFile); err == nil {
+		t.Fatalf("object %s should not be written without write", id)
+	}
+
+	if _, err = HashObject(strings.NewReader("hello\n"), BLOB, true); err != nil {
+		t.Fatalf("could not write object: %s", err)
+	}
+
+	if _, err = os.Stat(objFile); err != nil {
+		t.Fatalf("object %s should have been written: %s", id, err)
+	}
+
+	if _, err = HashObject(strings.NewReader(""), "bogus", false); err == nil {
+		t.Fatal("hashing an unknown object type should fail")
+	}
+}
+
+func TestAmbiguousShortIds(t *testing.T) {
+	initTestRepo(t)
+
+	id, err := HashObject(strings.NewReader("hello\n"), BLOB, true)
+	if err != nil {
+		t.Fatalf("could not write object: %s", err)
+	}
+
+	if abbrev := FindUniqueAbbrev(id); abbrev != id[:defaultAbbrev] {
+		t.Fatalf("abbreviation should be %s but is %s", id[:defaultAbbrev], abbrev)
+	}
+
+	// A neighbour sharing the first nine characters forces a longer abbreviation
+	neighbour := id[:9] + strings.Repeat("0", len(id)-9)
+	if neighbour == id {
+		neighbour = id[:9] + strings.Repeat("1", len(id)-9)
+	}
+
+	dir := filepath.Join(Repo, ObjectsDir, id[:2])
+	if err = os.WriteFile(filepath.Join(dir, neighbour[2:]), nil, 0666); err != nil {
+		t.Fatalf("could not write neighbouring object: %s", err)
+	}
+
+	if abbrev := FindUniqueAbbrev(id); abbrev != id[:10] {
+		t.Fatalf("abbreviation should be %s but is %s", id[:10], abbrev)
+	}
+
+	_, err = GetObjectFile(id[:7])
+	if !errors.Is(err, ErrAmbiguousId) {
+		t.Fatalf("prefix shared by two objects should be ambiguous, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), id) || !strings.Contains(err.Error(), neighbour) {
+		t.Fatalf("ambiguity error should list both candidates: %s", err)
+	}
+
+	file, err := GetObjectFile(id[:10])
+	if err != nil {
+		t.Fatalf("unique prefix should resolve: %s", err)
+	}
+	file.Close()
+}
@@ -0,0 +1,118 @@
+package got
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// HooksDir holds the executables run at points in commit and checkout:
+//
+//	pre-commit     before the commit is made; failing aborts it
+//	commit-msg     given the path of a file holding the message, which it
+//	               may rewrite; failing aborts the commit
+//	post-commit    after the commit is made
+//	post-checkout  given the previous and new HEAD ids and 1, as only
+//	               whole commits are checked out
+//
+// The commit hooks also run for each commit made by cherry-pick, revert
+// and rebase, where a failing hook stops the sequence like a conflict
+// would, and post-checkout runs after clone with the zero id as the
+// previous HEAD. Stash commits run no hooks.
+//
+// Hooks run from the top of the working directory with GOT_DIR and
+// GOT_INDEX_FILE set to the repository and index paths. Their output goes
+// to stderr.
+const HooksDir filePath = "hooks"
+
+// runHook runs the named hook with args, reporting whether there was one.
+// A hook that exits non-zero is an error.
+func runHook(name string, args ...string) (bool, error) {
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return false, fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	path := filepath.Join(repoPath, HooksDir, name)
+
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not read the %s hook: %w", name, err)
+	}
+
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		fmt.Fprintf(os.Stderr, "hint: the %s hook was ignored because it is not executable\n", name)
+		return false, nil
+	}
+
+	indexPath, err := getIndexPath()
+	if err != nil {
+		return false, err
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	cmd.Env = append(os.Environ(), "GOT_DIR="+repoPath, "GOT_INDEX_FILE="+indexPath)
+
+	if err = cmd.Run(); err != nil {
+		return true, fmt.Errorf("the %s hook failed: %w", name, err)
+	}
+
+	return true, nil
+}
+
+// runPreCommitHooks runs the pre-commit hook, reloading index in case it
+// staged more changes, and then passes message through the commit-msg
+// hook.
+func runPreCommitHooks(index *Index, message string) (string, error) {
+	ran, err := runHook("pre-commit")
+	if err != nil {
+		return "", err
+	}
+
+	if ran {
+		if *index, err = GetIndex(); err != nil {
+			return "", err
+		}
+	}
+
+	return runCommitMsgHook(message)
+}
+
+// runCommitMsgHook lets the commit-msg hook check, and perhaps rewrite, a
+// commit message through the commit message file.
+func runCommitMsgHook(message string) (string, error) {
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return "", fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	path := filepath.Join(repoPath, CommitEditMsgFile)
+	if err = os.WriteFile(path, []byte(strings.TrimRight(message, "\n")+"\n"), 0666); err != nil {
+		return "", fmt.Errorf("could not write commit message file: %w", err)
+	}
+
+	ran, err := runHook("commit-msg", path)
+	if err != nil || !ran {
+		return message, err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read commit message file: %w", err)
+	}
+
+	message = strings.TrimRight(string(b), "\n")
+	if strings.TrimSpace(message) == "" {
+		return "", errors.New("the commit-msg hook left an empty message")
+	}
+
+	return message, nil
+}
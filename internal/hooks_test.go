@@ -0,0 +1,147 @@
+package got
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestHook(t *testing.T, name, script string) {
+	t.Helper()
+
+	path := filepath.Join(Repo, HooksDir, name)
+	writeTestFile(t, path, "#!/bin/sh\n"+script)
+
+	if err := os.Chmod(path, 0755); err != nil {
+		t.Fatalf("could not make hook executable: %s", err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestHook(t, "pre-commit", `grep -q TODO a.txt && exit 1; exit 0`)
+	writeTestHook(t, "commit-msg", `printf 'checked: %s\n' "$(cat "$1")" > "$1"`)
+	writeTestHook(t, "post-commit", `echo "$GOT_DIR" > post-commit.out`)
+	writeTestHook(t, "post-checkout", `echo "$1 $2 $3" > post-checkout.out`)
+
+	writeTestFile(t, "a.txt", "TODO\n")
+	index := stageTestFiles(t, "a.txt")
+
+	if err := index.Commit("first", CommitOptions{}); err == nil || !strings.Contains(err.Error(), "pre-commit") {
+		t.Fatalf("a failing pre-commit hook should abort the commit, got %v", err)
+	}
+	if _, head, _ := readHead(); head != "" {
+		t.Fatalf("nothing should be committed when pre-commit fails")
+	}
+	if _, err := os.Stat("post-commit.out"); err == nil {
+		t.Fatalf("post-commit should not run for an aborted commit")
+	}
+
+	if err := index.Commit("first", CommitOptions{NoVerify: true}); err != nil {
+		t.Fatalf("--no-verify should skip the failing hook: %s", err)
+	}
+	first := mustResolve(t, HeadFile)
+	if commit, _ := readCommit(first); commit.Message != "first" {
+		t.Errorf("--no-verify should skip commit-msg, got message %q", commit.Message)
+	}
+
+	writeTestFile(t, "a.txt", "done\n")
+	index = stageTestFiles(t, "a.txt")
+	if err := index.Commit("second", CommitOptions{}); err != nil {
+		t.Fatalf("could not commit: %s", err)
+	}
+	second := mustResolve(t, HeadFile)
+
+	if commit, _ := readCommit(second); commit.Message != "checked: second" {
+		t.Errorf("commit-msg should be able to rewrite the message, got %q", commit.Message)
+	}
+	if out, _ := os.ReadFile("post-commit.out"); !strings.HasSuffix(strings.TrimSpace(string(out)), Repo) {
+		t.Errorf("post-commit should run with GOT_DIR set, got %q", out)
+	}
+
+	if err := Checkout(first, "", false); err != nil {
+		t.Fatalf("could not check out: %s", err)
+	}
+	if out, _ := os.ReadFile("post-checkout.out"); string(out) != second+" "+first+" 1\n" {
+		t.Errorf("post-checkout should get the previous and new HEAD, got %q", out)
+	}
+
+	os.Remove("post-checkout.out")
+	if err := Checkout("main", "", true); err != nil {
+		t.Fatalf("could not check out: %s", err)
+	}
+	if _, err := os.Stat("post-checkout.out"); err == nil {
+		t.Errorf("--no-verify should skip post-checkout")
+	}
+}
+
+func TestHooksNothingToCommit(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a\n")
+	commitTestFiles(t, "first", "a.txt")
+
+	writeTestHook(t, "pre-commit", `touch pre-commit.out`)
+
+	index, err := GetIndex()
+	if err != nil {
+		t.Fatalf("could not get index: %s", err)
+	}
+
+	if err = index.Commit("nothing", CommitOptions{}); !errors.Is(err, ErrNothingToCommit) {
+		t.Fatalf("committing nothing should fail with ErrNothingToCommit, got %v", err)
+	}
+	if _, err = os.Stat("pre-commit.out"); err == nil {
+		t.Errorf("pre-commit should not run for a commit that is refused as empty")
+	}
+}
+
+func TestSequencerHooks(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a\n")
+	commitTestFiles(t, "first", "a.txt")
+
+	if err := Checkout(HeadFile, "feature", false); err != nil {
+		t.Fatalf("could not create branch: %s", err)
+	}
+
+	writeTestFile(t, "b.txt", "b\n")
+	commitTestFiles(t, "add b", "b.txt")
+	addB := mustResolve(t, HeadFile)
+
+	if err := Checkout("main", "", false); err != nil {
+		t.Fatalf("could not check out main: %s", err)
+	}
+
+	writeTestHook(t, "pre-commit", `test ! -e block`)
+	writeTestHook(t, "commit-msg", `printf 'checked: %s\n' "$(cat "$1")" > "$1"`)
+	writeTestHook(t, "post-commit", `echo done >> post-commit.out`)
+
+	writeTestFile(t, "block", "")
+	if _, err := CherryPick([]string{addB}); err == nil || !strings.Contains(err.Error(), "pre-commit") {
+		t.Fatalf("a failing pre-commit hook should stop the cherry-pick, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(Repo, SequencerDir)); err != nil {
+		t.Fatalf("the staged pick should be left to continue: %s", err)
+	}
+
+	os.Remove("block")
+	results, err := ContinueSequence()
+	if err != nil {
+		t.Fatalf("could not continue: %s", err)
+	}
+	if len(results) != 1 || results[0].Commit == "" {
+		t.Fatalf("continuing should commit the pick, got %+v", results)
+	}
+
+	if commit, _ := readCommit(results[0].Commit); commit.Message != "checked: add b" {
+		t.Errorf("commit-msg should rewrite the picked message, got %q", commit.Message)
+	}
+	if out, _ := os.ReadFile("post-commit.out"); string(out) != "done\n" {
+		t.Errorf("post-commit should run once for the pick, got %q", out)
+	}
+}
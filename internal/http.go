@@ -0,0 +1,154 @@
+package got
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Over HTTP a repository serves
+//
+//	GET  /refs          the ref advertisement
+//	POST /upload-pack   a pack request, answered with the pack
+//	POST /receive-pack  a push's updates followed by its pack
+//
+// and failures come back as a non-200 status with the reason as text.
+const packContentType = "application/x-got-pack"
+
+// repoServer serves one repository over HTTP.
+type repoServer struct {
+	repo *repository
+	// limit is the largest request body accepted
+	limit int64
+}
+
+// NewServer returns a handler serving the repository at dir to the HTTP
+// transport.
+func NewServer(dir filePath) (http.Handler, error) {
+	repo, err := openRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &repoServer{repo: repo, limit: maxMessageSize}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/refs", server.handle(http.MethodGet, (*repository).serveRefs))
+	mux.HandleFunc("/upload-pack", server.handle(http.MethodPost, (*repository).serveUploadPack))
+	mux.HandleFunc("/receive-pack", server.handle(http.MethodPost, (*repository).serveReceivePack))
+
+	return mux, nil
+}
+
+// handle wraps a handler that reads the whole request body and returns the
+// whole response.
+func (s *repoServer) handle(method string, serve func(repo *repository, body []byte) ([]byte, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.limit))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+
+			status := http.StatusBadRequest
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		response, err := serve(s.repo, body)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrNonFastForward) || errors.Is(err, ErrCurrentBranch) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", packContentType)
+		w.Write(response)
+	}
+}
+
+// httpTransport talks to a repository served by NewServer.
+type httpTransport struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPTransport(url string) *httpTransport {
+	return &httpTransport{url: strings.TrimRight(url, "/"), client: http.DefaultClient}
+}
+
+func (h *httpTransport) listRefs() (*remoteRefs, error) {
+	body, err := h.request(http.MethodGet, "/refs", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return readRefAdvertisement(bufio.NewReader(bytes.NewReader(body)))
+}
+
+func (h *httpTransport) fetchPack(wants, haves []id) ([]byte, error) {
+	var b bytes.Buffer
+	if err := writePackRequest(&b, wants, haves); err != nil {
+		return nil, err
+	}
+
+	return h.request(http.MethodPost, "/upload-pack", &b)
+}
+
+func (h *httpTransport) pushPack(pack []byte, updates []refUpdate) error {
+	var b bytes.Buffer
+	if err := writeRefUpdates(&b, updates); err != nil {
+		return err
+	}
+	b.Write(pack)
+
+	_, err := h.request(http.MethodPost, "/receive-pack", &b)
+	return err
+}
+
+func (h *httpTransport) close() error {
+	return nil
+}
+
+// request makes a call to the server and returns the whole response body,
+// turning a failure status into an error holding the server's reason.
+func (h *httpTransport) request(method, path string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, h.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", packContentType)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read response from %s: %w", h.url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(content)))
+	}
+
+	return content, nil
+}
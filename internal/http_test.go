@@ -0,0 +1,201 @@
+package got
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mustPack encodes an empty pack.
+func mustPack(t *testing.T) []byte {
+	t.Helper()
+
+	pack, err := encodePack(nil, nil)
+	if err != nil {
+		t.Fatalf("could not encode pack: %s", err)
+	}
+	return pack.data
+}
+
+func TestUnsafeRefNames(t *testing.T) {
+	server := initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a\n")
+	commitTestFiles(t, "first", "a.txt")
+	first := mustResolve(t, HeadFile)
+
+	handler, err := NewServer(server)
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	outside := t.TempDir()
+	escape := branchRef("../../../../../../../../../../../.." + filepath.ToSlash(outside) + "/PWNED")
+
+	for _, ref := range []filePath{escape, "refs/heads/a/../../../x", "refs/heads//x", "refs/heads/", "refs/tags/v1"} {
+		update := refUpdate{Ref: ref, New: first, Force: true}
+
+		transport, _ := openTransport(ts.URL)
+		if err := transport.pushPack(mustPack(t), []refUpdate{update}); err == nil {
+			t.Errorf("the server should refuse to update %q", ref)
+		}
+
+		if err := receivePack(mustPack(t), []refUpdate{update}); err == nil {
+			t.Errorf("receivePack should refuse to update %q", ref)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "PWNED")); err == nil {
+		t.Fatalf("a pushed ref should never be written outside the repository")
+	}
+
+	var b bytes.Buffer
+	writeProtocolBlock(&b, []string{refPrefix + "refs/heads/../../HEAD", first + " refs/heads/main"})
+	if _, err := readRefAdvertisement(bufio.NewReader(&b)); err == nil {
+		t.Errorf("an advertised HEAD outside refs/heads should be refused")
+	}
+
+	b.Reset()
+	writeProtocolBlock(&b, []string{first + " refs/heads/../../../config"})
+	if _, err := readRefAdvertisement(bufio.NewReader(&b)); err == nil {
+		t.Errorf("an advertised ref outside refs/heads should be refused")
+	}
+}
+
+func TestServerRequestLimit(t *testing.T) {
+	server := initTestRepo(t)
+
+	s := &repoServer{repo: &repository{dir: filepath.Join(server, Repo)}, limit: 16}
+	handler := s.handle(http.MethodPost, (*repository).serveUploadPack)
+
+	for _, c := range []struct {
+		body   string
+		status int
+	}{
+		{strings.Repeat("x", 17), http.StatusRequestEntityTooLarge},
+		{"\n", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/upload-pack", strings.NewReader(c.body)))
+
+		if w.Code != c.status {
+			t.Errorf("a body of %d bytes should be answered with %d, got %d: %s", len(c.body), c.status, w.Code, w.Body)
+		}
+	}
+}
+
+func TestServerConcurrentRequests(t *testing.T) {
+	server := initTestRepo(t)
+	writeTestFile(t, "a.txt", "a\n")
+	commitTestFiles(t, "first", "a.txt")
+	served := mustResolve(t, HeadFile)
+
+	handler, err := NewServer(server)
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	// Requests run while the test sits in another repository, which they
+	// must neither read from nor move the test out of
+	initTestRepo(t)
+	writeTestFile(t, "b.txt", "b\n")
+	commitTestFiles(t, "other", "b.txt")
+	own := mustResolve(t, HeadFile)
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			transport, err := openTransport(ts.URL)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer transport.close()
+
+			for j := 0; j < 10; j++ {
+				refs, err := transport.listRefs()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if refs.Refs[branchRef("main")] != served {
+					errs <- fmt.Errorf("main should be served at %s, got %+v", served, refs)
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+
+	for i := 0; i < cap(errs); i++ {
+		if _, head, err := readHead(); err != nil || head != own {
+			t.Errorf("HEAD should stay at %s while serving, got %s (%v)", own, head, err)
+		}
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent request failed: %s", err)
+		}
+	}
+}
+
+func TestServeBareRepository(t *testing.T) {
+	initTestRepo(t)
+	writeTestFile(t, "a.txt", "a\n")
+	commitTestFiles(t, "first", "a.txt")
+
+	bare := filepath.Join(t.TempDir(), "project.got")
+	if err := InitBare(bare); err != nil {
+		t.Fatalf("could not initialise bare repository: %s", err)
+	}
+	if err := AddRemote("origin", bare); err != nil {
+		t.Fatalf("could not add remote: %s", err)
+	}
+	if _, err := Push("origin", "main", false); err != nil {
+		t.Fatalf("could not push to the bare repository: %s", err)
+	}
+
+	handler, err := NewServer(bare)
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	clone := filepath.Join(t.TempDir(), "clone")
+	if err := Clone(ts.URL, clone); err != nil {
+		t.Fatalf("could not clone: %s", err)
+	}
+
+	var second id
+	inTestRepo(t, clone, func() {
+		if content, _ := os.ReadFile("a.txt"); string(content) != "a\n" {
+			t.Fatalf("the clone should check out a.txt, got %q", content)
+		}
+
+		writeTestFile(t, "b.txt", "b\n")
+		commitTestFiles(t, "second", "b.txt")
+		second = mustResolve(t, HeadFile)
+
+		if _, err := Push("origin", "main", false); err != nil {
+			t.Fatalf("a bare repository should take pushes to main: %s", err)
+		}
+	})
+
+	repo, err := openRepository(bare)
+	if err != nil {
+		t.Fatalf("could not open bare repository: %s", err)
+	}
+	if main, _ := repo.readRef(branchRef("main")); main != second {
+		t.Fatalf("the push should move main to %s, got %s", second, main)
+	}
+}
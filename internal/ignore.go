@@ -0,0 +1,84 @@
+package got
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// ignoreRules holds the patterns read from the .gotignore file at the root
+// of the working directory. Patterns are shell globs; those containing a
+// slash are matched against the whole path, others against any path
+// component, and a trailing slash restricts a pattern to directories.
+type ignoreRules struct {
+	patterns []string
+}
+
+func loadIgnoreRules() (*ignoreRules, error) {
+	rules := &ignoreRules{}
+
+	file, err := os.Open(IgnoreFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rules.patterns = append(rules.patterns, line)
+	}
+
+	return rules, scanner.Err()
+}
+
+// ignored reports whether the slash separated path, or any directory above
+// it, is matched by the rules. The repository directory is always ignored.
+func (r *ignoreRules) ignored(name filePath, isDir bool) bool {
+	parts := strings.Split(name, "/")
+
+	for i := range parts {
+		dir := i < len(parts)-1 || isDir
+		if r.matches(strings.Join(parts[:i+1], "/"), dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *ignoreRules) matches(name filePath, isDir bool) bool {
+	if name == Repo {
+		return true
+	}
+
+	for _, pattern := range r.patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+
+		target := path.Base(name)
+		if strings.Contains(pattern, "/") {
+			pattern = strings.TrimPrefix(pattern, "/")
+			target = name
+		}
+
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,11 +2,13 @@ package got
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -31,6 +33,7 @@ type Index struct {
 
 type indexEntry struct {
 	Id     string
+	Mode   string
 	Name   filePath
 	IsDir  bool
 	Status status
@@ -41,8 +44,10 @@ func (i *Index) Entries() []indexEntry {
 }
 
 func (i *Index) Clear() error {
-	if err := i.storage.Truncate(0); err != nil {
-		return err
+	if i.storage != nil {
+		if err := i.storage.Truncate(0); err != nil {
+			return err
+		}
 	}
 
 	i.entries = []indexEntry{}
@@ -60,11 +65,16 @@ func (i *Index) IncludesFile(file string) (bool, int) {
 }
 
 func (i *Index) UpdateOrAddEntry(path string) error {
-	fi, err := os.Stat(path)
+	fi, err := os.Lstat(path)
 	if err != nil {
 		return err
 	}
 
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return fmt.Errorf("could not load ignore rules: %w", err)
+	}
+
 	files := []string{path}
 
 	if fi.IsDir() {
@@ -77,6 +87,10 @@ func (i *Index) UpdateOrAddEntry(path string) error {
 
 		for _, entry := range entries {
 			nestedPath := filepath.Join(path, entry.Name())
+			if rules.ignored(cleanPath(nestedPath), entry.IsDir()) {
+				continue
+			}
+
 			if entry.IsDir() {
 				if err = i.UpdateOrAddEntry(nestedPath); err != nil {
 					return err
@@ -87,46 +101,63 @@ func (i *Index) UpdateOrAddEntry(path string) error {
 		}
 	}
 
+	_, headId, err := readHead()
+	if err != nil {
+		return fmt.Errorf("could not get head commit: %s", err)
+	}
+
+	head, err := commitFiles(headId)
+	if err != nil {
+		return fmt.Errorf("could not get head commit: %s", err)
+	}
+
 	for _, fName := range files {
-		if _, err := os.Stat(fName); err != nil {
+		blob, err := writeBlob(fName)
+		if err != nil {
 			return err
 		}
 
-		blobId, _, err := formatHexId(fName, BLOB)
+		mode, err := workingFileMode(fName)
 		if err != nil {
 			return err
 		}
 
-		parent, err := getHeadCommit()
-		if err != nil {
-			return fmt.Errorf("could not get head commit: %s", err)
-		}
+		name := cleanPath(fName)
+		status := STATUS_ADD
+		staged := TreeEntry{Mode: mode, Type: BLOB, Id: blob.Id, Name: name}
 
-		var status string
+		if committed, ok := head[name]; ok {
+			status = STATUS_MODIFY
 
-		if parent != nil {
-			if _, ok := parent.Entries[fName]; ok {
-				status = STATUS_MODIFY
-			} else {
-				status = STATUS_ADD
+			if sameEntry(committed, staged) {
+				// Back to the committed content, so nothing to stage
+				if found, idx := i.IncludesFile(name); found {
+					i.entries = append(i.entries[:idx], i.entries[idx+1:]...)
+				}
+				continue
 			}
-		} else {
-			status = STATUS_ADD
 		}
 
-		found, entryIndex := i.IncludesFile(path)
+		found, entryIndex := i.IncludesFile(name)
 		if found {
-			if i.entries[entryIndex].Id != blobId {
-				status += STATUS_MODIFY
+			entry := &i.entries[entryIndex]
+			if entry.Status == STATUS_ADD && (entry.Id != blob.Id || entry.Mode != mode) {
+				status = STATUS_ADD_AND_MODIFIED
+			}
+			if entry.Status == STATUS_ADD_AND_MODIFIED {
+				status = entry.Status
 			}
 
-			i.entries[entryIndex].Id = blobId
-			return nil
+			entry.Id = blob.Id
+			entry.Mode = mode
+			entry.Status = status
+			continue
 		}
 
 		entry := indexEntry{
-			Id:     blobId,
-			Name:   path,
+			Id:     blob.Id,
+			Mode:   mode,
+			Name:   name,
 			IsDir:  false,
 			Status: status,
 		}
@@ -137,20 +168,90 @@ func (i *Index) UpdateOrAddEntry(path string) error {
 	return nil
 }
 
-func (i *Index) RemoveFile(file string) (removed bool, err error) {
-	err = os.Remove(file)
+// RemoveFile stages the deletion of the tracked file at path, or of every
+// tracked file beneath it when recursive is set, and returns their names.
+// Unless cached is set the files are deleted from the working directory
+// too, which is refused for files with changes that are not staged. Files
+// whose staged content differs from both HEAD and the working directory are
+// refused either way. Force skips both checks.
+func (i *Index) RemoveFile(path string, cached, recursive, force bool) ([]filePath, error) {
+	files, err := i.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	_, headId, err := readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := commitFiles(headId)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	p := cleanPath(path)
+	removed := []filePath{}
+
+	for name := range files {
+		if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+			removed = append(removed, name)
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil, fmt.Errorf("%q did not match any tracked files", p)
+	}
+
+	if _, ok := files[p]; !ok && !recursive {
+		return nil, fmt.Errorf("not removing directory %q without -r", p)
+	}
+
+	slices.Sort(removed)
+
+	if !force {
+		for _, name := range removed {
+			differs, err := workingFileDiffers(name, files[name])
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = os.Lstat(name)
+			unstaged := err == nil && differs
+
+			committed, ok := head[name]
+			staged := !ok || !sameEntry(committed, files[name])
+
+			// Staged content found nowhere else would be lost either way
+			if staged && unstaged {
+				return nil, fmt.Errorf("%q has staged content different from both the file and HEAD; use -f to remove it anyway", name)
+			}
+
+			if unstaged && !cached {
+				return nil, fmt.Errorf("%q has changes that are not staged; stage them or use -f to remove it anyway", name)
+			}
+		}
 	}
 
-	found, idx := i.IncludesFile(file)
-	if !found {
-		return false, nil
+	for _, name := range removed {
+		delete(files, name)
+
+		if found, idx := i.IncludesFile(name); found {
+			i.entries = slices.Delete(i.entries, idx, idx+1)
+		}
+
+		if entry, ok := stagedChange(name, head, files); ok {
+			i.entries = append(i.entries, entry)
+		}
+
+		if !cached {
+			if err := removeWorkingFile(name); err != nil {
+				return nil, fmt.Errorf("could not remove %q: %w", name, err)
+			}
+		}
 	}
 
-	// TODO: currently removing file from index, later update status instead
-	i.entries = append(i.entries[:idx], i.entries[idx+1:]...)
-	return true, nil
+	return removed, nil
 }
 
 func (i *Index) Save() error {
@@ -168,7 +269,7 @@ func (i *Index) Save() error {
 
 	contents := ""
 	for _, entry := range i.entries {
-		contents += fmt.Sprintf("%v %v %v\n", entry.Status, entry.Id, entry.Name)
+		contents += fmt.Sprintf("%v %v %v %v\n", entry.Status, entry.Mode, entry.Id, entry.Name)
 	}
 
 	return os.WriteFile(indexPath, []byte(contents), 0700)
@@ -178,44 +279,357 @@ func (i *Index) Length() int {
 	return len(i.entries)
 }
 
-func (i *Index) Commit(msg string) error {
-	cb := newCommitBuilder()
-	cb.message(msg)
+// Snapshot returns the files the next commit will contain, keyed by path:
+// those in the HEAD commit with the staged changes applied on top.
+func (i *Index) Snapshot() (map[filePath]TreeEntry, error) {
+	files := map[filePath]TreeEntry{}
 
-	if err := cb.entries(i.Entries()); err != nil {
-		return fmt.Errorf("commit builder entries method: %w", err)
+	_, head, err := readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	if head != "" {
+		commit, err := readCommit(head)
+		if err != nil {
+			return nil, err
+		}
+
+		if files, err = flattenTree(commit.Tree); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range i.entries {
+		if entry.Status == STATUS_DELETE {
+			delete(files, entry.Name)
+			continue
+		}
+
+		files[entry.Name] = TreeEntry{Mode: entry.Mode, Type: BLOB, Id: entry.Id, Name: entry.Name}
+	}
+
+	return files, nil
+}
+
+// stageFiles replaces the staged changes so that the next commit holds
+// files, given that HEAD holds head.
+func (i *Index) stageFiles(head, files map[filePath]TreeEntry) {
+	i.entries = []indexEntry{}
+
+	for name := range files {
+		if entry, ok := stagedChange(name, head, files); ok {
+			i.entries = append(i.entries, entry)
+		}
+	}
+
+	for name := range head {
+		if _, ok := files[name]; !ok {
+			entry, _ := stagedChange(name, head, files)
+			i.entries = append(i.entries, entry)
+		}
 	}
 
+	slices.SortFunc(i.entries, func(a, b indexEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+// stagedChange returns the index entry that turns name in head into name in
+// files, or false when they already agree.
+func stagedChange(name filePath, head, files map[filePath]TreeEntry) (indexEntry, bool) {
+	before, inHead := head[name]
+	after, inFiles := files[name]
+
+	switch {
+	case inHead && inFiles && sameEntry(before, after), !inHead && !inFiles:
+		return indexEntry{}, false
+	case !inFiles:
+		return indexEntry{Id: before.Id, Mode: before.Mode, Name: name, Status: STATUS_DELETE}, true
+	case !inHead:
+		return indexEntry{Id: after.Id, Mode: after.Mode, Name: name, Status: STATUS_ADD}, true
+	default:
+		return indexEntry{Id: after.Id, Mode: after.Mode, Name: name, Status: STATUS_MODIFY}, true
+	}
+}
+
+// CommitOptions change how Commit makes a commit.
+type CommitOptions struct {
+	// Amend replaces the HEAD commit, keeping its parents and, unless
+	// ResetAuthor is set, its author. An empty message keeps its message.
+	Amend       bool
+	ResetAuthor bool
+	// AllowEmpty allows a commit with the same files as its parent.
+	AllowEmpty bool
+	// NoVerify skips the pre-commit and commit-msg hooks.
+	NoVerify bool
+}
+
+// ErrNothingToCommit is returned when a commit would hold the same files as
+// its parent.
+var ErrNothingToCommit = errors.New("nothing to commit; use --allow-empty to commit anyway")
+
+// Commit makes a commit of the staged files on top of HEAD, or in place of
+// it when amending. Unless opts.NoVerify is set, the pre-commit and
+// commit-msg hooks run first and either can abort it.
+func (i *Index) Commit(msg string, opts CommitOptions) error {
+	cb := newCommitBuilder()
+
 	if err := cb.setParent(); err != nil {
 		return fmt.Errorf("commit builder set parent method: %w", err)
 	}
 
+	action := "commit"
+
+	if opts.Amend {
+		head, err := getHeadCommit()
+		if err != nil {
+			return err
+		}
+
+		if head == nil {
+			return errors.New("there is no commit to amend")
+		}
+
+		if strings.TrimSpace(msg) == "" {
+			msg = head.Message
+		}
+
+		if !opts.ResetAuthor {
+			cb.author(head.Author, head.AuthoredAt)
+		}
+
+		cb.parents(head.Parents...)
+		action = "commit (amend)"
+	} else if len(cb.commit.Parents) == 0 {
+		action = "commit (initial)"
+	}
+
+	parent := ""
+	if len(cb.commit.Parents) > 0 {
+		parent = cb.commit.Parents[0]
+	}
+
+	// There is no point running the hooks for a commit that will be refused
+	if err := i.checkChanges(parent, opts.AllowEmpty); err != nil {
+		return err
+	}
+
+	if !opts.NoVerify {
+		var err error
+		if msg, err = runPreCommitHooks(i, msg); err != nil {
+			return err
+		}
+
+		// pre-commit may have unstaged everything
+		if err = i.checkChanges(parent, opts.AllowEmpty); err != nil {
+			return err
+		}
+	}
+
+	files, err := i.Snapshot()
+	if err != nil {
+		return fmt.Errorf("could not get index snapshot: %w", err)
+	}
+
+	cb.message(msg)
+
+	if err := cb.entries(files); err != nil {
+		return fmt.Errorf("commit builder entries method: %w", err)
+	}
+
 	commit, err := cb.build()
 	if err != nil {
 		return fmt.Errorf("commit builder build method: %w", err)
 	}
 
+	fmt.Printf("Created commit %s\n", FindUniqueAbbrev(commit.Id))
+
 	if err = i.Clear(); err != nil {
 		return err
 	}
 
-	// 2. Update hash pointed at by main in ref file
-	refsHeadMainPath, err := getRefHeadsMainFilePath()
+	if err = i.Save(); err != nil {
+		return err
+	}
+
+	if err = updateHead(commit.Id, commitReflogReason(action, commit)); err != nil {
+		return err
+	}
+
+	// The commit is made, so a failing post-commit hook changes nothing
+	runHook("post-commit")
+
+	return nil
+}
+
+// checkChanges returns ErrNothingToCommit when a commit of the index would
+// hold the same files as parent, unless allowEmpty is set.
+func (i *Index) checkChanges(parent id, allowEmpty bool) error {
+	if allowEmpty {
+		return nil
+	}
+
+	files, err := i.Snapshot()
 	if err != nil {
-		return fmt.Errorf("could not get ref head main file path: %w", err)
+		return fmt.Errorf("could not get index snapshot: %w", err)
 	}
-	if err := os.Truncate(refsHeadMainPath, 0); err != nil {
+
+	parentFiles, err := commitFiles(parent)
+	if err != nil {
 		return err
 	}
 
-	rw := fs.FileMode(0666)
-	if err := os.WriteFile(refsHeadMainPath, []byte(commit.Id), rw); err != nil {
-		return fmt.Errorf("Could not write commit id %v to %v file: %v", commit.Id, refsHeadMainPath, err)
+	if len(diffTrees(parentFiles, files)) == 0 {
+		return ErrNothingToCommit
 	}
 
 	return nil
 }
 
+// TrackedFiles returns the files the next commit will contain, sorted by
+// path.
+func (i *Index) TrackedFiles() ([]TreeEntry, error) {
+	files, err := i.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make([]TreeEntry, 0, len(files))
+	for _, entry := range files {
+		tracked = append(tracked, entry)
+	}
+
+	slices.SortFunc(tracked, func(a, b TreeEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return tracked, nil
+}
+
+// UnmergedEntry is one version of a file left conflicted by a stopped
+// cherry-pick, revert or rebase. Stage 1 holds the version the change
+// was made from, stage 2 HEAD's and stage 3 the one the change makes.
+type UnmergedEntry struct {
+	TreeEntry
+	Stage int
+}
+
+// UnmergedFiles returns the versions of each conflicted file that has not
+// been resolved and staged yet, sorted by path and then stage. A version
+// is left out when that side does not have the file. There are none when
+// nothing is stopped on a conflict.
+func (i *Index) UnmergedFiles() ([]UnmergedEntry, error) {
+	sides, err := conflictSides()
+	if err != nil || sides == nil {
+		return nil, err
+	}
+
+	unresolved, err := i.unresolvedFiles(sides.Conflicts)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(unresolved)
+
+	entries := []UnmergedEntry{}
+	for _, name := range unresolved {
+		for n, files := range []map[filePath]TreeEntry{sides.Base, sides.Ours, sides.Theirs} {
+			if entry, ok := files[name]; ok {
+				entries = append(entries, UnmergedEntry{TreeEntry: entry, Stage: n + 1})
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// unresolvedFiles returns the conflicted files among names whose
+// resolution has not been staged: those that differ from what is staged,
+// or are staged but deleted.
+func (i *Index) unresolvedFiles(names []filePath) ([]filePath, error) {
+	staged, err := i.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	unresolved := []filePath{}
+	for _, name := range names {
+		entry, tracked := staged[name]
+
+		if _, err := os.Lstat(name); err != nil {
+			if tracked {
+				unresolved = append(unresolved, name)
+			}
+			continue
+		}
+
+		if differs, err := workingFileDiffers(name, entry); err != nil {
+			return nil, err
+		} else if !tracked || differs {
+			unresolved = append(unresolved, name)
+		}
+	}
+
+	return unresolved, nil
+}
+
+// UntrackedFiles walks the working directory for files that are not
+// tracked. It returns the files that are not ignored, or only the ignored
+// ones when ignored is set. Ignored directories are reported once, with a
+// trailing slash, rather than walked.
+func (i *Index) UntrackedFiles(ignored bool) ([]filePath, error) {
+	files, err := i.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return nil, fmt.Errorf("could not load ignore rules: %w", err)
+	}
+
+	untracked := []filePath{}
+
+	err = filepath.WalkDir(".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := cleanPath(p)
+		if name == "." {
+			return nil
+		}
+
+		if name == Repo {
+			return filepath.SkipDir
+		}
+
+		if rules.ignored(name, d.IsDir()) {
+			if ignored {
+				if d.IsDir() {
+					untracked = append(untracked, name+"/")
+				} else {
+					untracked = append(untracked, name)
+				}
+			}
+
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if _, ok := files[name]; !ok && !d.IsDir() && !ignored {
+			untracked = append(untracked, name)
+		}
+
+		return nil
+	})
+
+	return untracked, err
+}
+
 // TODO: Could do with work
 func GetIndex() (Index, error) {
 	indexPath, err := getIndexPath()
@@ -231,11 +645,9 @@ func GetIndex() (Index, error) {
 	index := Index{}
 	scanner := bufio.NewScanner(indexFile)
 	for scanner.Scan() {
-		entryParts := strings.Split(scanner.Text(), " ")
-		entry := indexEntry{
-			Id:     entryParts[1],
-			Name:   entryParts[2],
-			Status: entryParts[0],
+		entry, err := parseIndexEntry(scanner.Text())
+		if err != nil {
+			return Index{}, err
 		}
 
 		index.entries = append(index.entries, entry)
@@ -243,3 +655,25 @@ func GetIndex() (Index, error) {
 
 	return index, nil
 }
+
+// parseIndexEntry reads a "<status> <mode> <id> <name>" line. Indexes
+// written before modes were recorded hold "<status> <id> <name>" lines,
+// whose entries are read as regular files.
+func parseIndexEntry(line string) (indexEntry, error) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) == 4 && isFileMode(parts[1]) {
+		return indexEntry{Status: parts[0], Mode: parts[1], Id: parts[2], Name: parts[3]}, nil
+	}
+
+	parts = strings.SplitN(line, " ", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return indexEntry{}, fmt.Errorf("malformed index entry %q", line)
+	}
+
+	return indexEntry{Status: parts[0], Mode: MODE_FILE, Id: parts[1], Name: parts[2]}, nil
+}
+
+// isFileMode reports whether mode is one an index entry can have.
+func isFileMode(mode string) bool {
+	return mode == MODE_FILE || mode == MODE_EXECUTABLE || mode == MODE_SYMLINK
+}
@@ -0,0 +1,326 @@
+package got
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRemoveFile(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a")
+	writeTestFile(t, "src/b.txt", "b")
+	writeTestFile(t, "src/c.txt", "c")
+	commitTestFiles(t, "first", ".")
+
+	index, err := GetIndex()
+	if err != nil {
+		t.Fatalf("could not get index: %s", err)
+	}
+
+	if _, err = index.RemoveFile("src", false, false, false); err == nil {
+		t.Fatalf("removing a directory without recursive should fail")
+	}
+
+	writeTestFile(t, "a.txt", "changed")
+	if _, err = index.RemoveFile("a.txt", false, false, false); err == nil {
+		t.Fatalf("removing a file with unstaged changes should fail")
+	}
+
+	removed, err := index.RemoveFile("a.txt", true, false, false)
+	if err != nil {
+		t.Fatalf("could not remove a.txt from the index: %s", err)
+	}
+	if !slices.Equal(removed, []filePath{"a.txt"}) {
+		t.Fatalf("only a.txt should be removed, got %v", removed)
+	}
+	if _, err = os.Stat("a.txt"); err != nil {
+		t.Fatalf("--cached should keep a.txt in the working directory: %s", err)
+	}
+
+	if removed, err = index.RemoveFile("src", false, true, false); err != nil {
+		t.Fatalf("could not remove src: %s", err)
+	}
+	if !slices.Equal(removed, []filePath{"src/b.txt", "src/c.txt"}) {
+		t.Fatalf("src/b.txt and src/c.txt should be removed, got %v", removed)
+	}
+	if _, err = os.Stat("src"); !os.IsNotExist(err) {
+		t.Fatalf("src should be deleted from the working directory")
+	}
+
+	for _, entry := range index.Entries() {
+		if entry.Status != STATUS_DELETE {
+			t.Errorf("%s should be staged for deletion, got status %q", entry.Name, entry.Status)
+		}
+	}
+
+	if err = index.Save(); err != nil {
+		t.Fatalf("could not save index: %s", err)
+	}
+	if err = index.Commit("remove everything", CommitOptions{}); err != nil {
+		t.Fatalf("could not commit: %s", err)
+	}
+
+	entries, err := ListTree(HeadFile, true, nil)
+	if err != nil {
+		t.Fatalf("could not list tree: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("the commit should drop every removed path, got %v", entries)
+	}
+
+	untracked, err := index.UntrackedFiles(false)
+	if err != nil {
+		t.Fatalf("could not list untracked files: %s", err)
+	}
+	if !slices.Equal(untracked, []filePath{"a.txt"}) {
+		t.Fatalf("a.txt should be untracked after the commit, got %v", untracked)
+	}
+}
+
+func TestRemoveFileStagedContent(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "committed")
+	commitTestFiles(t, "first", "a.txt")
+
+	writeTestFile(t, "a.txt", "staged")
+	index := stageTestFiles(t, "a.txt")
+	writeTestFile(t, "a.txt", "working")
+
+	for _, cached := range []bool{false, true} {
+		if _, err := index.RemoveFile("a.txt", cached, false, false); err == nil || !strings.Contains(err.Error(), "staged content") {
+			t.Fatalf("removing staged content found in neither HEAD nor the file should fail with cached %v, got %v", cached, err)
+		}
+	}
+
+	if _, err := index.RemoveFile("a.txt", true, false, true); err != nil {
+		t.Fatalf("-f should remove a.txt anyway: %s", err)
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "working" {
+		t.Fatalf("--cached should keep the working file, got %q", content)
+	}
+}
+
+func TestLegacyIndex(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a")
+	commitTestFiles(t, "first", "a.txt")
+
+	writeTestFile(t, "a.txt", "changed")
+	writeTestFile(t, "my file.txt", "spaced")
+	stageTestFiles(t, "a.txt", "my file.txt")
+
+	// Write the index as it was before modes were recorded
+	indexPath := filepath.Join(Repo, IndexFile)
+	content, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatalf("could not read index: %s", err)
+	}
+	legacy := strings.ReplaceAll(string(content), " "+MODE_FILE+" ", " ")
+	writeTestFile(t, indexPath, legacy)
+
+	index, err := GetIndex()
+	if err != nil {
+		t.Fatalf("could not read an index without modes: %s", err)
+	}
+
+	names := []filePath{}
+	for _, entry := range index.Entries() {
+		if entry.Mode != MODE_FILE {
+			t.Errorf("%s should be read as a regular file, got mode %q", entry.Name, entry.Mode)
+		}
+		names = append(names, entry.Name)
+	}
+	if !slices.Equal(names, []filePath{"a.txt", "my file.txt"}) {
+		t.Fatalf("both entries should be read with their full names, got %v", names)
+	}
+
+	if err = index.Commit("second", CommitOptions{}); err != nil {
+		t.Fatalf("could not commit from an index without modes: %s", err)
+	}
+	if content, _ := readBlob(mustResolve(t, "HEAD:my file.txt")); string(content) != "spaced" {
+		t.Errorf("the commit should hold my file.txt, got %q", content)
+	}
+}
+
+func TestCommitAmend(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a")
+	commitTestFiles(t, "first", "a.txt")
+	first := mustResolve(t, HeadFile)
+
+	writeTestFile(t, "b.txt", "b")
+	commitTestFiles(t, "secnod", "b.txt")
+
+	original, err := readCommit(mustResolve(t, HeadFile))
+	if err != nil {
+		t.Fatalf("could not read commit: %s", err)
+	}
+
+	index, err := GetIndex()
+	if err != nil {
+		t.Fatalf("could not get index: %s", err)
+	}
+
+	if err = index.Commit("again", CommitOptions{}); !errors.Is(err, ErrNothingToCommit) {
+		t.Fatalf("a commit with no changes should be refused, got %v", err)
+	}
+
+	if err = index.Commit("second", CommitOptions{Amend: true}); err != nil {
+		t.Fatalf("could not amend: %s", err)
+	}
+
+	amended, err := readCommit(mustResolve(t, HeadFile))
+	if err != nil {
+		t.Fatalf("could not read commit: %s", err)
+	}
+
+	if amended.Id == original.Id || amended.Message != "second" {
+		t.Fatalf("the amended commit should have the new message, got %q", amended.Message)
+	}
+	if !slices.Equal(amended.Parents, []id{first}) || amended.Tree != original.Tree {
+		t.Fatalf("the amended commit should keep the parent and tree, got %v and %s", amended.Parents, amended.Tree)
+	}
+	if amended.Author != original.Author || !amended.AuthoredAt.Equal(original.AuthoredAt) {
+		t.Fatalf("the amended commit should keep the author")
+	}
+
+	writeTestFile(t, "c.txt", "c")
+	index = stageTestFiles(t, "c.txt")
+
+	if err = index.Commit("", CommitOptions{Amend: true}); err != nil {
+		t.Fatalf("could not amend: %s", err)
+	}
+
+	if _, err = ResolveRevision("HEAD:c.txt"); err != nil {
+		t.Fatalf("the amended commit should hold c.txt: %s", err)
+	}
+	if commit, _ := readCommit(mustResolve(t, HeadFile)); commit.Message != "second" {
+		t.Fatalf("amending without a message should keep it, got %q", commit.Message)
+	}
+
+	if err = index.Commit("empty", CommitOptions{AllowEmpty: true}); err != nil {
+		t.Fatalf("--allow-empty should allow a commit with no changes: %s", err)
+	}
+}
+
+func TestEditCommitMessage(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a")
+	writeTestFile(t, "template.txt", "Template subject\n# fill in the body\n")
+	writeTestFile(t, Repo+"/"+ConfigFile, "[commit]\n\ttemplate = template.txt\n")
+	index := stageTestFiles(t, "a.txt")
+
+	t.Setenv("EDITOR", "")
+	t.Setenv("GOT_EDITOR", "")
+	if _, err := index.EditCommitMessage("", false); err == nil {
+		t.Fatal("editing with no editor set should fail")
+	}
+
+	t.Setenv("GOT_EDITOR", `sh -c 'cp "$0" seen.txt && sed -i s/Template/Edited/ "$0"'`)
+
+	message, err := index.EditCommitMessage("", false)
+	if err != nil {
+		t.Fatalf("could not edit message: %s", err)
+	}
+
+	if message != "Edited subject" {
+		t.Fatalf("the message should be the edited template without comments, got %q", message)
+	}
+
+	seen, err := os.ReadFile("seen.txt")
+	if err != nil {
+		t.Fatalf("could not read what the editor saw: %s", err)
+	}
+
+	for _, want := range []string{"Template subject\n", "# On branch main\n", "# \tnew file:   a.txt\n"} {
+		if !strings.Contains(string(seen), want) {
+			t.Errorf("the message file should contain %q, got:\n%s", want, seen)
+		}
+	}
+
+	t.Setenv("GOT_EDITOR", `sh -c 'printf "# nothing\n" > "$0"'`)
+	if _, err = index.EditCommitMessage("", false); err == nil {
+		t.Fatal("an empty message should abort the commit")
+	}
+
+	writeTestFile(t, Repo+"/"+ConfigFile, "[commit]\n\ttemplate template.txt\n")
+	if _, err = index.EditCommitMessage("", false); err == nil || !strings.Contains(err.Error(), "template") {
+		t.Fatalf("a config the template cannot be read from should fail, got %v", err)
+	}
+}
+
+func TestUnmergedFiles(t *testing.T) {
+	initTestRepo(t)
+
+	unmerged := func() ([]UnmergedEntry, error) {
+		index, err := GetIndex()
+		if err != nil {
+			return nil, err
+		}
+		return index.UnmergedFiles()
+	}
+
+	writeTestFile(t, "a.txt", "a\n")
+	writeTestFile(t, "b.txt", "b\n")
+	commitTestFiles(t, "first", ".")
+	base := mustResolve(t, HeadFile)
+
+	if err := Checkout(HeadFile, "feature", false); err != nil {
+		t.Fatalf("could not create branch: %s", err)
+	}
+
+	writeTestFile(t, "b.txt", "feature\n")
+	commitTestFiles(t, "change b", "b.txt")
+	changeB := mustResolve(t, HeadFile)
+
+	if err := Checkout("main", "", false); err != nil {
+		t.Fatalf("could not check out main: %s", err)
+	}
+
+	writeTestFile(t, "b.txt", "main\n")
+	commitTestFiles(t, "main b", "b.txt")
+	main := mustResolve(t, HeadFile)
+
+	if entries, err := unmerged(); err != nil || len(entries) != 0 {
+		t.Fatalf("nothing should be unmerged before a conflict, got %+v, %v", entries, err)
+	}
+
+	if _, err := CherryPick([]string{changeB}); err == nil {
+		t.Fatalf("picking %s should conflict", changeB)
+	}
+
+	entries, err := unmerged()
+	if err != nil {
+		t.Fatalf("could not list unmerged files: %s", err)
+	}
+
+	want := []string{base, main, changeB}
+	if len(entries) != len(want) {
+		t.Fatalf("b.txt should have three stages, got %+v", entries)
+	}
+	for n, entry := range entries {
+		files, err := commitFiles(want[n])
+		if err != nil {
+			t.Fatalf("could not read %s: %s", want[n], err)
+		}
+		if entry.Name != "b.txt" || entry.Stage != n+1 || entry.Id != files["b.txt"].Id {
+			t.Errorf("stage %d should be b.txt from %s, got %+v", n+1, want[n], entry)
+		}
+	}
+
+	// Staging the resolution leaves nothing unmerged
+	writeTestFile(t, "b.txt", "both\n")
+	stageTestFiles(t, "b.txt")
+	if entries, err := unmerged(); err != nil || len(entries) != 0 {
+		t.Errorf("nothing should be unmerged once resolved, got %+v, %v", entries, err)
+	}
+}
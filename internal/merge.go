@@ -0,0 +1,305 @@
+package got
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// MergeConflictError is returned when changes could not be combined. The
+// conflicting files are left in the working directory with both sides
+// marked.
+type MergeConflictError struct {
+	Paths []filePath
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("conflicts in %s; fix them and stage the result", strings.Join(e.Paths, ", "))
+}
+
+// mergeResult is a merged set of files. Conflicts holds the working
+// directory content of each file that could not be merged cleanly, for
+// which Files keeps our version.
+type mergeResult struct {
+	Files     map[filePath]TreeEntry
+	Conflicts map[filePath][]byte
+}
+
+// mergeSides are the three versions of the files a merge that stopped on
+// conflicts was made from.
+type mergeSides struct {
+	Base, Ours, Theirs map[filePath]TreeEntry
+	Conflicts          []filePath
+}
+
+// conflictPaths returns the conflicting files, sorted.
+func (r *mergeResult) conflictPaths() []filePath {
+	paths := make([]filePath, 0, len(r.Conflicts))
+	for name := range r.Conflicts {
+		paths = append(paths, name)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// mergeTrees makes a three-way merge of the changes from base to ours and
+// from base to theirs. The labels name the sides in conflict markers.
+func mergeTrees(base, ours, theirs map[filePath]TreeEntry, oursLabel, theirsLabel string) (*mergeResult, error) {
+	result := &mergeResult{Files: map[filePath]TreeEntry{}, Conflicts: map[filePath][]byte{}}
+
+	names := map[filePath]bool{}
+	for _, files := range []map[filePath]TreeEntry{base, ours, theirs} {
+		for name := range files {
+			names[name] = true
+		}
+	}
+
+	for name := range names {
+		b, inBase := base[name]
+		o, inOurs := ours[name]
+		t, inTheirs := theirs[name]
+
+		switch {
+		case inOurs == inTheirs && (!inOurs || sameEntry(o, t)):
+			// Both sides agree
+		case inBase == inTheirs && (!inBase || sameEntry(b, t)):
+			// Only we changed it
+		case inBase == inOurs && (!inBase || sameEntry(b, o)):
+			// Only they changed it
+			o, inOurs = t, inTheirs
+		case !inOurs || !inTheirs:
+			// One side deleted what the other changed, so keep the change
+			kept := o
+			if !inOurs {
+				kept = t
+			}
+
+			content, err := readBlob(kept.Id)
+			if err != nil {
+				return nil, err
+			}
+			result.Conflicts[name] = content
+		default:
+			merged, err := mergeEntries(b, o, t, oursLabel, theirsLabel)
+			if err != nil {
+				return nil, err
+			}
+
+			if merged.conflict {
+				result.Conflicts[name] = merged.content
+				break
+			}
+			o = merged.entry
+		}
+
+		if inOurs {
+			result.Files[name] = o
+		}
+	}
+
+	return result, nil
+}
+
+type mergedEntry struct {
+	entry    TreeEntry
+	content  []byte
+	conflict bool
+}
+
+// mergeEntries merges a file both sides changed, taking its content and
+// its mode separately: a side that left either alone takes the other's.
+// Modes changed differently on both sides conflict, as does content
+// changed on both sides of a symlink, whose target has no lines to merge.
+// An empty base merges two independently added files.
+func mergeEntries(b, o, t TreeEntry, oursLabel, theirsLabel string) (*mergedEntry, error) {
+	merged := &mergedEntry{entry: o}
+
+	switch {
+	case o.Mode == t.Mode, b.Mode == t.Mode:
+	case b.Mode == o.Mode:
+		merged.entry.Mode = t.Mode
+	default:
+		merged.conflict = true
+	}
+
+	switch {
+	case o.Id == t.Id, b.Id == t.Id:
+	case b.Id == o.Id:
+		merged.entry.Id = t.Id
+	case o.Mode == MODE_SYMLINK || t.Mode == MODE_SYMLINK:
+		merged.conflict = true
+	default:
+		blob, err := mergeBlobs(b.Id, o.Id, t.Id, oursLabel, theirsLabel)
+		if err != nil {
+			return nil, err
+		}
+
+		if blob.conflict {
+			merged.content, merged.conflict = blob.content, true
+			return merged, nil
+		}
+
+		blobId, err := HashObject(bytes.NewReader(blob.content), BLOB, true)
+		if err != nil {
+			return nil, err
+		}
+		merged.entry.Id = blobId
+	}
+
+	if merged.conflict {
+		content, err := readBlob(merged.entry.Id)
+		if err != nil {
+			return nil, err
+		}
+		merged.content = content
+	}
+
+	return merged, nil
+}
+
+type mergedBlob struct {
+	content  []byte
+	conflict bool
+}
+
+// mergeBlobs merges the changes made to the base blob by ours and theirs
+// line by line. An empty base id merges two independently added files.
+func mergeBlobs(baseId, oursId, theirsId id, oursLabel, theirsLabel string) (*mergedBlob, error) {
+	sides := [3][]string{}
+	for i, blobId := range []id{baseId, oursId, theirsId} {
+		if blobId == "" {
+			continue
+		}
+
+		content, err := readBlob(blobId)
+		if err != nil {
+			return nil, err
+		}
+		sides[i] = splitLines(content)
+	}
+
+	lines, conflict := mergeLines(sides[0], sides[1], sides[2], oursLabel, theirsLabel)
+	return &mergedBlob{content: []byte(strings.Join(lines, "")), conflict: conflict}, nil
+}
+
+// mergeLines is a diff3 style merge. It walks the base lines that both
+// sides left alone; between them, a chunk changed on one side takes that
+// side, and a chunk changed differently on both is a conflict, written out
+// between markers.
+func mergeLines(base, ours, theirs []string, oursLabel, theirsLabel string) ([]string, bool) {
+	inOurs := matchedLines(base, ours)
+	inTheirs := matchedLines(base, theirs)
+
+	merged := []string{}
+	conflict := false
+
+	i, o, t := 0, 0, 0
+	for {
+		// Copy the lines all three agree on
+		for i < len(base) && inOurs[i] == o && inTheirs[i] == t {
+			merged = append(merged, base[i])
+			i, o, t = i+1, o+1, t+1
+		}
+
+		// Find where they next agree, or the end of all three
+		next := i
+		for next < len(base) && (inOurs[next] < 0 || inTheirs[next] < 0) {
+			next++
+		}
+
+		oEnd, tEnd := len(ours), len(theirs)
+		if next < len(base) {
+			oEnd, tEnd = inOurs[next], inTheirs[next]
+		}
+
+		baseChunk, oursChunk, theirsChunk := base[i:next], ours[o:oEnd], theirs[t:tEnd]
+
+		switch {
+		case slices.Equal(oursChunk, theirsChunk), slices.Equal(theirsChunk, baseChunk):
+			merged = append(merged, oursChunk...)
+		case slices.Equal(oursChunk, baseChunk):
+			merged = append(merged, theirsChunk...)
+		default:
+			conflict = true
+			merged = append(merged, "<<<<<<< "+oursLabel+"\n")
+			merged = appendConflictLines(merged, oursChunk)
+			merged = append(merged, "=======\n")
+			merged = appendConflictLines(merged, theirsChunk)
+			merged = append(merged, ">>>>>>> "+theirsLabel+"\n")
+		}
+
+		if next >= len(base) {
+			return merged, conflict
+		}
+
+		i, o, t = next, oEnd, tEnd
+	}
+}
+
+// matchedLines maps each base line to the line of other it is kept as, or
+// -1 when other changed or dropped it.
+func matchedLines(base, other []string) []int {
+	matched := make([]int, len(base))
+	for i := range matched {
+		matched[i] = -1
+	}
+
+	for _, edit := range diffLines(base, other) {
+		if edit.Op == diffEqual {
+			matched[edit.Old] = edit.New
+		}
+	}
+
+	return matched
+}
+
+// appendConflictLines adds one side of a conflict, making sure a last line
+// without a newline does not run into the marker after it.
+func appendConflictLines(merged, lines []string) []string {
+	merged = append(merged, lines...)
+	if n := len(merged); n > 0 && !strings.HasSuffix(merged[n-1], "\n") {
+		merged[n-1] += "\n"
+	}
+	return merged
+}
+
+// applyMerge writes a merge result into the working directory, where ours
+// holds the files it was made against. Like checkout it refuses, before
+// touching anything, to overwrite local changes.
+func applyMerge(ours map[filePath]TreeEntry, result *mergeResult) error {
+	conflicts := []filePath{}
+	for name := range result.Conflicts {
+		entry, tracked := ours[name]
+		if !tracked {
+			if _, err := os.Lstat(name); err == nil {
+				conflicts = append(conflicts, name)
+			}
+			continue
+		}
+
+		if modified, err := workingFileDiffers(name, entry); err != nil {
+			return err
+		} else if modified {
+			conflicts = append(conflicts, name)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		slices.Sort(conflicts)
+		return fmt.Errorf("local changes would be overwritten: %s", strings.Join(conflicts, ", "))
+	}
+
+	if err := updateWorkingTree(ours, result.Files); err != nil {
+		return err
+	}
+
+	for name, content := range result.Conflicts {
+		if err := writeWorkingContent(name, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package got
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := splitLines([]byte("a\nb\nc\nd\n"))
+	b := splitLines([]byte("a\nc\nx\nd\ny"))
+
+	edits := diffLines(a, b)
+
+	rebuilt := []string{}
+	deleted := []string{}
+	for _, edit := range edits {
+		switch edit.Op {
+		case diffEqual:
+			if a[edit.Old] != b[edit.New] {
+				t.Errorf("equal edit pairs %q with %q", a[edit.Old], b[edit.New])
+			}
+			rebuilt = append(rebuilt, b[edit.New])
+		case diffInsert:
+			rebuilt = append(rebuilt, b[edit.New])
+		case diffDelete:
+			deleted = append(deleted, a[edit.Old])
+		}
+	}
+
+	if got := strings.Join(rebuilt, ""); got != "a\nc\nx\nd\ny" {
+		t.Errorf("edits should rebuild the new lines, got %q", got)
+	}
+
+	if len(edits) != 6 || strings.Join(deleted, "") != "b\n" {
+		t.Errorf("the shortest script keeps a, c and d and deletes b, got %v", edits)
+	}
+}
+
+func TestDiffLinesEdits(t *testing.T) {
+	cases := []struct {
+		a, b  string
+		edits int
+	}{
+		{"", "", 0},
+		{"", "a\nb\n", 2},
+		{"a\nb\n", "", 2},
+		{"a\nb\nc\n", "x\ny\nz\n", 6},
+		{"a\nb\nc\n", "a\nb\nc\n", 0},
+		{strings.Repeat("same\n", 500) + "old\n", strings.Repeat("same\n", 500) + "new\n", 2},
+	}
+
+	for _, c := range cases {
+		a, b := splitLines([]byte(c.a)), splitLines([]byte(c.b))
+
+		before, after, changes := []string{}, []string{}, 0
+		for _, edit := range diffLines(a, b) {
+			switch edit.Op {
+			case diffEqual:
+				before, after = append(before, a[edit.Old]), append(after, b[edit.New])
+			case diffInsert:
+				after, changes = append(after, b[edit.New]), changes+1
+			case diffDelete:
+				before, changes = append(before, a[edit.Old]), changes+1
+			}
+		}
+
+		if strings.Join(before, "") != c.a || strings.Join(after, "") != c.b {
+			t.Errorf("diffing %q and %q should cover both, got %q and %q", c.a, c.b, before, after)
+		}
+		if changes != c.edits {
+			t.Errorf("diffing %q and %q should take %d edits, got %d", c.a, c.b, c.edits, changes)
+		}
+	}
+}
+
+func TestMergeLines(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\nfive\n"
+
+	cases := []struct {
+		name, ours, theirs, want string
+		conflict                 bool
+	}{
+		{"separate changes", "ONE\ntwo\nthree\nfour\nfive\n", "one\ntwo\nthree\nfour\nFIVE\n", "ONE\ntwo\nthree\nfour\nFIVE\n", false},
+		{"same change", "one\nTWO\nthree\nfour\nfive\n", "one\nTWO\nthree\nfour\nfive\n", "one\nTWO\nthree\nfour\nfive\n", false},
+		{"insert and delete", "one\ntwo\nthree\nthree and a half\nfour\nfive\n", "two\nthree\nfour\nfive\n", "two\nthree\nthree and a half\nfour\nfive\n", false},
+		{"conflict", "one\nours\nthree\nfour\nfive\n", "one\ntheirs\nthree\nfour\nfive\n", "one\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\nthree\nfour\nfive\n", true},
+	}
+
+	for _, c := range cases {
+		lines, conflict := mergeLines(splitLines([]byte(base)), splitLines([]byte(c.ours)), splitLines([]byte(c.theirs)), "ours", "theirs")
+
+		if got := strings.Join(lines, ""); got != c.want || conflict != c.conflict {
+			t.Errorf("%s: merged to %q (conflict %v), want %q (conflict %v)", c.name, got, conflict, c.want, c.conflict)
+		}
+	}
+}
+
+func TestMergeTreesModes(t *testing.T) {
+	initTestRepo(t)
+
+	blob := func(content string) id {
+		blobId, err := HashObject(strings.NewReader(content), BLOB, true)
+		if err != nil {
+			t.Fatalf("could not write blob: %s", err)
+		}
+		return blobId
+	}
+
+	base, ours, theirs := blob("one\ntwo\nthree\n"), blob("ONE\ntwo\nthree\n"), blob("one\ntwo\nTHREE\n")
+	merged := blob("ONE\ntwo\nTHREE\n")
+
+	cases := []struct {
+		name               string
+		base, ours, theirs TreeEntry
+		want               TreeEntry
+		conflict           bool
+	}{
+		{"mode changed by them", TreeEntry{Mode: MODE_FILE, Id: base}, TreeEntry{Mode: MODE_FILE, Id: base}, TreeEntry{Mode: MODE_EXECUTABLE, Id: base}, TreeEntry{Mode: MODE_EXECUTABLE, Id: base}, false},
+		{"mode changed by us", TreeEntry{Mode: MODE_FILE, Id: base}, TreeEntry{Mode: MODE_EXECUTABLE, Id: base}, TreeEntry{Mode: MODE_FILE, Id: base}, TreeEntry{Mode: MODE_EXECUTABLE, Id: base}, false},
+		{"mode changed by us, content by them", TreeEntry{Mode: MODE_FILE, Id: base}, TreeEntry{Mode: MODE_EXECUTABLE, Id: base}, TreeEntry{Mode: MODE_FILE, Id: theirs}, TreeEntry{Mode: MODE_EXECUTABLE, Id: theirs}, false},
+		{"mode changed by them, content by both", TreeEntry{Mode: MODE_FILE, Id: base}, TreeEntry{Mode: MODE_FILE, Id: ours}, TreeEntry{Mode: MODE_EXECUTABLE, Id: theirs}, TreeEntry{Mode: MODE_EXECUTABLE, Id: merged}, false},
+		{"same mode change", TreeEntry{Mode: MODE_FILE, Id: base}, TreeEntry{Mode: MODE_EXECUTABLE, Id: ours}, TreeEntry{Mode: MODE_EXECUTABLE, Id: base}, TreeEntry{Mode: MODE_EXECUTABLE, Id: ours}, false},
+		{"different mode changes", TreeEntry{Mode: MODE_EXECUTABLE, Id: base}, TreeEntry{Mode: MODE_FILE, Id: base}, TreeEntry{Mode: MODE_SYMLINK, Id: base}, TreeEntry{}, true},
+		{"added with different modes", TreeEntry{}, TreeEntry{Mode: MODE_FILE, Id: base}, TreeEntry{Mode: MODE_EXECUTABLE, Id: base}, TreeEntry{}, true},
+	}
+
+	for _, c := range cases {
+		sides := [3]map[filePath]TreeEntry{}
+		for n, entry := range []TreeEntry{c.base, c.ours, c.theirs} {
+			sides[n] = map[filePath]TreeEntry{}
+			if entry.Id != "" {
+				entry.Type, entry.Name = BLOB, "a.txt"
+				sides[n]["a.txt"] = entry
+			}
+		}
+
+		result, err := mergeTrees(sides[0], sides[1], sides[2], "ours", "theirs")
+		if err != nil {
+			t.Fatalf("%s: could not merge: %s", c.name, err)
+		}
+
+		if _, conflict := result.Conflicts["a.txt"]; conflict != c.conflict {
+			t.Errorf("%s: conflict should be %v, got %v", c.name, c.conflict, conflict)
+		}
+
+		if got := result.Files["a.txt"]; !c.conflict && !sameEntry(got, c.want) {
+			t.Errorf("%s: should merge to %s %s, got %s %s", c.name, c.want.Mode, c.want.Id, got.Mode, got.Id)
+		}
+	}
+}
+
+func TestCherryPickModeChange(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "run.sh", "echo run\n")
+	commitTestFiles(t, "first", "run.sh")
+
+	if err := Checkout(HeadFile, "feature", false); err != nil {
+		t.Fatalf("could not create branch: %s", err)
+	}
+
+	if err := os.Chmod("run.sh", 0755); err != nil {
+		t.Fatalf("could not make run.sh executable: %s", err)
+	}
+	commitTestFiles(t, "make run.sh executable", "run.sh")
+	chmod := mustResolve(t, HeadFile)
+
+	if err := Checkout("main", "", false); err != nil {
+		t.Fatalf("could not check out main: %s", err)
+	}
+
+	results, err := CherryPick([]string{chmod})
+	if err != nil || len(results) != 1 || results[0].Commit == "" {
+		t.Fatalf("the mode change should be picked, got %+v, %v", results, err)
+	}
+
+	files, err := commitFiles(results[0].Commit)
+	if err != nil {
+		t.Fatalf("could not read the picked commit: %s", err)
+	}
+	if files["run.sh"].Mode != MODE_EXECUTABLE {
+		t.Errorf("run.sh should be committed as %s, got %s", MODE_EXECUTABLE, files["run.sh"].Mode)
+	}
+
+	if mode, err := workingFileMode("run.sh"); err != nil || mode != MODE_EXECUTABLE {
+		t.Errorf("run.sh should be made executable, got %s (%v)", mode, err)
+	}
+}
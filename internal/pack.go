@@ -0,0 +1,841 @@
+package got
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A pack holds many objects in one file. It starts with a header of
+// "PACK", a version and the object count, then each object as a type and
+// size header followed by its zlib compressed content, and ends with the
+// SHA-1 of everything before it, which also names the pack.
+//
+// The pack's index holds a fan-out table, where entry n counts the objects
+// whose first id byte is at most n, then the sorted object ids, the offset
+// of each object in the pack, the pack's checksum and its own checksum.
+// Finding an object is a binary search within its fan-out bucket.
+const (
+	packSignature = "PACK"
+	packVersion   = 2
+	idxSignature  = "\377tOc"
+	idxVersion    = 2
+)
+
+var packTypeCodes = map[objectType]byte{COMMIT: 1, TREE: 2, BLOB: 3}
+
+// Delta entries are stored against a base either earlier in the same pack,
+// given by its distance back from the delta (OFS), or named by id (REF).
+const (
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+type packIndex struct {
+	packPath filePath
+	fanout   [256]uint32
+	ids      []byte
+	offsets  []uint64
+	// repo holds the pack, and any REF delta bases the pack lacks
+	repo *repository
+}
+
+// packCache holds the indexes of the packs in one objects directory, and is
+// reloaded whenever the pack directory changes.
+var packCache struct {
+	sync.Mutex
+	dir     filePath
+	modTime time.Time
+	packs   []*packIndex
+}
+
+func getPackDirPath() (filePath, error) {
+	objectDb, err := getObjectsDirPath()
+	if err != nil {
+		return "", fmt.Errorf("could not get object directory path: %w", err)
+	}
+	return filepath.Join(objectDb, PackDir), nil
+}
+
+// loadPackIndexes returns the index of every pack in the repository.
+func loadPackIndexes() ([]*packIndex, error) {
+	return workingRepo.loadPackIndexes()
+}
+
+func (r *repository) loadPackIndexes() ([]*packIndex, error) {
+	dir, err := r.path(ObjectsDir, PackDir)
+	if err != nil {
+		return nil, err
+	}
+
+	packCache.Lock()
+	defer packCache.Unlock()
+
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if packCache.dir == dir && packCache.modTime.Equal(info.ModTime()) {
+		return packCache.packs, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The cache is shared, so the packs name the repository by its path
+	// rather than as r, which may be the working directory's
+	repo := &repository{dir: filepath.Dir(filepath.Dir(dir))}
+
+	packs := []*packIndex{}
+	for _, file := range files {
+		pack, err := readPackIndex(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not read pack index %s: %w", filepath.Base(file), err)
+		}
+		pack.repo = repo
+		packs = append(packs, pack)
+	}
+
+	packCache.dir, packCache.modTime, packCache.packs = dir, info.ModTime(), packs
+
+	return packs, nil
+}
+
+func forgetPackIndexes() {
+	packCache.Lock()
+	defer packCache.Unlock()
+
+	packCache.dir, packCache.packs = "", nil
+}
+
+func readPackIndex(path filePath) (*packIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	headerSize := len(idxSignature) + 4 + 256*4
+	if len(data) < headerSize+2*sha1.Size || string(data[:len(idxSignature)]) != idxSignature {
+		return nil, errors.New("not a pack index")
+	}
+
+	body, sum := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if actual := sha1.Sum(body); !bytes.Equal(actual[:], sum) {
+		return nil, errors.New("pack index checksum mismatch")
+	}
+
+	if version := binary.BigEndian.Uint32(data[4:8]); version != idxVersion {
+		return nil, fmt.Errorf("unsupported pack index version %d", version)
+	}
+
+	pack := &packIndex{packPath: strings.TrimSuffix(path, ".idx") + ".pack"}
+	for i := range pack.fanout {
+		pack.fanout[i] = binary.BigEndian.Uint32(data[8+i*4:])
+	}
+
+	count := int(pack.fanout[255])
+	if len(data) != headerSize+count*(sha1.Size+8)+2*sha1.Size {
+		return nil, errors.New("pack index has the wrong size")
+	}
+
+	pack.ids = data[headerSize : headerSize+count*sha1.Size]
+
+	offsets := data[headerSize+count*sha1.Size:]
+	pack.offsets = make([]uint64, count)
+	for i := range pack.offsets {
+		pack.offsets[i] = binary.BigEndian.Uint64(offsets[i*8:])
+	}
+
+	return pack, nil
+}
+
+func (p *packIndex) count() int {
+	return len(p.offsets)
+}
+
+func (p *packIndex) rawId(i int) []byte {
+	return p.ids[i*sha1.Size : (i+1)*sha1.Size]
+}
+
+func (p *packIndex) idAt(i int) id {
+	return hex.EncodeToString(p.rawId(i))
+}
+
+// bucket returns the range of positions holding ids that start with b.
+func (p *packIndex) bucket(b byte) (lo, hi int) {
+	if b > 0 {
+		lo = int(p.fanout[b-1])
+	}
+	return lo, int(p.fanout[b])
+}
+
+// find returns the offset of the object in the pack.
+func (p *packIndex) find(objId id) (uint64, bool) {
+	raw, err := hex.DecodeString(objId)
+	if err != nil || len(raw) != sha1.Size {
+		return 0, false
+	}
+
+	lo, hi := p.bucket(raw[0])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.rawId(lo+i), raw) >= 0
+	})
+
+	if i < hi && bytes.Equal(p.rawId(i), raw) {
+		return p.offsets[i], true
+	}
+
+	return 0, false
+}
+
+// findPrefix returns the ids in the pack that start with prefix.
+func (p *packIndex) findPrefix(prefix string) []id {
+	first, err := hex.DecodeString(prefix[:2])
+	if err != nil {
+		return nil
+	}
+
+	lo, hi := p.bucket(first[0])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return p.idAt(lo+i) >= prefix
+	})
+
+	ids := []id{}
+	for ; i < hi && strings.HasPrefix(p.idAt(i), prefix); i++ {
+		ids = append(ids, p.idAt(i))
+	}
+
+	return ids
+}
+
+func (p *packIndex) allIds() []id {
+	ids := make([]id, p.count())
+	for i := range ids {
+		ids[i] = p.idAt(i)
+	}
+	return ids
+}
+
+// packedObjectExists reports whether any pack holds the object.
+func packedObjectExists(objId id) (bool, error) {
+	return workingRepo.packedObjectExists(objId)
+}
+
+func (r *repository) packedObjectExists(objId id) (bool, error) {
+	packs, err := r.loadPackIndexes()
+	if err != nil {
+		return false, err
+	}
+
+	for _, pack := range packs {
+		if _, ok := pack.find(objId); ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// readPackedObjectData returns the serialised form of a packed object.
+func readPackedObjectData(objId id) ([]byte, error) {
+	return workingRepo.readPackedObjectData(objId)
+}
+
+func (r *repository) readPackedObjectData(objId id) ([]byte, error) {
+	packs, err := r.loadPackIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pack := range packs {
+		offset, ok := pack.find(objId)
+		if !ok {
+			continue
+		}
+
+		t, content, err := pack.readEntry(offset)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s from %s: %w", objId, filepath.Base(pack.packPath), err)
+		}
+
+		return append([]byte(fmt.Sprintf("%v %d\n", t, len(content))), content...), nil
+	}
+
+	return nil, fmt.Errorf("could not find object file for %q", objId)
+}
+
+// readEntry reads the object stored at offset in the pack, resolving it
+// against its base when it is stored as a delta.
+func (p *packIndex) readEntry(offset uint64) (objectType, []byte, error) {
+	file, err := os.Open(p.packPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	return p.readEntryFrom(file, offset, 0)
+}
+
+func (p *packIndex) readEntryFrom(file *os.File, offset uint64, depth int) (objectType, []byte, error) {
+	if depth > maxDeltaDepth {
+		return "", nil, errors.New("delta chain is too long")
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(file, int64(offset), math.MaxInt64-int64(offset)))
+
+	code, size, err := readPackEntryHeader(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var t objectType
+	var base []byte
+
+	switch code {
+	case packOfsDelta:
+		distance, err := readOffsetDistance(r)
+		if err != nil {
+			return "", nil, err
+		}
+		if distance == 0 || distance > offset {
+			return "", nil, fmt.Errorf("delta base offset %d is out of range", distance)
+		}
+
+		if t, base, err = p.readEntryFrom(file, offset-distance, depth+1); err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		raw := make([]byte, sha1.Size)
+		if _, err = io.ReadFull(r, raw); err != nil {
+			return "", nil, err
+		}
+
+		baseId := hex.EncodeToString(raw)
+		if baseOffset, ok := p.find(baseId); ok {
+			t, base, err = p.readEntryFrom(file, baseOffset, depth+1)
+		} else {
+			t, base, err = p.repo.readObject(baseId)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("could not read delta base %s: %w", baseId, err)
+		}
+	default:
+		for name, c := range packTypeCodes {
+			if c == code {
+				t = name
+			}
+		}
+		if t == "" {
+			return "", nil, fmt.Errorf("unknown pack entry type %d", code)
+		}
+	}
+
+	content, err := inflate(r, size)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if base != nil {
+		if content, err = applyDelta(base, content); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return t, content, nil
+}
+
+// readOffsetDistance reads how far back an OFS delta's base starts. Each
+// byte holds seven bits, most significant first, and every continuation
+// adds one so that no distance has two encodings.
+func readOffsetDistance(r io.ByteReader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	distance := uint64(b & 0x7f)
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		distance = (distance+1)<<7 | uint64(b&0x7f)
+	}
+
+	return distance, nil
+}
+
+func appendOffsetDistance(buf []byte, distance uint64) []byte {
+	encoded := []byte{byte(distance & 0x7f)}
+	for distance >>= 7; distance > 0; distance >>= 7 {
+		distance--
+		encoded = append([]byte{byte(distance&0x7f) | 0x80}, encoded...)
+	}
+	return append(buf, encoded...)
+}
+
+// readPackEntryHeader reads an entry's type and size: the first byte holds
+// three bits of type and the low four bits of size, and while a byte's top
+// bit is set the next holds seven more bits of size.
+func readPackEntryHeader(r io.ByteReader) (code byte, size uint64, err error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	code = (b >> 4) & 7
+	size = uint64(b & 0x0f)
+
+	for shift := 4; b&0x80 != 0; shift += 7 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= uint64(b&0x7f) << shift
+	}
+
+	return code, size, nil
+}
+
+func writePackEntryHeader(w io.Writer, code byte, size uint64) error {
+	b := code<<4 | byte(size&0x0f)
+	size >>= 4
+
+	header := []byte{}
+	for size > 0 {
+		header = append(header, b|0x80)
+		b = byte(size & 0x7f)
+		size >>= 7
+	}
+	header = append(header, b)
+
+	_, err := w.Write(header)
+	return err
+}
+
+// inflate decompresses one zlib stream of the expected size from r.
+func inflate(r io.Reader, size uint64) ([]byte, error) {
+	decompressor, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressor.Close()
+
+	content, err := io.ReadAll(decompressor)
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(len(content)) != size {
+		return nil, fmt.Errorf("entry claims %d bytes but has %d", size, len(content))
+	}
+
+	return content, nil
+}
+
+func deflate(content []byte) ([]byte, error) {
+	var b bytes.Buffer
+	compressor := zlib.NewWriter(&b)
+
+	if _, err := compressor.Write(content); err != nil {
+		return nil, err
+	}
+
+	if err := compressor.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// encodedPack is a pack in memory, along with the offset of each object
+// within it and how many objects were stored as deltas.
+type encodedPack struct {
+	data    []byte
+	offsets map[id]uint64
+	deltas  int
+}
+
+// encodePack serialises the objects in pack format, storing objects as
+// deltas against similar ones where that saves space. Names, which may be
+// nil, hint at which objects are versions of the same file.
+func encodePack(ids []id, names map[id]string) (*encodedPack, error) {
+	return workingRepo.encodePack(ids, names)
+}
+
+func (r *repository) encodePack(ids []id, names map[id]string) (*encodedPack, error) {
+	objects := make([]*packObject, 0, len(ids))
+	for _, objId := range ids {
+		t, content, err := r.readObject(objId)
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, &packObject{Id: objId, Type: t, Name: names[objId], Content: content})
+	}
+
+	pack := &encodedPack{offsets: make(map[id]uint64, len(ids))}
+	pack.deltas = chooseDeltas(objects)
+
+	var b bytes.Buffer
+	b.WriteString(packSignature)
+	binary.Write(&b, binary.BigEndian, uint32(packVersion))
+	binary.Write(&b, binary.BigEndian, uint32(len(objects)))
+
+	for _, obj := range objects {
+		offset := uint64(b.Len())
+		pack.offsets[obj.Id] = offset
+
+		code, content := packTypeCodes[obj.Type], obj.Content
+		if obj.base != nil {
+			code, content = packOfsDelta, obj.delta
+		}
+
+		if err := writePackEntryHeader(&b, code, uint64(len(content))); err != nil {
+			return nil, err
+		}
+
+		if obj.base != nil {
+			b.Write(appendOffsetDistance(nil, offset-pack.offsets[obj.base.Id]))
+		}
+
+		compressed, err := deflate(content)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(compressed)
+	}
+
+	sum := sha1.Sum(b.Bytes())
+	b.Write(sum[:])
+	pack.data = b.Bytes()
+
+	return pack, nil
+}
+
+// storePack writes a pack and its index into the pack directory, naming
+// them after the pack's checksum, and returns the pack's path.
+func storePack(pack []byte, offsets map[id]uint64) (filePath, error) {
+	return workingRepo.storePack(pack, offsets)
+}
+
+func (r *repository) storePack(pack []byte, offsets map[id]uint64) (filePath, error) {
+	dir, err := r.path(ObjectsDir, PackDir)
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+
+	sum := pack[len(pack)-sha1.Size:]
+	name := filepath.Join(dir, "pack-"+hex.EncodeToString(sum))
+
+	// Packs are named after their content, so an existing one is identical
+	if _, err = os.Stat(name + ".pack"); err != nil {
+		if err = os.WriteFile(name+".pack", pack, 0444); err != nil {
+			return "", err
+		}
+	}
+
+	if err = writePackIndex(name+".idx", offsets, sum); err != nil {
+		return "", err
+	}
+
+	forgetPackIndexes()
+
+	return name + ".pack", nil
+}
+
+// indexPack reads a pack received from elsewhere entry by entry, checking
+// it as it goes, and returns the offset of each object in it. Delta bases
+// may be earlier in the pack or, by id, already in the repository.
+func indexPack(pack []byte) (map[id]uint64, error) {
+	return workingRepo.indexPack(pack)
+}
+
+func (r *repository) indexPack(pack []byte) (map[id]uint64, error) {
+	headerSize := len(packSignature) + 8
+	if len(pack) < headerSize+sha1.Size || string(pack[:len(packSignature)]) != packSignature {
+		return nil, errors.New("not a pack")
+	}
+
+	body, sum := pack[:len(pack)-sha1.Size], pack[len(pack)-sha1.Size:]
+	if actual := sha1.Sum(body); !bytes.Equal(actual[:], sum) {
+		return nil, errors.New("pack checksum mismatch")
+	}
+
+	if version := binary.BigEndian.Uint32(pack[4:8]); version != packVersion {
+		return nil, fmt.Errorf("unsupported pack version %d", version)
+	}
+
+	count := binary.BigEndian.Uint32(pack[8:12])
+
+	type entry struct {
+		t       objectType
+		content []byte
+	}
+
+	offsets := make(map[id]uint64, count)
+	entries := map[uint64]entry{}
+
+	// A bytes.Reader is a ByteReader, so inflating an entry reads no
+	// further than its end
+	reader := bytes.NewReader(body[headerSize:])
+	for n := uint32(0); n < count; n++ {
+		offset := uint64(len(body) - reader.Len())
+
+		code, size, err := readPackEntryHeader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("could not read entry %d: %w", n, err)
+		}
+
+		var base *entry
+		switch code {
+		case packOfsDelta:
+			distance, err := readOffsetDistance(reader)
+			if err != nil {
+				return nil, err
+			}
+			if distance == 0 || distance > offset {
+				return nil, fmt.Errorf("delta base offset %d is out of range", distance)
+			}
+
+			b, ok := entries[offset-distance]
+			if !ok {
+				return nil, fmt.Errorf("entry %d has no delta base at offset %d", n, offset-distance)
+			}
+			base = &b
+		case packRefDelta:
+			raw := make([]byte, sha1.Size)
+			if _, err = io.ReadFull(reader, raw); err != nil {
+				return nil, err
+			}
+
+			baseId := hex.EncodeToString(raw)
+			if baseOffset, ok := offsets[baseId]; ok {
+				b := entries[baseOffset]
+				base = &b
+			} else {
+				t, content, err := r.readObject(baseId)
+				if err != nil {
+					return nil, fmt.Errorf("could not read delta base %s: %w", baseId, err)
+				}
+				base = &entry{t, content}
+			}
+		}
+
+		content, err := inflate(reader, size)
+		if err != nil {
+			return nil, fmt.Errorf("could not inflate entry %d: %w", n, err)
+		}
+
+		e := entry{content: content}
+		if base != nil {
+			e.t = base.t
+			if e.content, err = applyDelta(base.content, content); err != nil {
+				return nil, fmt.Errorf("could not apply delta for entry %d: %w", n, err)
+			}
+		} else {
+			for name, c := range packTypeCodes {
+				if c == code {
+					e.t = name
+				}
+			}
+			if e.t == "" {
+				return nil, fmt.Errorf("unknown pack entry type %d", code)
+			}
+		}
+
+		objId, _, err := hashReader(bytes.NewReader(e.content), e.t)
+		if err != nil {
+			return nil, err
+		}
+
+		offsets[objId] = offset
+		entries[offset] = e
+	}
+
+	if reader.Len() != 0 {
+		return nil, fmt.Errorf("pack has %d bytes after its last entry", reader.Len())
+	}
+
+	return offsets, nil
+}
+
+func writePackIndex(path filePath, offsets map[id]uint64, packSum []byte) error {
+	ids := make([]id, 0, len(offsets))
+	for objId := range offsets {
+		ids = append(ids, objId)
+	}
+	slices.Sort(ids)
+
+	var idx bytes.Buffer
+	idx.WriteString(idxSignature)
+	binary.Write(&idx, binary.BigEndian, uint32(idxVersion))
+
+	var fanout [256]uint32
+	for _, objId := range ids {
+		raw, err := hex.DecodeString(objId)
+		if err != nil {
+			return fmt.Errorf("invalid object id %q: %w", objId, err)
+		}
+		for b := int(raw[0]); b < len(fanout); b++ {
+			fanout[b]++
+		}
+	}
+	binary.Write(&idx, binary.BigEndian, fanout)
+
+	for _, objId := range ids {
+		raw, _ := hex.DecodeString(objId)
+		idx.Write(raw)
+	}
+
+	for _, objId := range ids {
+		binary.Write(&idx, binary.BigEndian, offsets[objId])
+	}
+
+	idx.Write(packSum)
+	sum := sha1.Sum(idx.Bytes())
+	idx.Write(sum[:])
+
+	// Write then rename so readers never see a partial index
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, idx.Bytes(), 0444); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// RepackResult describes what Repack did.
+type RepackResult struct {
+	Pack     filePath
+	Packed   int
+	Deltas   int
+	Loosened int
+	Removed  int
+}
+
+// Repack writes every reachable object into a single new pack, replacing
+// any existing packs, and deletes the loose copies of packed objects.
+// Unreachable objects from the old packs are written back out as loose
+// objects so that prune can expire them after its grace period.
+func Repack() (*RepackResult, error) {
+	roots, err := reachabilityRoots()
+	if err != nil {
+		return nil, err
+	}
+
+	reachable, err := reachableObjects(roots)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to repack a damaged repository: %w", err)
+	}
+
+	result := &RepackResult{}
+
+	ids := make([]id, 0, len(reachable))
+	for objId := range reachable {
+		ids = append(ids, objId)
+	}
+	slices.Sort(ids)
+
+	oldPacks, err := loadPackIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pack := range oldPacks {
+		for _, objId := range pack.allIds() {
+			if _, ok := reachable[objId]; ok {
+				continue
+			}
+
+			data, err := readPackedObjectData(objId)
+			if err != nil {
+				return nil, err
+			}
+
+			if err = writeLooseObjectData(objId, string(data)); err != nil {
+				return nil, err
+			}
+			result.Loosened++
+		}
+	}
+
+	if len(ids) > 0 {
+		names, err := objectNames(reachable)
+		if err != nil {
+			return nil, err
+		}
+
+		pack, err := encodePack(ids, names)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Pack, err = storePack(pack.data, pack.offsets); err != nil {
+			return nil, err
+		}
+		result.Packed, result.Deltas = len(ids), pack.deltas
+	}
+
+	for _, old := range oldPacks {
+		if old.packPath == result.Pack {
+			continue
+		}
+
+		if err = os.Remove(strings.TrimSuffix(old.packPath, ".pack") + ".idx"); err != nil {
+			return nil, err
+		}
+		if err = os.Remove(old.packPath); err != nil {
+			return nil, err
+		}
+	}
+	forgetPackIndexes()
+
+	objectDb, err := getObjectsDirPath()
+	if err != nil {
+		return nil, fmt.Errorf("could not get object directory path: %w", err)
+	}
+
+	loose, err := looseObjectIds()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, objId := range loose {
+		if _, ok := reachable[objId]; !ok {
+			continue
+		}
+
+		path := filepath.Join(objectDb, objId[:2], objId[2:])
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+		os.Remove(filepath.Dir(path))
+		result.Removed++
+	}
+
+	return result, nil
+}
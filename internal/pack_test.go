@@ -0,0 +1,89 @@
+package got
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepack(t *testing.T) {
+	initTestRepo(t)
+
+	for i := 0; i < 300; i++ {
+		writeTestFile(t, fmt.Sprintf("files/%03d.txt", i), fmt.Sprintf("content %d", i))
+	}
+	commitTestFiles(t, "one", ".")
+
+	unreachable, err := HashObject(strings.NewReader("not reachable"), BLOB, true)
+	if err != nil {
+		t.Fatalf("could not write object: %s", err)
+	}
+
+	before, err := allObjectIds()
+	if err != nil {
+		t.Fatalf("could not list objects: %s", err)
+	}
+
+	result, err := Repack()
+	if err != nil {
+		t.Fatalf("could not repack: %s", err)
+	}
+
+	if result.Packed != len(before)-1 {
+		t.Fatalf("should pack %d reachable objects but packed %d", len(before)-1, result.Packed)
+	}
+
+	loose, err := looseObjectIds()
+	if err != nil {
+		t.Fatalf("could not list loose objects: %s", err)
+	}
+
+	if len(loose) != 1 || loose[0] != unreachable {
+		t.Fatalf("only the unreachable object should stay loose, got %v", loose)
+	}
+
+	for _, objId := range before {
+		if _, _, err = ReadObject(objId); err != nil {
+			t.Fatalf("could not read %s after repacking: %s", objId, err)
+		}
+	}
+
+	head := mustResolve(t, "HEAD")
+	if got := mustResolve(t, head[:8]); got != head {
+		t.Fatalf("short id should find the packed commit %s, got %s", head, got)
+	}
+
+	content, err := readBlob(mustResolve(t, "HEAD:files/042.txt"))
+	if err != nil || string(content) != "content 42" {
+		t.Fatalf("packed blob should hold %q, got %q (%v)", "content 42", content, err)
+	}
+
+	// Dropping the only commit and its logs makes everything unreachable, so
+	// a second repack has to loosen the old pack's objects rather than lose
+	// them
+	if err = updateHead("", "test: drop commit"); err != nil {
+		t.Fatalf("could not reset HEAD: %s", err)
+	}
+
+	if err = os.RemoveAll(filepath.Join(Repo, LogsDir)); err != nil {
+		t.Fatalf("could not remove logs: %s", err)
+	}
+
+	if result, err = Repack(); err != nil {
+		t.Fatalf("could not repack: %s", err)
+	}
+
+	if result.Packed != 0 {
+		t.Fatalf("nothing should be packed, got %d", result.Packed)
+	}
+
+	if packs, _ := loadPackIndexes(); len(packs) != 0 {
+		t.Fatalf("the old pack should have been removed, found %d packs", len(packs))
+	}
+
+	if _, _, err = ReadObject(head); err != nil {
+		t.Fatalf("unreachable packed commit should survive as a loose object: %s", err)
+	}
+}
@@ -0,0 +1,202 @@
+package got
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// A remote whose url starts with pipeURLPrefix is reached by running the
+// rest of the url as a shell command, such as
+//
+//	ext::ssh host got upload-pack /srv/repo
+//
+// which must end up running "got upload-pack <dir>" on the repository. The
+// two sides then take turns over the command's stdin and stdout: each
+// request is a line of "<command> <length>" followed by that many bytes,
+// where the command is refs, upload-pack or receive-pack and the bytes are
+// what the HTTP transport would send, and each answer is "ok <length>"
+// followed by that many bytes, or "error <reason>".
+const pipeURLPrefix = "ext::"
+
+var pipeCommands = map[string]func(*repository, []byte) ([]byte, error){
+	"refs":         (*repository).serveRefs,
+	"upload-pack":  (*repository).serveUploadPack,
+	"receive-pack": (*repository).serveReceivePack,
+}
+
+// ServePipe serves the repository at dir to a pipe transport, reading
+// requests from r and answering on w until r is closed.
+func ServePipe(dir filePath, r io.Reader, w io.Writer) error {
+	repo, err := openRepository(dir)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(r)
+	writer := bufio.NewWriter(w)
+
+	for {
+		command, request, err := readPipeMessage(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		serve, ok := pipeCommands[command]
+		if !ok {
+			return fmt.Errorf("unknown pipe command %q", command)
+		}
+
+		answer, err := serve(repo, request)
+		if err != nil {
+			// The reason has to fit on the error line
+			reason := strings.ReplaceAll(err.Error(), "\n", " ")
+			_, err = fmt.Fprintf(writer, "error %s\n", reason)
+		} else {
+			err = writePipeMessage(writer, "ok", answer)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = writer.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// pipeTransport talks to a repository through a command running
+// ServePipe.
+type pipeTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func openPipeTransport(command string) (*pipeTransport, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not run %q: %w", command, err)
+	}
+
+	return &pipeTransport{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+func (p *pipeTransport) listRefs() (*remoteRefs, error) {
+	answer, err := p.request("refs", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return readRefAdvertisement(bufio.NewReader(bytes.NewReader(answer)))
+}
+
+func (p *pipeTransport) fetchPack(wants, haves []id) ([]byte, error) {
+	var b bytes.Buffer
+	if err := writePackRequest(&b, wants, haves); err != nil {
+		return nil, err
+	}
+
+	return p.request("upload-pack", b.Bytes())
+}
+
+func (p *pipeTransport) pushPack(pack []byte, updates []refUpdate) error {
+	var b bytes.Buffer
+	if err := writeRefUpdates(&b, updates); err != nil {
+		return err
+	}
+	b.Write(pack)
+
+	_, err := p.request("receive-pack", b.Bytes())
+	return err
+}
+
+// close ends the session by closing the command's stdin, then waits for it
+// to exit.
+func (p *pipeTransport) close() error {
+	p.stdin.Close()
+	return p.cmd.Wait()
+}
+
+// request sends one request and reads its answer.
+func (p *pipeTransport) request(command string, request []byte) ([]byte, error) {
+	if err := writePipeMessage(p.stdin, command, request); err != nil {
+		return nil, fmt.Errorf("could not send %s request: %w", command, err)
+	}
+
+	status, answer, err := readPipeMessage(p.stdout)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s answer: %w", command, err)
+	}
+
+	if status != "ok" {
+		return nil, errors.New(status)
+	}
+
+	return answer, nil
+}
+
+// writePipeMessage writes a "<word> <length>" line and the payload.
+func writePipeMessage(w io.Writer, word string, payload []byte) error {
+	if _, err := fmt.Fprintf(w, "%s %d\n", word, len(payload)); err != nil {
+		return err
+	}
+
+	_, err := w.Write(payload)
+	return err
+}
+
+// readPipeMessage reads a message written by writePipeMessage. For an
+// error line the reason is returned as the word, with no payload.
+func readPipeMessage(r *bufio.Reader) (string, []byte, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if line == "" {
+			return "", nil, err
+		}
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	line = strings.TrimSuffix(line, "\n")
+
+	if reason, ok := strings.CutPrefix(line, "error "); ok {
+		return reason, nil, nil
+	}
+
+	word, size, ok := strings.Cut(line, " ")
+	length, err := strconv.Atoi(size)
+	if !ok || err != nil || length < 0 {
+		return "", nil, fmt.Errorf("malformed message %q", line)
+	}
+
+	if length > maxMessageSize {
+		return "", nil, fmt.Errorf("message of %d bytes is larger than the limit of %d", length, maxMessageSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return "", nil, err
+	}
+
+	return word, payload, nil
+}
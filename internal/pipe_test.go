@@ -0,0 +1,54 @@
+package got
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestPipeHelper is not a test of its own; TestTransports runs the test
+// binary as the command at the far end of a pipe remote, and this serves
+// the repository it is given.
+func TestPipeHelper(t *testing.T) {
+	dir := os.Getenv("GOT_TEST_PIPE_REPO")
+	if dir == "" {
+		t.Skip("only runs as the helper process of TestTransports")
+	}
+
+	if err := ServePipe(dir, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestReadPipeMessage(t *testing.T) {
+	cases := []struct {
+		message string
+		word    string
+		payload string
+		err     bool
+	}{
+		{"ok 5\nhello", "ok", "hello", false},
+		{"refs 0\n", "refs", "", false},
+		{"error no such repository\n", "no such repository", "", false},
+		{"ok 5\nhi", "", "", true},
+		{"ok five\n", "", "", true},
+		{"ok -1\n", "", "", true},
+		{fmt.Sprintf("ok %d\n", maxMessageSize+1), "", "", true},
+		{"ok 5", "", "", true},
+	}
+
+	for _, c := range cases {
+		word, payload, err := readPipeMessage(bufio.NewReader(strings.NewReader(c.message)))
+		if (err != nil) != c.err {
+			t.Errorf("reading %q should fail: %v, got %v", c.message, c.err, err)
+			continue
+		}
+		if word != c.word || string(payload) != c.payload {
+			t.Errorf("reading %q should give %q and %q, got %q and %q", c.message, c.word, c.payload, word, payload)
+		}
+	}
+}
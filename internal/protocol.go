@@ -0,0 +1,224 @@
+package got
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The fetch and push protocol is made of blocks of lines, each ending with
+// an empty line:
+//
+//   - a ref advertisement holds "ref: <branch>" naming HEAD's branch, if
+//     it is on one, then a line of "<id> <ref>" for each branch;
+//   - a pack request holds "want <id>" and "have <id>" lines;
+//   - a push holds "<old> <new> <ref>" lines, with the zero id for a ref
+//     that does not exist and a + before the ref to force the update.
+//
+// A pack follows a push's updates as raw bytes, and is the whole answer to
+// a pack request.
+
+// maxMessageSize bounds a request or answer, pack included, so that a peer
+// cannot make the other side allocate whatever size it claims to send.
+const maxMessageSize = 1 << 30
+
+// serveRefs answers a request for the ref advertisement.
+func (r *repository) serveRefs(_ []byte) ([]byte, error) {
+	refs, err := r.advertiseRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	err = writeRefAdvertisement(&b, refs)
+	return b.Bytes(), err
+}
+
+// serveUploadPack answers a pack request with the pack.
+func (r *repository) serveUploadPack(request []byte) ([]byte, error) {
+	wants, haves, err := readPackRequest(bufio.NewReader(bytes.NewReader(request)))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.uploadPack(wants, haves)
+}
+
+// serveReceivePack applies a push, which has no answer beyond success.
+func (r *repository) serveReceivePack(request []byte) ([]byte, error) {
+	reader := bufio.NewReader(bytes.NewReader(request))
+
+	updates, err := readRefUpdates(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	pack, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, r.receivePack(pack, updates)
+}
+
+// writeRefAdvertisement writes the block advertising refs.
+func writeRefAdvertisement(w io.Writer, refs *remoteRefs) error {
+	lines := []string{}
+	if refs.Head != "" {
+		lines = append(lines, refPrefix+refs.Head)
+	}
+
+	for _, ref := range sortedRefs(refs.Refs) {
+		lines = append(lines, refs.Refs[ref]+" "+ref)
+	}
+
+	return writeProtocolBlock(w, lines)
+}
+
+func readRefAdvertisement(r *bufio.Reader) (*remoteRefs, error) {
+	lines, err := readProtocolBlock(r)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := &remoteRefs{Refs: map[filePath]id{}}
+	for _, line := range lines {
+		if head, ok := strings.CutPrefix(line, refPrefix); ok {
+			if !isBranchRef(head) {
+				return nil, fmt.Errorf("advertised HEAD %q is not a branch", head)
+			}
+			refs.Head = head
+			continue
+		}
+
+		refId, ref, ok := strings.Cut(line, " ")
+		if !ok || len(refId) != 40 || !isHex(refId) {
+			return nil, fmt.Errorf("malformed ref line %q", line)
+		}
+		if !isBranchRef(ref) {
+			return nil, fmt.Errorf("advertised ref %q is not a branch", ref)
+		}
+		refs.Refs[ref] = refId
+	}
+
+	return refs, nil
+}
+
+// writePackRequest writes the block asking for the objects reachable from
+// wants and not from haves.
+func writePackRequest(w io.Writer, wants, haves []id) error {
+	lines := []string{}
+	for _, want := range wants {
+		lines = append(lines, "want "+want)
+	}
+	for _, have := range haves {
+		lines = append(lines, "have "+have)
+	}
+
+	return writeProtocolBlock(w, lines)
+}
+
+func readPackRequest(r *bufio.Reader) (wants, haves []id, err error) {
+	lines, err := readProtocolBlock(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, line := range lines {
+		kind, objId, _ := strings.Cut(line, " ")
+		if len(objId) != 40 || !isHex(objId) {
+			return nil, nil, fmt.Errorf("malformed pack request line %q", line)
+		}
+
+		switch kind {
+		case "want":
+			wants = append(wants, objId)
+		case "have":
+			haves = append(haves, objId)
+		default:
+			return nil, nil, fmt.Errorf("malformed pack request line %q", line)
+		}
+	}
+
+	return wants, haves, nil
+}
+
+// writeRefUpdates writes the block of updates a push asks for.
+func writeRefUpdates(w io.Writer, updates []refUpdate) error {
+	lines := []string{}
+	for _, update := range updates {
+		old, new, ref := update.Old, update.New, update.Ref
+		if old == "" {
+			old = zeroId
+		}
+		if new == "" {
+			new = zeroId
+		}
+		if update.Force {
+			ref = "+" + ref
+		}
+		lines = append(lines, old+" "+new+" "+ref)
+	}
+
+	return writeProtocolBlock(w, lines)
+}
+
+func readRefUpdates(r *bufio.Reader) ([]refUpdate, error) {
+	lines, err := readProtocolBlock(r)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := []refUpdate{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !isHex(fields[0]) || !isHex(fields[1]) {
+			return nil, fmt.Errorf("malformed ref update %q", line)
+		}
+
+		update := refUpdate{Old: fields[0], New: fields[1]}
+		update.Ref, update.Force = strings.CutPrefix(fields[2], "+")
+		if !isBranchRef(update.Ref) {
+			return nil, fmt.Errorf("ref update %q is not for a branch", line)
+		}
+
+		if update.Old == zeroId {
+			update.Old = ""
+		}
+		if update.New == zeroId {
+			update.New = ""
+		}
+		updates = append(updates, update)
+	}
+
+	return updates, nil
+}
+
+func writeProtocolBlock(w io.Writer, lines []string) error {
+	block := ""
+	for _, line := range lines {
+		block += line + "\n"
+	}
+
+	_, err := io.WriteString(w, block+"\n")
+	return err
+}
+
+// readProtocolBlock reads lines up to the empty line that ends a block.
+func readProtocolBlock(r *bufio.Reader) ([]string, error) {
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("could not read protocol block: %w", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+}
@@ -0,0 +1,213 @@
+package got
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rebase replays the commits on the current branch that upstream does not
+// have onto the tip of upstream, or onto the commit named by onto when it
+// is given, then moves the branch to the result. With interactive set the
+// todo list is first opened in $GOT_SEQUENCE_EDITOR (or $GOT_EDITOR or
+// $EDITOR) so its steps can be reordered, dropped, reworded, squashed,
+// fixed up or stopped at for editing. It stops like CherryPick when a
+// commit conflicts.
+func Rebase(upstream, onto string, interactive bool) ([]PickResult, error) {
+	if err := checkSequenceStart(); err != nil {
+		return nil, err
+	}
+
+	headRef, head, err := readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	if head == "" {
+		return nil, errors.New("cannot rebase before the first commit")
+	}
+
+	upstreamId, err := ResolveCommit(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	if onto == "" {
+		onto = upstream
+	}
+
+	ontoId, err := ResolveCommit(onto)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := commitsSince(upstreamId, head)
+	if err != nil {
+		return nil, err
+	}
+
+	seq := &sequence{Head: head, Onto: ontoId, Branch: headRef}
+	for _, commitId := range commits {
+		seq.Todo = append(seq.Todo, sequenceStep{Command: "pick", Id: commitId})
+	}
+
+	if interactive {
+		if seq.Todo, err = editTodo(seq.Todo); err != nil {
+			return nil, err
+		}
+	}
+
+	// The branch is only moved once every step is done, with HEAD detached
+	// meanwhile
+	if err = switchWorkingTree(head, ontoId); err != nil {
+		return nil, err
+	}
+
+	if err = writeHead("", ontoId); err != nil {
+		return nil, err
+	}
+
+	if err = appendReflog(HeadFile, head, ontoId, "rebase (start): checkout "+onto); err != nil {
+		return nil, err
+	}
+
+	return runSequence(seq)
+}
+
+// finishRebase moves the rebased branch to where HEAD ended up and checks
+// it out again.
+func finishRebase(seq *sequence) error {
+	if seq.Branch == "" {
+		return nil
+	}
+
+	_, head, err := readHead()
+	if err != nil {
+		return err
+	}
+
+	if err = updateRef(seq.Branch, head, fmt.Sprintf("rebase (finish): %s onto %s", seq.Branch, seq.Onto)); err != nil {
+		return err
+	}
+
+	if err = writeHead(seq.Branch, ""); err != nil {
+		return err
+	}
+
+	return appendReflog(HeadFile, head, head, "rebase (finish): returning to "+seq.Branch)
+}
+
+// commitsSince lists, oldest first, the commits along the first-parent
+// chain of head that upstream cannot reach. Merge commits are left out.
+func commitsSince(upstream, head id) ([]id, error) {
+	reachable := map[id]bool{}
+
+	pending := []id{upstream}
+	for len(pending) > 0 {
+		commitId := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if reachable[commitId] {
+			continue
+		}
+		reachable[commitId] = true
+
+		commit, err := readCommit(commitId)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, commit.Parents...)
+	}
+
+	commits := []id{}
+	for commitId := head; commitId != "" && !reachable[commitId]; {
+		commit, err := readCommit(commitId)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(commit.Parents) <= 1 {
+			commits = append([]id{commitId}, commits...)
+		}
+
+		commitId = ""
+		if len(commit.Parents) > 0 {
+			commitId = commit.Parents[0]
+		}
+	}
+
+	return commits, nil
+}
+
+// editTodo lets the user rewrite the todo list in the sequence editor.
+func editTodo(steps []sequenceStep) ([]sequenceStep, error) {
+	dir, err := getSequencerPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(dir, 0777); err != nil {
+		return nil, fmt.Errorf("could not create sequencer directory: %w", err)
+	}
+
+	path := filepath.Join(dir, sequenceTodoFile)
+	content := formatTodo(steps) + strings.Join([]string{
+		"",
+		"# Commands:",
+		"# p, pick <commit> = use commit",
+		"# r, reword <commit> = use commit, but edit the commit message",
+		"# e, edit <commit> = use commit, but stop for amending",
+		"# s, squash <commit> = use commit, but meld into previous commit",
+		"# f, fixup <commit> = like squash, but keep only the previous commit's message",
+		"# d, drop <commit> = remove commit",
+		"#",
+		"# Lines can be reordered and are run from top to bottom.",
+		"# Removing every line aborts the rebase.",
+		"",
+	}, "\n")
+
+	if err = os.WriteFile(path, []byte(content), 0666); err != nil {
+		return nil, fmt.Errorf("could not write todo list: %w", err)
+	}
+
+	edited, err := runEditor(path, "GOT_SEQUENCE_EDITOR", "GOT_EDITOR", "EDITOR")
+	if err == nil && !edited {
+		err = errors.New("set GOT_SEQUENCE_EDITOR or EDITOR to edit the todo list")
+	}
+
+	var b []byte
+	if err == nil {
+		b, err = os.ReadFile(path)
+	}
+
+	if err == nil {
+		steps, err = parseTodo(string(b))
+	}
+
+	if err == nil && len(steps) == 0 {
+		err = errors.New("nothing to do")
+	}
+
+	if err == nil {
+		for _, step := range steps {
+			if step.Command == "drop" {
+				continue
+			}
+			if step.Command == "squash" || step.Command == "fixup" {
+				err = fmt.Errorf("cannot %s without a previous commit", step.Command)
+			}
+			break
+		}
+	}
+
+	if err != nil {
+		if removeErr := removeSequence(); removeErr != nil {
+			return nil, removeErr
+		}
+		return nil, err
+	}
+
+	return steps, nil
+}
@@ -0,0 +1,177 @@
+package got
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+)
+
+// commitSubjects lists the subjects of the first-parent history of rev,
+// newest first.
+func commitSubjects(t *testing.T, rev string) []string {
+	t.Helper()
+
+	subjects := []string{}
+	for commitId := mustResolve(t, rev); commitId != ""; {
+		commit, err := readCommit(commitId)
+		if err != nil {
+			t.Fatalf("could not read commit %s: %s", commitId, err)
+		}
+		subjects = append(subjects, commitSubject(commit))
+
+		commitId = ""
+		if len(commit.Parents) > 0 {
+			commitId = commit.Parents[0]
+		}
+	}
+
+	return subjects
+}
+
+func TestRebase(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "base\n")
+	commitTestFiles(t, "base", "a.txt")
+
+	if err := Checkout(HeadFile, "feature", false); err != nil {
+		t.Fatalf("could not create branch: %s", err)
+	}
+
+	writeTestFile(t, "f1.txt", "1\n")
+	commitTestFiles(t, "f1", "f1.txt")
+	writeTestFile(t, "f2.txt", "2\n")
+	commitTestFiles(t, "f2", "f2.txt")
+	f2 := mustResolve(t, HeadFile)
+
+	if err := Checkout("main", "", false); err != nil {
+		t.Fatalf("could not check out main: %s", err)
+	}
+	writeTestFile(t, "a.txt", "main\n")
+	commitTestFiles(t, "m1", "a.txt")
+
+	if err := Checkout("feature", "", false); err != nil {
+		t.Fatalf("could not check out feature: %s", err)
+	}
+
+	if _, err := Rebase("main", "", false); err != nil {
+		t.Fatalf("could not rebase: %s", err)
+	}
+
+	if subjects := commitSubjects(t, "feature"); !slices.Equal(subjects, []string{"f2", "f1", "m1", "base"}) {
+		t.Fatalf("feature should be replayed on main, got %q", subjects)
+	}
+	if ref, _, _ := readHead(); ref != branchRef("feature") {
+		t.Fatalf("HEAD should be back on feature, got %q", ref)
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "main\n" {
+		t.Fatalf("the working directory should have main's a.txt, got %q", content)
+	}
+	if mustResolve(t, "feature@{1}") != f2 {
+		t.Fatalf("the branch log should remember where feature was")
+	}
+
+	// Replaying onto the same base again keeps the commits as they are
+	rebased := mustResolve(t, "feature")
+	if _, err := Rebase("main", "", false); err != nil {
+		t.Fatalf("could not rebase again: %s", err)
+	}
+	if mustResolve(t, "feature") != rebased {
+		t.Fatalf("rebasing onto the same base should not rewrite the commits")
+	}
+
+	// --onto moves only the commits after the upstream
+	if _, err := Rebase("feature~", "main~", false); err != nil {
+		t.Fatalf("could not rebase --onto: %s", err)
+	}
+	if subjects := commitSubjects(t, "feature"); !slices.Equal(subjects, []string{"f2", "base"}) {
+		t.Fatalf("only f2 should be replayed onto base, got %q", subjects)
+	}
+}
+
+func TestRebaseTodo(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "base\n")
+	commitTestFiles(t, "base", "a.txt")
+	for _, name := range []string{"one", "two", "three", "four"} {
+		writeTestFile(t, name+".txt", name+"\n")
+		commitTestFiles(t, name, name+".txt")
+	}
+
+	t.Setenv("GOT_SEQUENCE_EDITOR", "sed -i -e '1s/^pick/reword/' -e '2s/^pick/fixup/' -e '3s/^pick/drop/' -e '4s/^pick/edit/'")
+	t.Setenv("GOT_EDITOR", "printf 'reworded\\n# comment\\n' >")
+
+	_, err := Rebase("HEAD~4", "", true)
+	if !errors.Is(err, ErrSequenceStopped) {
+		t.Fatalf("the rebase should stop at the edit step, got %v", err)
+	}
+
+	// Amend the stopped commit with a staged change before continuing
+	writeTestFile(t, "four.txt", "amended\n")
+	stageTestFiles(t, "four.txt")
+
+	if _, err = ContinueSequence(); err != nil {
+		t.Fatalf("could not continue: %s", err)
+	}
+
+	if subjects := commitSubjects(t, "main"); !slices.Equal(subjects, []string{"four", "reworded", "base"}) {
+		t.Fatalf("the todo list should be applied, got %q", subjects)
+	}
+
+	files, err := commitFiles(mustResolve(t, "main"))
+	if err != nil {
+		t.Fatalf("could not read files: %s", err)
+	}
+	if _, ok := files["three.txt"]; ok {
+		t.Errorf("the dropped commit's file should be gone")
+	}
+	if _, ok := files["two.txt"]; !ok {
+		t.Errorf("the fixed up commit's file should be kept")
+	}
+	if content, _ := readBlob(files["four.txt"].Id); string(content) != "amended\n" {
+		t.Errorf("the edited commit should hold the amended file, got %q", content)
+	}
+}
+
+func TestRebaseAbort(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "base\n")
+	commitTestFiles(t, "base", "a.txt")
+
+	if err := Checkout(HeadFile, "feature", false); err != nil {
+		t.Fatalf("could not create branch: %s", err)
+	}
+	writeTestFile(t, "a.txt", "feature\n")
+	commitTestFiles(t, "feature change", "a.txt")
+	feature := mustResolve(t, HeadFile)
+
+	if err := Checkout("main", "", false); err != nil {
+		t.Fatalf("could not check out main: %s", err)
+	}
+	writeTestFile(t, "a.txt", "main\n")
+	commitTestFiles(t, "main change", "a.txt")
+
+	if err := Checkout("feature", "", false); err != nil {
+		t.Fatalf("could not check out feature: %s", err)
+	}
+
+	_, err := Rebase("main", "", false)
+	var conflict *MergeConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("the rebase should conflict, got %v", err)
+	}
+
+	if err = AbortSequence(); err != nil {
+		t.Fatalf("could not abort: %s", err)
+	}
+
+	if ref, head, _ := readHead(); ref != branchRef("feature") || head != feature {
+		t.Fatalf("aborting should put HEAD back on feature at %s, got %q at %s", feature, ref, head)
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "feature\n" {
+		t.Fatalf("aborting should restore a.txt, got %q", content)
+	}
+}
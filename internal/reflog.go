@@ -0,0 +1,310 @@
+package got
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LogsDir filePath = "logs"
+
+	zeroId = "0000000000000000000000000000000000000000"
+)
+
+// appendReflog records that ref moved from old to new. Each line holds the
+// old and new ids, who made the change, when, and a tab separated reason.
+func appendReflog(ref filePath, old, new id, reason string) error {
+	return workingRepo.appendReflog(ref, old, new, reason)
+}
+
+func (r *repository) appendReflog(ref filePath, old, new id, reason string) error {
+	repoPath, err := r.path()
+	if err != nil {
+		return fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	if old == "" {
+		old = zeroId
+	}
+	if new == "" {
+		new = zeroId
+	}
+
+	path := filepath.Join(repoPath, LogsDir, filepath.FromSlash(ref))
+	if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return fmt.Errorf("could not create log directory for %q: %w", ref, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("could not open log for %q: %w", ref, err)
+	}
+	defer file.Close()
+
+	line := fmt.Sprintf("%s %s %s\t%s\n", old, new, formatSignature(r.getIdentity(), time.Now()), reason)
+
+	_, err = file.WriteString(line)
+	return err
+}
+
+// ReflogEntry is one recorded move of a ref.
+type ReflogEntry struct {
+	Old      id
+	New      id
+	Identity string
+	Time     time.Time
+	Reason   string
+}
+
+// commitReflogReason describes a commit in a reflog as the action that made
+// it followed by the first line of its message.
+func commitReflogReason(action string, commit *Commit) string {
+	return action + ": " + commitSubject(commit)
+}
+
+// ReadReflog returns the recorded moves of ref, oldest first. A ref that
+// has never moved has an empty log.
+func ReadReflog(ref filePath) ([]ReflogEntry, error) {
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return nil, fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	entries := []ReflogEntry{}
+
+	file, err := os.Open(filepath.Join(repoPath, LogsDir, filepath.FromSlash(ref)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open log for %q: %w", ref, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, err := parseReflogLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("could not parse log for %q: %w", ref, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+func parseReflogLine(line string) (ReflogEntry, error) {
+	header, reason, _ := strings.Cut(line, "\t")
+
+	old, rest, ok1 := strings.Cut(header, " ")
+	new, rest, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 {
+		return ReflogEntry{}, fmt.Errorf("malformed line %q", line)
+	}
+
+	identity, at, ok := parseSignature(rest)
+	if !ok {
+		return ReflogEntry{}, fmt.Errorf("malformed time in line %q", line)
+	}
+
+	if old == zeroId {
+		old = ""
+	}
+	if new == zeroId {
+		new = ""
+	}
+
+	return ReflogEntry{
+		Old:      old,
+		New:      new,
+		Identity: identity,
+		Time:     at,
+		Reason:   reason,
+	}, nil
+}
+
+// dropReflogEntry deletes the entry n moves back from the end of ref's log
+// and returns the entries left.
+func dropReflogEntry(ref filePath, n int) ([]ReflogEntry, error) {
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return nil, fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	path := filepath.Join(repoPath, LogsDir, filepath.FromSlash(ref))
+
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("could not read log for %q: %w", ref, err)
+	}
+
+	lines := splitLines(content)
+	if n < 0 || n >= len(lines) {
+		return nil, fmt.Errorf("log for %s only has %d entries", ref, len(lines))
+	}
+
+	lines = slices.Delete(lines, len(lines)-1-n, len(lines)-n)
+
+	if err = os.WriteFile(path, []byte(strings.Join(lines, "")), 0666); err != nil {
+		return nil, fmt.Errorf("could not write log for %q: %w", ref, err)
+	}
+
+	return ReadReflog(ref)
+}
+
+// ReflogRef returns the ref whose log name refers to: HEAD for "" or "@",
+// otherwise the first existing ref the short name may mean.
+func ReflogRef(name string) (filePath, error) {
+	if name == "" || name == "@" || name == HeadFile {
+		return HeadFile, nil
+	}
+
+	for _, ref := range refCandidates(name) {
+		objId, err := readRef(ref)
+		if err != nil {
+			return "", err
+		}
+		if objId != "" {
+			return ref, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown ref %q", name)
+}
+
+// parseReflogSelector splits name@{n} into name and n.
+func parseReflogSelector(name string) (string, int, bool) {
+	base, inner, ok := strings.Cut(name, "@{")
+	if !ok {
+		return "", 0, false
+	}
+
+	inner, ok = strings.CutSuffix(inner, "}")
+	if !ok {
+		return "", 0, false
+	}
+
+	n, err := strconv.Atoi(inner)
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+
+	return base, n, true
+}
+
+// resolveReflogEntry returns where the ref named by name pointed n moves
+// ago, as recorded in its log.
+func resolveReflogEntry(name string, n int) (id, error) {
+	ref, err := ReflogRef(name)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := ReadReflog(ref)
+	if err != nil {
+		return "", err
+	}
+
+	if n >= len(entries) {
+		return "", fmt.Errorf("log for %s only has %d entries", ref, len(entries))
+	}
+
+	objId := entries[len(entries)-1-n].New
+	if objId == "" {
+		return "", fmt.Errorf("%s@{%d} does not point at a commit", ref, n)
+	}
+
+	return objId, nil
+}
+
+// previousCheckout returns the branch name (or commit id, for a detached
+// HEAD) that was checked out n switches ago, as recorded in the HEAD log.
+func previousCheckout(n int) (string, error) {
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return "", fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	file, err := os.Open(filepath.Join(repoPath, LogsDir, HeadFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("only %d checkouts recorded, cannot go back %d", 0, n)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	moves := []string{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		_, reason, _ := strings.Cut(scanner.Text(), "\t")
+		if from, ok := strings.CutPrefix(reason, "checkout: moving from "); ok {
+			from, _, _ = strings.Cut(from, " to ")
+			moves = append(moves, from)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if n > len(moves) {
+		return "", fmt.Errorf("only %d checkouts recorded, cannot go back %d", len(moves), n)
+	}
+
+	return moves[len(moves)-n], nil
+}
+
+// reflogIds returns every id recorded in any ref's log, so that objects
+// reflogs point at are kept alive.
+func reflogIds() ([]id, error) {
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return nil, fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	ids := []id{}
+
+	err = filepath.WalkDir(filepath.Join(repoPath, LogsDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 {
+				continue
+			}
+
+			for _, objId := range fields[:2] {
+				if objId != zeroId {
+					ids = append(ids, objId)
+				}
+			}
+		}
+
+		return scanner.Err()
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return ids, nil
+	}
+
+	return ids, err
+}
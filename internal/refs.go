@@ -0,0 +1,239 @@
+package got
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const refPrefix = "ref: "
+
+// readHead returns the ref HEAD points at along with the commit id it
+// resolves to. The ref is empty when HEAD is detached, and the id is empty
+// when the branch has no commits yet.
+func readHead() (ref filePath, head id, err error) {
+	return workingRepo.readHead()
+}
+
+func (r *repository) readHead() (ref filePath, head id, err error) {
+	headPath, err := r.path(HeadFile)
+	if err != nil {
+		return "", "", fmt.Errorf("could not get head path: %w", err)
+	}
+
+	b, err := os.ReadFile(headPath)
+	if err != nil {
+		return "", "", fmt.Errorf("could not read HEAD: %w", err)
+	}
+
+	contents := strings.TrimSpace(string(b))
+
+	if !strings.HasPrefix(contents, refPrefix) {
+		return "", contents, nil
+	}
+
+	ref = strings.TrimPrefix(contents, refPrefix)
+	head, err = r.readRef(ref)
+	if err != nil {
+		return "", "", err
+	}
+
+	return ref, head, nil
+}
+
+// readRef returns the id stored in ref, such as "refs/heads/main". A ref
+// that does not exist yet resolves to the empty id.
+func readRef(ref filePath) (id, error) {
+	return workingRepo.readRef(ref)
+}
+
+func (r *repository) readRef(ref filePath) (id, error) {
+	repoPath, err := r.path()
+	if err != nil {
+		return "", fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(ref)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read ref %q: %w", ref, err)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// updateRef points ref at id, creating the ref if needed, and records the
+// move and its reason in the ref's log. When HEAD is attached to ref the
+// move is logged for HEAD too. Passing "HEAD" updates a detached HEAD
+// directly.
+func updateRef(ref filePath, id id, reason string) error {
+	return workingRepo.updateRef(ref, id, reason)
+}
+
+func (r *repository) updateRef(ref filePath, id id, reason string) error {
+	old, err := r.readRef(ref)
+	if err != nil {
+		return err
+	}
+
+	if err = r.writeRef(ref, id); err != nil {
+		return err
+	}
+
+	if err = r.appendReflog(ref, old, id, reason); err != nil {
+		return err
+	}
+
+	if ref == HeadFile {
+		return nil
+	}
+
+	headRef, _, err := r.readHead()
+	if err != nil {
+		return err
+	}
+
+	if headRef == ref {
+		return r.appendReflog(HeadFile, old, id, reason)
+	}
+
+	return nil
+}
+
+// writeRef stores id in ref without logging the move.
+func writeRef(ref filePath, id id) error {
+	return workingRepo.writeRef(ref, id)
+}
+
+func (r *repository) writeRef(ref filePath, id id) error {
+	repoPath, err := r.path()
+	if err != nil {
+		return fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	path := filepath.Join(repoPath, filepath.FromSlash(ref))
+	if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return fmt.Errorf("could not create directory for ref %q: %w", ref, err)
+	}
+
+	if err = os.WriteFile(path, []byte(id), 0666); err != nil {
+		return fmt.Errorf("could not write commit id %v to ref %q: %w", id, ref, err)
+	}
+
+	return nil
+}
+
+// deleteRef removes ref along with its log.
+func deleteRef(ref filePath) error {
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	for _, path := range []string{
+		filepath.Join(repoPath, filepath.FromSlash(ref)),
+		filepath.Join(repoPath, LogsDir, filepath.FromSlash(ref)),
+	} {
+		if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("could not delete ref %q: %w", ref, err)
+		}
+	}
+
+	return nil
+}
+
+// writeHead attaches HEAD to ref or, when ref is empty, detaches it at id.
+func writeHead(ref filePath, id id) error {
+	headPath, err := getHeadPath()
+	if err != nil {
+		return fmt.Errorf("could not get head path: %w", err)
+	}
+
+	content := id
+	if ref != "" {
+		content = refPrefix + ref
+	}
+
+	if err = os.WriteFile(headPath, []byte(content), 0666); err != nil {
+		return fmt.Errorf("could not write to HEAD file: %w", err)
+	}
+
+	return nil
+}
+
+// updateHead moves whatever HEAD points at to id: the current branch when
+// one is checked out, otherwise the detached HEAD itself.
+func updateHead(id id, reason string) error {
+	ref, _, err := readHead()
+	if err != nil {
+		return err
+	}
+
+	if ref == "" {
+		ref = HeadFile
+	}
+
+	return updateRef(ref, id, reason)
+}
+
+// listRefs returns every ref below the refs directory, keyed by name such
+// as "refs/heads/main", along with the id it points at.
+func listRefs() (map[filePath]id, error) {
+	return workingRepo.listRefs()
+}
+
+func (r *repository) listRefs() (map[filePath]id, error) {
+	refsDir, err := r.path(RefsDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not get refs directory path: %w", err)
+	}
+
+	refs := map[filePath]id{}
+
+	err = filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(filepath.Dir(refsDir), path)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		if refs[name], err = r.readSymbolicRef(name); err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return refs, nil
+	}
+
+	return refs, err
+}
+
+// RefNames returns the names of the refs below dir, such as "refs/heads",
+// relative to it and sorted.
+func RefNames(dir filePath) ([]string, error) {
+	refs, err := listRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, ref := range sortedRefs(refs) {
+		if name, ok := strings.CutPrefix(ref, dir+"/"); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,463 @@
+package got
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// RemotesDir holds the remote-tracking refs, the last known position of
+// each remote's branches, as refs/remotes/<remote>/<branch>.
+const RemotesDir filePath = RefsDir + "/remotes"
+
+// Remote is a repository named in the config, which holds each one as
+//
+//	[remote "origin"]
+//		url = /path/to/repo
+type Remote struct {
+	Name string
+	URL  string
+}
+
+// RefChange describes a ref moved by a fetch or push. Old is empty for a
+// ref that did not exist before.
+type RefChange struct {
+	Ref    filePath
+	Old    id
+	New    id
+	Forced bool
+}
+
+// ListRemotes returns the remotes in the config, sorted by name.
+func ListRemotes() ([]Remote, error) {
+	lines, err := readConfigLines()
+	if err != nil {
+		return nil, err
+	}
+
+	remotes := []Remote{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if name, ok := parseRemoteSection(line); ok {
+			remotes = append(remotes, Remote{Name: name})
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if ok && len(remotes) > 0 && strings.TrimSpace(key) == "url" {
+			remotes[len(remotes)-1].URL = strings.TrimSpace(value)
+		}
+	}
+
+	slices.SortFunc(remotes, func(a, b Remote) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return remotes, nil
+}
+
+// AddRemote names the repository at url, which is a path or a url any
+// transport understands.
+func AddRemote(name, url string) error {
+	if !isValidRefName(name) {
+		return fmt.Errorf("%q is not a valid remote name", name)
+	}
+
+	if _, err := getRemote(name); err == nil {
+		return fmt.Errorf("remote %s already exists", name)
+	}
+
+	lines, err := readConfigLines()
+	if err != nil {
+		return err
+	}
+
+	lines = append(lines, fmt.Sprintf("[remote %q]", name), "\turl = "+url)
+
+	return writeConfigLines(lines)
+}
+
+// RemoveRemote deletes a remote from the config along with its
+// remote-tracking refs.
+func RemoveRemote(name string) error {
+	if _, err := getRemote(name); err != nil {
+		return err
+	}
+
+	lines, err := readConfigLines()
+	if err != nil {
+		return err
+	}
+
+	kept := []string{}
+	inRemote := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			section, ok := parseRemoteSection(trimmed)
+			inRemote = ok && section == name
+		}
+
+		if !inRemote {
+			kept = append(kept, line)
+		}
+	}
+
+	if err = writeConfigLines(kept); err != nil {
+		return err
+	}
+
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	for _, dir := range []filePath{
+		filepath.Join(repoPath, filepath.FromSlash(RemotesDir), name),
+		filepath.Join(repoPath, LogsDir, filepath.FromSlash(RemotesDir), name),
+	} {
+		if err = os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("could not delete the refs of remote %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func getRemote(name string) (Remote, error) {
+	remotes, err := ListRemotes()
+	if err != nil {
+		return Remote{}, err
+	}
+
+	for _, remote := range remotes {
+		if remote.Name == name {
+			if remote.URL == "" {
+				return Remote{}, fmt.Errorf("remote %s has no url", name)
+			}
+			return remote, nil
+		}
+	}
+
+	return Remote{}, fmt.Errorf("no such remote %s", name)
+}
+
+// parseRemoteSection reads the name from a [remote "name"] line.
+func parseRemoteSection(line string) (string, bool) {
+	quoted, ok := strings.CutPrefix(line, "[remote ")
+	if !ok || !strings.HasSuffix(quoted, "]") {
+		return "", false
+	}
+
+	quoted = strings.TrimSuffix(quoted, "]")
+	if len(quoted) < 2 || quoted[0] != '"' || quoted[len(quoted)-1] != '"' {
+		return "", false
+	}
+
+	return quoted[1 : len(quoted)-1], true
+}
+
+func readConfigLines() ([]string, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return nil, fmt.Errorf("could not get config path: %w", err)
+	}
+
+	file, err := os.Open(configPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open config file: %w", err)
+	}
+	defer file.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines, scanner.Err()
+}
+
+func writeConfigLines(lines []string) error {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return fmt.Errorf("could not get config path: %w", err)
+	}
+
+	content := ""
+	for _, line := range lines {
+		content += line + "\n"
+	}
+
+	if err = os.WriteFile(configPath, []byte(content), 0666); err != nil {
+		return fmt.Errorf("could not write config file: %w", err)
+	}
+
+	return nil
+}
+
+// Clone copies the repository at url into a new repository at dir, which
+// names it origin and checks out the branch its HEAD is on.
+func Clone(url string, dir filePath) error {
+	if isPathURL(url) {
+		abs, err := filepath.Abs(url)
+		if err != nil {
+			return err
+		}
+		url = abs
+	}
+
+	// Check the source before creating anything
+	t, err := openTransport(url)
+	if err != nil {
+		return err
+	}
+	_, err = t.listRefs()
+	t.close()
+	if err != nil {
+		return fmt.Errorf("could not list the refs of %s: %w", url, err)
+	}
+
+	if err = Init(dir); err != nil {
+		return err
+	}
+
+	return withRepo(dir, func() error {
+		if err := AddRemote("origin", url); err != nil {
+			return err
+		}
+
+		refs, _, err := fetchRemote(Remote{Name: "origin", URL: url})
+		if err != nil {
+			return err
+		}
+
+		branch := refs.Head
+		if _, ok := refs.Refs[branch]; !ok {
+			branch = branchRef(RefHeadsMainFile)
+		}
+		if _, ok := refs.Refs[branch]; !ok {
+			names := sortedRefs(refs.Refs)
+			if len(names) == 0 {
+				// An empty repository leaves nothing to check out
+				return nil
+			}
+			branch = names[0]
+		}
+
+		name := strings.TrimPrefix(branch, RefsDir+"/"+RefHeadsDir+"/")
+		tracking := RemotesDir + "/origin/" + name
+
+		if err = writeRef(RemotesDir+"/origin/"+HeadFile, refPrefix+tracking); err != nil {
+			return err
+		}
+
+		if err = writeHead(branch, ""); err != nil {
+			return err
+		}
+
+		if err = updateRef(branch, refs.Refs[branch], "clone: from "+url); err != nil {
+			return err
+		}
+
+		if err = switchWorkingTree("", refs.Refs[branch]); err != nil {
+			return err
+		}
+
+		// The clone is done, so a failing hook changes nothing
+		runHook("post-checkout", zeroId, refs.Refs[branch], "1")
+		return nil
+	})
+}
+
+// Fetch copies the objects of a remote's branches that are missing here
+// and moves its remote-tracking refs to where the branches now are.
+func Fetch(name string) ([]RefChange, error) {
+	remote, err := getRemote(name)
+	if err != nil {
+		return nil, err
+	}
+
+	_, changes, err := fetchRemote(remote)
+	return changes, err
+}
+
+func fetchRemote(remote Remote) (*remoteRefs, []RefChange, error) {
+	t, err := openTransport(remote.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer t.close()
+
+	refs, err := t.listRefs()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list the refs of %s: %w", remote.Name, err)
+	}
+
+	local, err := listRefs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	haves := []id{}
+	for _, localId := range local {
+		if !slices.Contains(haves, localId) {
+			haves = append(haves, localId)
+		}
+	}
+
+	wants := []id{}
+	for _, remoteId := range refs.Refs {
+		if ok, err := objectExists(remoteId); err != nil {
+			return nil, nil, err
+		} else if !ok && !slices.Contains(wants, remoteId) {
+			wants = append(wants, remoteId)
+		}
+	}
+
+	if len(wants) > 0 {
+		pack, err := t.fetchPack(wants, haves)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not fetch from %s: %w", remote.Name, err)
+		}
+
+		if err = storeReceivedPack(pack); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	changes := []RefChange{}
+	for _, ref := range sortedRefs(refs.Refs) {
+		tracking := RemotesDir + "/" + remote.Name + "/" + strings.TrimPrefix(ref, RefsDir+"/"+RefHeadsDir+"/")
+
+		old, err := readRef(tracking)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		change := RefChange{Ref: tracking, Old: old, New: refs.Refs[ref]}
+		if change.Old == change.New {
+			continue
+		}
+
+		reason := "fetch: storing head"
+		if old != "" {
+			forward, err := isAncestor(old, change.New)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			change.Forced = !forward
+			reason = "fetch: fast-forward"
+			if change.Forced {
+				reason = "fetch: forced-update"
+			}
+		}
+
+		if err = updateRef(tracking, change.New, reason); err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return refs, changes, nil
+}
+
+// Push sends a local branch and the objects it needs to a remote, moving
+// the remote's branch of the same name. Unless forced, the remote branch
+// may only move forward. It returns nil when the remote is already up to
+// date.
+func Push(name, branch string, force bool) (*RefChange, error) {
+	remote, err := getRemote(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := branchRef(branch)
+	localId, err := readRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	if localId == "" {
+		return nil, fmt.Errorf("no such branch %s", branch)
+	}
+
+	t, err := openTransport(remote.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer t.close()
+
+	refs, err := t.listRefs()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the refs of %s: %w", remote.Name, err)
+	}
+
+	change := &RefChange{Ref: ref, Old: refs.Refs[ref], New: localId}
+	if change.Old == change.New {
+		return nil, nil
+	}
+
+	// A remote branch we have not fetched cannot be an ancestor of ours
+	if change.Old != "" {
+		known, err := objectExists(change.Old)
+		if err != nil {
+			return nil, err
+		}
+
+		forward := false
+		if known {
+			if forward, err = isAncestor(change.Old, change.New); err != nil {
+				return nil, err
+			}
+		}
+
+		if !forward && !force {
+			return nil, fmt.Errorf("%w: %s", ErrNonFastForward, ref)
+		}
+		change.Forced = !forward
+	}
+
+	haves := []id{}
+	for _, remoteId := range refs.Refs {
+		haves = append(haves, remoteId)
+	}
+
+	pack, err := packObjects([]id{localId}, haves)
+	if err != nil {
+		return nil, err
+	}
+
+	update := refUpdate{Ref: ref, Old: change.Old, New: change.New, Force: force}
+	if err = t.pushPack(pack, []refUpdate{update}); err != nil {
+		return nil, fmt.Errorf("could not push to %s: %w", remote.Name, err)
+	}
+
+	if err = updateRef(RemotesDir+"/"+remote.Name+"/"+branch, localId, "update by push"); err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+func sortedRefs(refs map[filePath]id) []filePath {
+	names := make([]filePath, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
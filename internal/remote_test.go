@@ -0,0 +1,172 @@
+package got
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// inTestRepo runs fn from inside the repository at dir, failing the test
+// on error.
+func inTestRepo(t *testing.T, dir string, fn func()) {
+	t.Helper()
+
+	if err := withRepo(dir, func() error { fn(); return nil }); err != nil {
+		t.Fatalf("could not enter %s: %s", dir, err)
+	}
+}
+
+func TestRemotes(t *testing.T) {
+	initTestRepo(t)
+
+	if err := AddRemote("origin", "/somewhere"); err != nil {
+		t.Fatalf("could not add remote: %s", err)
+	}
+	if err := AddRemote("backup", "/elsewhere"); err != nil {
+		t.Fatalf("could not add remote: %s", err)
+	}
+	if err := AddRemote("origin", "/again"); err == nil {
+		t.Errorf("adding a remote twice should fail")
+	}
+
+	remotes, err := ListRemotes()
+	if err != nil {
+		t.Fatalf("could not list remotes: %s", err)
+	}
+	if len(remotes) != 2 || remotes[0] != (Remote{"backup", "/elsewhere"}) || remotes[1] != (Remote{"origin", "/somewhere"}) {
+		t.Fatalf("unexpected remotes %+v", remotes)
+	}
+
+	if err = writeRef(RemotesDir+"/backup/main", strings.Repeat("a", 40)); err != nil {
+		t.Fatalf("could not write ref: %s", err)
+	}
+
+	if err = RemoveRemote("backup"); err != nil {
+		t.Fatalf("could not remove remote: %s", err)
+	}
+
+	if remotes, _ = ListRemotes(); len(remotes) != 1 || remotes[0].Name != "origin" {
+		t.Fatalf("only origin should be left, got %+v", remotes)
+	}
+	if refId, _ := readRef(RemotesDir + "/backup/main"); refId != "" {
+		t.Errorf("removing a remote should delete its remote-tracking refs")
+	}
+	if err = RemoveRemote("backup"); err == nil {
+		t.Errorf("removing a missing remote should fail")
+	}
+}
+
+// detachTestHead detaches HEAD at the commit it is on, so that a push may
+// move the branch it was attached to.
+func detachTestHead(t *testing.T) {
+	t.Helper()
+
+	if err := Checkout(mustResolve(t, HeadFile), "", true); err != nil {
+		t.Fatalf("could not detach HEAD: %s", err)
+	}
+}
+
+// checkoutTestBranch attaches HEAD to the branch again.
+func checkoutTestBranch(t *testing.T, branch string) {
+	t.Helper()
+
+	if err := Checkout(branch, "", true); err != nil {
+		t.Fatalf("could not check out %s: %s", branch, err)
+	}
+}
+
+func TestCloneFetchPush(t *testing.T) {
+	server := initTestRepo(t)
+	writeTestIdentity(t, "Ada", "ada@example.com")
+
+	// Similar versions of a large file make the packs carry deltas
+	lines := strings.Repeat("the same line of text\n", 200)
+	writeTestFile(t, "big.txt", lines)
+	writeTestFile(t, "dir/small.txt", "small\n")
+	commitTestFiles(t, "first", "big.txt", "dir/small.txt")
+	first := mustResolve(t, HeadFile)
+
+	clone := filepath.Join(t.TempDir(), "clone")
+	if err := Clone(server, clone); err != nil {
+		t.Fatalf("could not clone: %s", err)
+	}
+
+	inTestRepo(t, clone, func() {
+		if mustResolve(t, HeadFile) != first || mustResolve(t, "origin/main") != first {
+			t.Fatalf("the clone should have main and origin/main at %s", first)
+		}
+		if content, _ := os.ReadFile("dir/small.txt"); string(content) != "small\n" {
+			t.Fatalf("the clone should check out the files, got %q", content)
+		}
+
+		writeTestFile(t, "big.txt", lines+"one more line\n")
+		commitTestFiles(t, "second", "big.txt")
+
+		if _, err := Push("origin", "main", false); !errors.Is(err, ErrCurrentBranch) {
+			t.Fatalf("pushing to the branch checked out in the remote should be refused, got %v", err)
+		}
+
+		inTestRepo(t, server, func() { detachTestHead(t) })
+
+		change, err := Push("origin", "main", false)
+		if err != nil {
+			t.Fatalf("could not push: %s", err)
+		}
+		if change == nil || change.Old != first || change.Forced {
+			t.Fatalf("the push should fast-forward main from %s, got %+v", first, change)
+		}
+		if mustResolve(t, "origin/main") != mustResolve(t, HeadFile) {
+			t.Errorf("pushing should move the remote-tracking ref")
+		}
+
+		if change, err = Push("origin", "main", false); err != nil || change != nil {
+			t.Errorf("pushing again should do nothing, got %+v and %v", change, err)
+		}
+	})
+
+	second := mustResolve(t, "main")
+	if content, _ := readBlob(mustResolve(t, "main:big.txt")); !strings.HasSuffix(string(content), "one more line\n") {
+		t.Fatalf("the server should have the pushed commit")
+	}
+
+	// Diverge the server from the clone
+	checkoutTestBranch(t, "main")
+	writeTestFile(t, "dir/small.txt", "changed on the server\n")
+	commitTestFiles(t, "third", "dir/small.txt")
+	third := mustResolve(t, HeadFile)
+	detachTestHead(t)
+
+	inTestRepo(t, clone, func() {
+		writeTestFile(t, "local.txt", "local\n")
+		commitTestFiles(t, "local", "local.txt")
+
+		if _, err := Push("origin", "main", false); !errors.Is(err, ErrNonFastForward) {
+			t.Fatalf("a non-fast-forward push should be rejected, got %v", err)
+		}
+
+		changes, err := Fetch("origin")
+		if err != nil {
+			t.Fatalf("could not fetch: %s", err)
+		}
+		if len(changes) != 1 || changes[0].Old != second || changes[0].New != third || changes[0].Forced {
+			t.Fatalf("fetch should fast-forward origin/main to %s, got %+v", third, changes)
+		}
+		if content, _ := readBlob(mustResolve(t, "origin/main:dir/small.txt")); string(content) != "changed on the server\n" {
+			t.Fatalf("fetch should copy the server's objects, got %q", content)
+		}
+
+		change, err := Push("origin", "main", true)
+		if err != nil {
+			t.Fatalf("could not force push: %s", err)
+		}
+		if !change.Forced {
+			t.Errorf("the push should be marked as forced")
+		}
+	})
+
+	if mustResolve(t, "main") == third {
+		t.Errorf("a forced push should overwrite the server's branch")
+	}
+}
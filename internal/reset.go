@@ -0,0 +1,169 @@
+package got
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type ResetMode = string
+
+const (
+	// RESET_SOFT only moves the branch, keeping the index and working tree
+	RESET_SOFT ResetMode = "soft"
+	// RESET_MIXED also makes the index match the target
+	RESET_MIXED ResetMode = "mixed"
+	// RESET_HARD also makes the working tree match the target
+	RESET_HARD ResetMode = "hard"
+)
+
+// Reset points the current branch, or a detached HEAD, at rev. A soft
+// reset leaves what was staged staged, so committing again recreates it; a
+// mixed reset empties the index; a hard reset also overwrites tracked files
+// in the working directory, discarding any changes to them.
+func Reset(rev string, mode ResetMode) error {
+	if mode != RESET_SOFT && mode != RESET_MIXED && mode != RESET_HARD {
+		return fmt.Errorf("unknown reset mode %q", mode)
+	}
+
+	target, err := ResolveCommit(rev)
+	if err != nil {
+		return err
+	}
+
+	index, err := GetIndex()
+	if err != nil {
+		return err
+	}
+
+	staged, err := index.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	_, head, err := readHead()
+	if err != nil {
+		return err
+	}
+
+	current, err := commitFiles(head)
+	if err != nil {
+		return err
+	}
+
+	files, err := commitFiles(target)
+	if err != nil {
+		return err
+	}
+
+	if mode == RESET_HARD {
+		for name, entry := range staged {
+			current[name] = entry
+		}
+
+		if err = overwriteWorkingTree(current, files); err != nil {
+			return err
+		}
+	}
+
+	if err = updateHead(target, "reset: moving to "+rev); err != nil {
+		return err
+	}
+
+	if mode == RESET_SOFT {
+		index.stageFiles(files, staged)
+	} else {
+		index.entries = []indexEntry{}
+	}
+
+	return index.Save()
+}
+
+// ResetPaths stages the version of each path in rev, or unstages it when
+// rev is HEAD. A directory resets every file beneath it.
+func (i *Index) ResetPaths(rev string, paths []string) error {
+	target, err := ResolveCommit(rev)
+	if err != nil {
+		return err
+	}
+
+	files, err := commitFiles(target)
+	if err != nil {
+		return err
+	}
+
+	_, head, err := readHead()
+	if err != nil {
+		return err
+	}
+
+	current, err := commitFiles(head)
+	if err != nil {
+		return err
+	}
+
+	names := map[filePath]bool{}
+	for _, entry := range i.entries {
+		names[entry.Name] = true
+	}
+	for name := range files {
+		names[name] = true
+	}
+	for name := range current {
+		names[name] = true
+	}
+
+	for _, p := range paths {
+		p = cleanPath(p)
+		matched := false
+
+		for name := range names {
+			if p != "." && name != p && !strings.HasPrefix(name, p+"/") {
+				continue
+			}
+			matched = true
+
+			if found, idx := i.IncludesFile(name); found {
+				i.entries = slices.Delete(i.entries, idx, idx+1)
+			}
+
+			if entry, ok := stagedChange(name, current, files); ok {
+				i.entries = append(i.entries, entry)
+			}
+		}
+
+		if !matched {
+			return fmt.Errorf("path %q did not match any file known to got", p)
+		}
+	}
+
+	return nil
+}
+
+// overwriteWorkingTree makes the tracked files in the working directory
+// match target, deleting those only in current. Unlike updateWorkingTree it
+// discards local changes rather than refusing to touch them.
+func overwriteWorkingTree(current, target map[filePath]TreeEntry) error {
+	for name := range current {
+		if _, ok := target[name]; !ok {
+			if err := removeWorkingFile(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, entry := range target {
+		differs, err := workingFileDiffers(name, entry)
+		if err != nil {
+			return err
+		}
+
+		if differs {
+			if err = writeWorkingFile(name, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package got
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "one")
+	commitTestFiles(t, "first", "a.txt")
+	first := mustResolve(t, HeadFile)
+
+	writeTestFile(t, "a.txt", "two")
+	writeTestFile(t, "b.txt", "b")
+	commitTestFiles(t, "second", "a.txt", "b.txt")
+	second := mustResolve(t, HeadFile)
+
+	// A soft reset keeps the second commit's changes staged
+	if err := Reset(first, RESET_SOFT); err != nil {
+		t.Fatalf("could not soft reset: %s", err)
+	}
+
+	if head := mustResolve(t, "main"); head != first {
+		t.Fatalf("main should point at %s after a soft reset but points at %s", first, head)
+	}
+
+	index, _ := GetIndex()
+	staged := map[filePath]status{}
+	for _, entry := range index.Entries() {
+		staged[entry.Name] = entry.Status
+	}
+	if len(staged) != 2 || staged["a.txt"] != STATUS_MODIFY || staged["b.txt"] != STATUS_ADD {
+		t.Fatalf("a soft reset should leave a.txt modified and b.txt added, got %v", staged)
+	}
+
+	// Committing again recreates the same tree
+	if err := index.Commit("again", CommitOptions{}); err != nil {
+		t.Fatalf("could not commit: %s", err)
+	}
+	if mustResolve(t, "HEAD^{tree}") != mustResolve(t, second+"^{tree}") {
+		t.Fatalf("recommitting after a soft reset should give the same tree")
+	}
+
+	// A mixed reset empties the index but leaves the files alone
+	if err := Reset(first, RESET_MIXED); err != nil {
+		t.Fatalf("could not reset: %s", err)
+	}
+
+	index, _ = GetIndex()
+	if index.Length() != 0 {
+		t.Fatalf("a mixed reset should empty the index, got %v", index.Entries())
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "two" {
+		t.Fatalf("a mixed reset should not touch a.txt, got %q", content)
+	}
+
+	// Unstaging a path drops it from the index
+	commitTestFiles(t, "third", "a.txt")
+	writeTestFile(t, "a.txt", "three")
+	commitTestFiles(t, "fourth", "b.txt")
+	index, _ = GetIndex()
+	if err := index.UpdateOrAddEntry("a.txt"); err != nil {
+		t.Fatalf("could not stage a.txt: %s", err)
+	}
+	if err := index.ResetPaths(HeadFile, []string{"a.txt"}); err != nil {
+		t.Fatalf("could not unstage a.txt: %s", err)
+	}
+	if index.Length() != 0 {
+		t.Fatalf("a.txt should be unstaged, got %v", index.Entries())
+	}
+
+	// Resetting a path to an older commit stages its version from there
+	if err := index.ResetPaths(first, []string{"."}); err != nil {
+		t.Fatalf("could not reset paths: %s", err)
+	}
+	staged = map[filePath]status{}
+	for _, entry := range index.Entries() {
+		staged[entry.Name] = entry.Status
+	}
+	if len(staged) != 2 || staged["a.txt"] != STATUS_MODIFY || staged["b.txt"] != STATUS_DELETE {
+		t.Fatalf("resetting . to the first commit should stage a.txt and delete b.txt, got %v", staged)
+	}
+	if err := index.Save(); err != nil {
+		t.Fatalf("could not save index: %s", err)
+	}
+
+	// A hard reset discards staged and working changes
+	if err := Reset(first, RESET_HARD); err != nil {
+		t.Fatalf("could not hard reset: %s", err)
+	}
+
+	if content, _ := os.ReadFile("a.txt"); string(content) != "one" {
+		t.Fatalf("a hard reset should restore a.txt, got %q", content)
+	}
+	if _, err := os.Stat("b.txt"); !os.IsNotExist(err) {
+		t.Fatalf("a hard reset should remove b.txt")
+	}
+
+	if head := mustResolve(t, "main@{1}"); head == first {
+		t.Fatalf("the reflog should remember where main was before the reset")
+	}
+}
@@ -0,0 +1,374 @@
+package got
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ResolveRevision resolves a revision expression to a full object id. It
+// understands:
+//
+//   - HEAD (or @), branch, tag and remote-tracking ref names
+//   - full and abbreviated (at least 4 character) object ids
+//   - @{-n}, the branch or commit checked out n switches ago
+//   - <ref>@{n}, where the ref pointed n moves ago according to its log
+//   - <rev>~n, the nth first-parent ancestor
+//   - <rev>^n, the nth parent (^0 is the commit itself)
+//   - <rev>^{type}, the object peeled to a commit, tree or blob
+//   - <rev>:<path>, the object at path in the revision's tree, or in the
+//     index when rev is empty
+func ResolveRevision(rev string) (id, error) {
+	if rev == "" {
+		return "", fmt.Errorf("empty revision")
+	}
+
+	if base, p, ok := strings.Cut(rev, ":"); ok {
+		return resolvePathInRevision(base, p)
+	}
+
+	name, suffixes := rev, ""
+	if i := strings.IndexAny(rev, "~^"); i >= 0 {
+		name, suffixes = rev[:i], rev[i:]
+	}
+
+	objId, err := resolveName(name)
+	if err != nil {
+		return "", err
+	}
+
+	return applyRevisionSuffixes(objId, suffixes)
+}
+
+// ResolveCommit resolves rev and checks that it names a commit.
+func ResolveCommit(rev string) (id, error) {
+	objId, err := ResolveRevision(rev)
+	if err != nil {
+		return "", err
+	}
+
+	return peelObject(objId, COMMIT)
+}
+
+// BranchName returns the branch named by rev, expanding @{-n}. The second
+// result is false when rev does not name a branch.
+func BranchName(rev string) (string, bool, error) {
+	if n, ok := parsePreviousCheckout(rev); ok {
+		previous, err := previousCheckout(n)
+		if err != nil {
+			return "", false, err
+		}
+		rev = previous
+	}
+
+	name := strings.TrimPrefix(rev, RefsDir+"/"+RefHeadsDir+"/")
+	if !isValidRefName(name) {
+		return "", false, nil
+	}
+
+	branch, err := readRef(branchRef(name))
+	if err != nil {
+		return "", false, err
+	}
+
+	return name, branch != "", nil
+}
+
+func branchRef(name string) filePath {
+	return RefsDir + "/" + RefHeadsDir + "/" + name
+}
+
+// isBranchRef reports whether ref is the full name of a valid branch, such
+// as "refs/heads/main". Refs that arrive from other repositories are
+// checked with it before they are joined onto the repository path, which
+// keeps them inside refs/heads.
+func isBranchRef(ref filePath) bool {
+	name, ok := strings.CutPrefix(ref, RefsDir+"/"+RefHeadsDir+"/")
+	return ok && isValidRefName(name) && path.Clean(ref) == ref
+}
+
+// isValidRefName reports whether name can be used for a branch or tag.
+func isValidRefName(name string) bool {
+	if name == "" || name == "@" || strings.HasPrefix(name, "-") || strings.HasSuffix(name, "/") {
+		return false
+	}
+
+	if strings.ContainsAny(name, " ~^:?*[\\") || strings.Contains(name, "..") || strings.Contains(name, "@{") {
+		return false
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parsePreviousCheckout(name string) (int, bool) {
+	inner, ok := strings.CutPrefix(name, "@{-")
+	if !ok {
+		return 0, false
+	}
+
+	inner, ok = strings.CutSuffix(inner, "}")
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(inner)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+func resolveName(name string) (id, error) {
+	if name == "" || name == "@" {
+		name = HeadFile
+	}
+
+	if n, ok := parsePreviousCheckout(name); ok {
+		previous, err := previousCheckout(n)
+		if err != nil {
+			return "", err
+		}
+		return resolveName(previous)
+	}
+
+	if base, n, ok := parseReflogSelector(name); ok {
+		return resolveReflogEntry(base, n)
+	}
+
+	if name == HeadFile {
+		_, head, err := readHead()
+		if err != nil {
+			return "", err
+		}
+		if head == "" {
+			return "", fmt.Errorf("HEAD does not point at a commit yet")
+		}
+		return head, nil
+	}
+
+	for _, ref := range refCandidates(name) {
+		objId, err := readSymbolicRef(ref)
+		if err != nil {
+			return "", err
+		}
+		if objId != "" {
+			return objId, nil
+		}
+	}
+
+	if isHex(name) && len(name) >= 4 {
+		return expandObjectId(name)
+	}
+
+	return "", fmt.Errorf("unknown revision %q", name)
+}
+
+// refCandidates lists the refs a short name may refer to, in the order they
+// are tried. A name that is not a valid ref name has none, so that nothing
+// outside the repository is read as a ref.
+func refCandidates(name string) []filePath {
+	if !isValidRefName(name) {
+		return nil
+	}
+
+	candidates := []filePath{}
+
+	if strings.HasPrefix(name, RefsDir+"/") || strings.ToUpper(name) == name && !isHex(name) {
+		candidates = append(candidates, name)
+	}
+
+	return append(candidates,
+		RefsDir+"/"+name,
+		RefsDir+"/tags/"+name,
+		branchRef(name),
+		RefsDir+"/remotes/"+name,
+		RefsDir+"/remotes/"+name+"/"+HeadFile,
+	)
+}
+
+// readSymbolicRef reads ref, following it when it points at another ref.
+func readSymbolicRef(ref filePath) (id, error) {
+	return workingRepo.readSymbolicRef(ref)
+}
+
+func (r *repository) readSymbolicRef(ref filePath) (id, error) {
+	for i := 0; i < 5; i++ {
+		contents, err := r.readRef(ref)
+		if err != nil {
+			return "", err
+		}
+
+		target, ok := strings.CutPrefix(contents, refPrefix)
+		if !ok {
+			return contents, nil
+		}
+		ref = target
+	}
+
+	return "", fmt.Errorf("too many levels of symbolic refs at %q", ref)
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func applyRevisionSuffixes(objId id, suffixes string) (id, error) {
+	var err error
+
+	for suffixes != "" {
+		op := suffixes[0]
+		suffixes = suffixes[1:]
+
+		if op == '^' && strings.HasPrefix(suffixes, "{") {
+			end := strings.Index(suffixes, "}")
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ^{ in revision")
+			}
+
+			if objId, err = peelObject(objId, suffixes[1:end]); err != nil {
+				return "", err
+			}
+
+			suffixes = suffixes[end+1:]
+			continue
+		}
+
+		digits := len(suffixes) - len(strings.TrimLeft(suffixes, "0123456789"))
+		n := 1
+		if digits > 0 {
+			if n, err = strconv.Atoi(suffixes[:digits]); err != nil {
+				return "", err
+			}
+		}
+		suffixes = suffixes[digits:]
+
+		switch op {
+		case '~':
+			for ; n > 0; n-- {
+				if objId, err = nthParent(objId, 1); err != nil {
+					return "", err
+				}
+			}
+		case '^':
+			if objId, err = nthParent(objId, n); err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("unexpected %q in revision", op)
+		}
+	}
+
+	return objId, nil
+}
+
+// nthParent returns the nth parent of the commit, or the commit itself when
+// n is zero.
+func nthParent(commitId id, n int) (id, error) {
+	commit, err := readCommit(commitId)
+	if err != nil {
+		return "", err
+	}
+
+	if n == 0 {
+		return commitId, nil
+	}
+
+	if n > len(commit.Parents) {
+		return "", fmt.Errorf("commit %s has no parent %d", commitId, n)
+	}
+
+	return commit.Parents[n-1], nil
+}
+
+// peelObject checks that the object is of type t, peeling a commit to its
+// tree when a tree is asked for. An empty t accepts any object.
+func peelObject(objId id, t objectType) (id, error) {
+	if t == TREE {
+		return peelToTree(objId)
+	}
+
+	objType, _, err := ReadObject(objId)
+	if err != nil {
+		return "", err
+	}
+
+	if t != "" && objType != t {
+		return "", fmt.Errorf("object %s is a %s, not a %s", objId, objType, t)
+	}
+
+	return objId, nil
+}
+
+func resolvePathInRevision(rev string, p filePath) (id, error) {
+	p = strings.Trim(p, "/")
+
+	if rev == "" {
+		index, err := GetIndex()
+		if err != nil {
+			return "", err
+		}
+
+		files, err := index.Snapshot()
+		if err != nil {
+			return "", err
+		}
+
+		entry, ok := files[cleanPath(p)]
+		if !ok {
+			return "", fmt.Errorf("path %q is not in the index", p)
+		}
+		return entry.Id, nil
+	}
+
+	objId, err := ResolveRevision(rev)
+	if err != nil {
+		return "", err
+	}
+
+	if objId, err = peelToTree(objId); err != nil {
+		return "", err
+	}
+
+	if p == "" {
+		return objId, nil
+	}
+
+	for _, part := range strings.Split(cleanPath(p), "/") {
+		entries, err := ReadTree(objId)
+		if err != nil {
+			return "", fmt.Errorf("path %q does not exist in %s", p, rev)
+		}
+
+		found := false
+		for _, entry := range entries {
+			if entry.Name == part {
+				objId, found = entry.Id, true
+				break
+			}
+		}
+
+		if !found {
+			return "", fmt.Errorf("path %q does not exist in %s", p, rev)
+		}
+	}
+
+	return objId, nil
+}
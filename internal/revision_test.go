@@ -0,0 +1,213 @@
+package got
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResolveRevision(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "one")
+	writeTestFile(t, "src/b.txt", "b")
+	commitTestFiles(t, "one", ".")
+	first, err := ResolveRevision(HeadFile)
+	if err != nil {
+		t.Fatalf("could not resolve HEAD: %s", err)
+	}
+
+	writeTestFile(t, "a.txt", "two")
+	commitTestFiles(t, "two", "a.txt")
+	second, _ := ResolveRevision(HeadFile)
+
+	writeTestFile(t, "a.txt", "three")
+	commitTestFiles(t, "three", "a.txt")
+	third, _ := ResolveRevision(HeadFile)
+
+	commit, err := readCommit(first)
+	if err != nil {
+		t.Fatalf("could not read commit: %s", err)
+	}
+
+	blob, _, err := formatHexId("src/b.txt", BLOB)
+	if err != nil {
+		t.Fatalf("could not hash file: %s", err)
+	}
+
+	cases := map[string]string{
+		"HEAD":            third,
+		"@":               third,
+		"main":            third,
+		"refs/heads/main": third,
+		"HEAD~":           second,
+		"HEAD~2":          first,
+		"main^":           second,
+		"HEAD^^":          first,
+		"HEAD~1^0":        second,
+		third[:7]:         third,
+		"HEAD~2^{tree}":   commit.Tree,
+		"HEAD:src/b.txt":  blob,
+		":src/b.txt":      blob,
+	}
+
+	for rev, want := range cases {
+		got, err := ResolveRevision(rev)
+		if err != nil {
+			t.Errorf("could not resolve %q: %s", rev, err)
+			continue
+		}
+
+		if got != want {
+			t.Errorf("%q should resolve to %s but resolved to %s", rev, want, got)
+		}
+	}
+
+	// A file outside the refs that looks like one must not be read
+	writeTestFile(t, "LEAK", third)
+
+	for _, rev := range []string{"HEAD~3", "HEAD^2", "nope", "HEAD:missing", "HEAD:a.txt^{commit}", "../LEAK", "refs/../../LEAK"} {
+		if id, err := ResolveRevision(rev); err == nil {
+			t.Errorf("%q should not resolve but resolved to %s", rev, id)
+		}
+	}
+
+	if ref, err := ReflogRef("../LEAK"); err == nil {
+		t.Errorf("../LEAK should not name a ref but named %s", ref)
+	}
+}
+
+func TestCheckoutPreviousBranch(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "main")
+	commitTestFiles(t, "one", "a.txt")
+
+	if err := Checkout(HeadFile, "feature", false); err != nil {
+		t.Fatalf("could not create branch: %s", err)
+	}
+
+	writeTestFile(t, "a.txt", "feature")
+	commitTestFiles(t, "two", "a.txt")
+
+	if err := Checkout("@{-1}", "", false); err != nil {
+		t.Fatalf("could not checkout previous branch: %s", err)
+	}
+
+	ref, _, err := readHead()
+	if err != nil {
+		t.Fatalf("could not read HEAD: %s", err)
+	}
+
+	if ref != "refs/heads/main" {
+		t.Fatalf("HEAD should point at refs/heads/main but points at %q", ref)
+	}
+
+	if differs, _ := workingFileDiffers("a.txt", TreeEntry{Mode: MODE_FILE, Id: mustResolve(t, "main:a.txt")}); differs {
+		t.Fatal("a.txt should hold the content from main")
+	}
+
+	if got, want := mustResolve(t, "@{-1}"), mustResolve(t, "feature"); got != want {
+		t.Fatalf("@{-1} should resolve to feature (%s) but resolved to %s", want, got)
+	}
+}
+
+func mustResolve(t *testing.T, rev string) id {
+	t.Helper()
+
+	objId, err := ResolveRevision(rev)
+	if err != nil {
+		t.Fatalf("could not resolve %q: %s", rev, err)
+	}
+
+	return objId
+}
+
+func TestReflog(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "one")
+	commitTestFiles(t, "first\n\nbody", "a.txt")
+	first := mustResolve(t, HeadFile)
+
+	writeTestFile(t, "a.txt", "two")
+	commitTestFiles(t, "second", "a.txt")
+	second := mustResolve(t, HeadFile)
+
+	if err := Checkout(first, "feature", false); err != nil {
+		t.Fatalf("could not create branch: %s", err)
+	}
+
+	head, err := ReadReflog(HeadFile)
+	if err != nil {
+		t.Fatalf("could not read HEAD log: %s", err)
+	}
+
+	reasons := []string{}
+	for _, entry := range head {
+		reasons = append(reasons, entry.Reason)
+	}
+
+	want := []string{"commit (initial): first", "commit: second", "checkout: moving from main to feature"}
+	if !slices.Equal(reasons, want) {
+		t.Errorf("HEAD log should have reasons %q but has %q", want, reasons)
+	}
+
+	if head[1].Old != first || head[1].New != second {
+		t.Errorf("second HEAD entry should move %s to %s but moves %s to %s", first, second, head[1].Old, head[1].New)
+	}
+
+	if head[0].Identity == "" || head[0].Time.IsZero() {
+		t.Errorf("log entries should record who and when: %+v", head[0])
+	}
+
+	feature, err := ReadReflog(branchRef("feature"))
+	if err != nil {
+		t.Fatalf("could not read branch log: %s", err)
+	}
+
+	if len(feature) != 1 || feature[0].Old != "" || feature[0].New != first {
+		t.Errorf("feature log should record its creation at %s: %+v", first, feature)
+	}
+
+	cases := map[string]string{
+		"HEAD@{0}": first,
+		"HEAD@{1}": second,
+		"main@{0}": second,
+		"main@{1}": first,
+		"@{2}~0":   first,
+	}
+
+	for rev, want := range cases {
+		if got := mustResolve(t, rev); got != want {
+			t.Errorf("%q should resolve to %s but resolved to %s", rev, want, got)
+		}
+	}
+
+	if id, err := ResolveRevision("main@{2}"); err == nil {
+		t.Errorf("main@{2} should not resolve but resolved to %s", id)
+	}
+}
+
+func TestRefNames(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a")
+	commitTestFiles(t, "first", "a.txt")
+
+	if err := Checkout(HeadFile, "feature/x", false); err != nil {
+		t.Fatalf("could not create branch: %s", err)
+	}
+
+	branches, err := RefNames(RefsDir + "/" + RefHeadsDir)
+	if err != nil {
+		t.Fatalf("could not list branches: %s", err)
+	}
+
+	if want := []string{"feature/x", "main"}; !slices.Equal(branches, want) {
+		t.Fatalf("branches should be %v but are %v", want, branches)
+	}
+
+	if tracking, err := RefNames(RemotesDir); err != nil || len(tracking) != 0 {
+		t.Fatalf("there should be no remote-tracking refs, got %v (%v)", tracking, err)
+	}
+}
@@ -0,0 +1,877 @@
+package got
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// While a cherry-pick, revert or rebase is under way the sequencer
+// directory records where HEAD started, the steps still to apply (the
+// first being the one that stopped, if any) and the files
+// that conflicted, so that it can be continued, skipped or aborted later.
+// A rebase also records the commit it replays onto and the branch to move
+// once it is done, and whether it stopped to let a commit be edited.
+const (
+	SequencerDir filePath = "sequencer"
+
+	sequenceHeadFile      = "head"
+	sequenceTodoFile      = "todo"
+	sequenceConflictsFile = "conflicts"
+	sequenceOntoFile      = "onto"
+	sequenceBranchFile    = "branch"
+	sequenceStoppedFile   = "stopped"
+)
+
+// ErrSequenceStopped is returned when a rebase stops after an edit step so
+// that the commit can be changed before continuing.
+var ErrSequenceStopped = errors.New("stopped to edit a commit; stage any changes and continue")
+
+// The commands a todo list may use, along with their one letter forms.
+var sequenceCommands = map[string]string{
+	"pick":   "pick",
+	"p":      "pick",
+	"revert": "revert",
+	"reword": "reword",
+	"r":      "reword",
+	"edit":   "edit",
+	"e":      "edit",
+	"squash": "squash",
+	"s":      "squash",
+	"fixup":  "fixup",
+	"f":      "fixup",
+	"drop":   "drop",
+	"d":      "drop",
+}
+
+type sequenceStep struct {
+	Command string
+	Id      id
+}
+
+type sequence struct {
+	Head      id
+	Todo      []sequenceStep
+	Conflicts []filePath
+
+	// Onto is only set for a rebase
+	Onto    id
+	Branch  filePath
+	Stopped bool
+}
+
+// PickResult is a commit applied by the sequencer. Commit is empty when the
+// changes were already present, so nothing was committed.
+type PickResult struct {
+	Source  id
+	Commit  id
+	Subject string
+}
+
+// CherryPick applies the changes each commit made to its parent onto HEAD,
+// one commit at a time, keeping their authors and messages. It stops with a
+// *MergeConflictError at the first commit that conflicts.
+func CherryPick(revs []string) ([]PickResult, error) {
+	seq, err := startSequence("pick", revs)
+	if err != nil {
+		return nil, err
+	}
+
+	return runSequence(seq)
+}
+
+// Revert makes a commit undoing the changes of each commit in turn, merged
+// onto HEAD. It stops with a *MergeConflictError at the first one that
+// conflicts.
+func Revert(revs []string) ([]PickResult, error) {
+	seq, err := startSequence("revert", revs)
+	if err != nil {
+		return nil, err
+	}
+
+	return runSequence(seq)
+}
+
+// ContinueSequence commits the resolved changes of the step that stopped
+// on a conflict, tries again a step that failed for another reason, or
+// after an edit step amends HEAD with whatever is staged, and carries on
+// with the rest.
+func ContinueSequence() ([]PickResult, error) {
+	seq, err := readSequence()
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := GetIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	if seq.Stopped {
+		if index.Length() != 0 {
+			if _, err = amendHead(&index, "", "rebase (edit)"); err != nil {
+				return nil, err
+			}
+		}
+
+		seq.Stopped = false
+		return runSequence(seq)
+	}
+
+	// A step that failed without conflicting is tried again from the start
+	if len(seq.Conflicts) == 0 {
+		return runSequence(seq)
+	}
+
+	unresolved, err := index.unresolvedFiles(seq.Conflicts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unresolved) > 0 {
+		return nil, fmt.Errorf("stage the resolved %s before continuing", strings.Join(unresolved, ", "))
+	}
+
+	result, err := commitStep(seq, seq.Todo[0], &index)
+	if err != nil && !errors.Is(err, ErrSequenceStopped) {
+		return nil, err
+	}
+
+	seq.Todo, seq.Conflicts = seq.Todo[1:], nil
+
+	if errors.Is(err, ErrSequenceStopped) {
+		seq.Stopped = true
+		if saveErr := seq.save(); saveErr != nil {
+			return nil, saveErr
+		}
+		return []PickResult{result}, err
+	}
+
+	results, err := runSequence(seq)
+	return append([]PickResult{result}, results...), err
+}
+
+// SkipSequence throws away the changes of the step that stopped and carries
+// on with the rest.
+func SkipSequence() ([]PickResult, error) {
+	seq, err := readSequence()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = discardChanges(); err != nil {
+		return nil, err
+	}
+
+	if !seq.Stopped {
+		seq.Todo = seq.Todo[1:]
+	}
+	seq.Conflicts, seq.Stopped = nil, false
+
+	return runSequence(seq)
+}
+
+// AbortSequence puts HEAD, the index and the working directory back as they
+// were before the sequence began.
+func AbortSequence() error {
+	seq, err := readSequence()
+	if err != nil {
+		return err
+	}
+
+	if err = Reset(seq.Head, RESET_HARD); err != nil {
+		return err
+	}
+
+	if seq.Branch != "" {
+		if err = writeHead(seq.Branch, ""); err != nil {
+			return err
+		}
+
+		if err = appendReflog(HeadFile, seq.Head, seq.Head, "rebase (abort): returning to "+seq.Branch); err != nil {
+			return err
+		}
+	}
+
+	return removeSequence()
+}
+
+// conflictSides returns the versions the step the sequence stopped on
+// merged, as the files it was made from, HEAD's files and the files it
+// makes, along with the files that conflicted. It returns nil when no
+// sequence is stopped on a conflict.
+func conflictSides() (*mergeSides, error) {
+	dir, err := getSequencerPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	seq, err := readSequence()
+	if err != nil || len(seq.Conflicts) == 0 {
+		return nil, err
+	}
+
+	step := seq.Todo[0]
+	commit, err := readCommit(step.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := ""
+	if len(commit.Parents) > 0 {
+		parent = commit.Parents[0]
+	}
+
+	sides := &mergeSides{Conflicts: seq.Conflicts}
+
+	if sides.Base, err = commitFiles(parent); err != nil {
+		return nil, err
+	}
+
+	if sides.Theirs, err = flattenTree(commit.Tree); err != nil {
+		return nil, err
+	}
+
+	if step.Command == "revert" {
+		sides.Base, sides.Theirs = sides.Theirs, sides.Base
+	}
+
+	_, headId, err := readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	if sides.Ours, err = commitFiles(headId); err != nil {
+		return nil, err
+	}
+
+	return sides, nil
+}
+
+// startSequence checks that nothing is in the way of applying the commits
+// named by revs with command, and returns the steps to do so.
+func startSequence(command string, revs []string) (*sequence, error) {
+	if len(revs) == 0 {
+		return nil, errors.New("no commits given")
+	}
+
+	if err := checkSequenceStart(); err != nil {
+		return nil, err
+	}
+
+	_, head, err := readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	if head == "" {
+		return nil, errors.New("cannot apply commits before the first commit")
+	}
+
+	seq := &sequence{Head: head}
+	for _, rev := range revs {
+		commitId, err := ResolveCommit(rev)
+		if err != nil {
+			return nil, err
+		}
+		seq.Todo = append(seq.Todo, sequenceStep{Command: command, Id: commitId})
+	}
+
+	return seq, nil
+}
+
+// checkSequenceStart refuses to start a sequence while another is in
+// progress or when changes are staged.
+func checkSequenceStart() error {
+	dir, err := getSequencerPath()
+	if err != nil {
+		return err
+	}
+
+	if _, err = os.Stat(dir); err == nil {
+		return errors.New("a cherry-pick, revert or rebase is already in progress; continue, skip or abort it first")
+	}
+
+	index, err := GetIndex()
+	if err != nil {
+		return err
+	}
+
+	if index.Length() != 0 {
+		return errors.New("you have staged changes; commit them first")
+	}
+
+	return nil
+}
+
+// runSequence applies the steps in order, saving its progress so that it
+// can be resumed when one stops, and finishes a rebase once they are done.
+func runSequence(seq *sequence) ([]PickResult, error) {
+	results := []PickResult{}
+
+	for len(seq.Todo) > 0 {
+		step := seq.Todo[0]
+		if step.Command == "drop" {
+			seq.Todo = seq.Todo[1:]
+			continue
+		}
+
+		result, conflicts, err := applyStep(seq, step)
+		if errors.Is(err, ErrSequenceStopped) {
+			results = append(results, result)
+			seq.Todo, seq.Stopped = seq.Todo[1:], true
+			if saveErr := seq.save(); saveErr != nil {
+				return results, saveErr
+			}
+			return results, err
+		}
+
+		var conflict *MergeConflictError
+		if errors.As(err, &conflict) {
+			seq.Conflicts = conflicts
+			if saveErr := seq.save(); saveErr != nil {
+				return results, saveErr
+			}
+			return results, err
+		}
+
+		if err != nil {
+			return results, stopSequence(seq, err)
+		}
+
+		results = append(results, result)
+		seq.Todo = seq.Todo[1:]
+	}
+
+	if seq.Onto != "" {
+		if err := finishRebase(seq); err != nil {
+			return results, err
+		}
+	}
+
+	return results, removeSequence()
+}
+
+// stopSequence handles a step that failed for a reason other than a
+// conflict, such as local changes in the way, which leaves the step to be
+// tried again by ContinueSequence. A cherry-pick or revert that has not
+// changed anything yet is given up instead of saved, so that it can simply
+// be started again.
+func stopSequence(seq *sequence, err error) error {
+	index, indexErr := GetIndex()
+	if indexErr != nil {
+		return indexErr
+	}
+
+	_, head, headErr := readHead()
+	if headErr != nil {
+		return headErr
+	}
+
+	if seq.Onto == "" && head == seq.Head && index.Length() == 0 {
+		if removeErr := removeSequence(); removeErr != nil {
+			return removeErr
+		}
+		return err
+	}
+
+	seq.Conflicts = nil
+	if saveErr := seq.save(); saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// applyStep merges the change a step makes into the index and working
+// directory and, unless that conflicts, commits it.
+func applyStep(seq *sequence, step sequenceStep) (PickResult, []filePath, error) {
+	commit, err := readCommit(step.Id)
+	if err != nil {
+		return PickResult{}, nil, err
+	}
+
+	if len(commit.Parents) > 1 {
+		return PickResult{}, nil, fmt.Errorf("commit %s is a merge, which cannot be applied", FindUniqueAbbrev(step.Id))
+	}
+
+	parent := ""
+	if len(commit.Parents) == 1 {
+		parent = commit.Parents[0]
+	}
+
+	index, err := GetIndex()
+	if err != nil {
+		return PickResult{}, nil, err
+	}
+
+	_, headId, err := readHead()
+	if err != nil {
+		return PickResult{}, nil, err
+	}
+
+	// A rebase keeps commits that already sit on the right parent as they are
+	if seq.Onto != "" && parent == headId && index.Length() == 0 && (step.Command == "pick" || step.Command == "edit") {
+		return fastForwardStep(step, commit)
+	}
+
+	base, err := commitFiles(parent)
+	if err != nil {
+		return PickResult{}, nil, err
+	}
+
+	theirs, err := flattenTree(commit.Tree)
+	if err != nil {
+		return PickResult{}, nil, err
+	}
+
+	ours, err := index.Snapshot()
+	if err != nil {
+		return PickResult{}, nil, err
+	}
+
+	head, err := commitFiles(headId)
+	if err != nil {
+		return PickResult{}, nil, err
+	}
+
+	label := fmt.Sprintf("%s (%s)", FindUniqueAbbrev(step.Id), commitSubject(commit))
+
+	// Reverting applies the change from the commit back to its parent
+	if step.Command == "revert" {
+		base, theirs = theirs, base
+		label = "parent of " + label
+	}
+
+	result, err := mergeTrees(base, ours, theirs, HeadFile, label)
+	if err != nil {
+		return PickResult{}, nil, err
+	}
+
+	if err = applyMerge(ours, result); err != nil {
+		return PickResult{}, nil, err
+	}
+
+	index.stageFiles(head, result.Files)
+	if err = index.Save(); err != nil {
+		return PickResult{}, nil, err
+	}
+
+	if len(result.Conflicts) > 0 {
+		conflicts := result.conflictPaths()
+		return PickResult{}, conflicts, &MergeConflictError{Paths: conflicts}
+	}
+
+	pick, err := commitStep(seq, step, &index)
+	return pick, nil, err
+}
+
+// fastForwardStep moves HEAD to a commit whose parent it already points at.
+func fastForwardStep(step sequenceStep, commit *Commit) (PickResult, []filePath, error) {
+	if err := switchWorkingTree(commit.Parents[0], step.Id); err != nil {
+		return PickResult{}, nil, err
+	}
+
+	if err := updateHead(step.Id, commitReflogReason("rebase (fast-forward)", commit)); err != nil {
+		return PickResult{}, nil, err
+	}
+
+	result := PickResult{Source: step.Id, Commit: step.Id, Subject: commitSubject(commit)}
+	if step.Command == "edit" {
+		return result, nil, ErrSequenceStopped
+	}
+
+	return result, nil, nil
+}
+
+// commitStep commits what is staged for a step, leaving the index empty. A
+// pick keeps the message and author of the commit it applies, while a
+// revert names the commit it undoes. Squash and fixup fold the change into
+// HEAD instead, squash adding the commit's message to HEAD's. The commit
+// hooks run as they do for any other commit.
+func commitStep(seq *sequence, step sequenceStep, index *Index) (PickResult, error) {
+	original, err := readCommit(step.Id)
+	if err != nil {
+		return PickResult{}, err
+	}
+
+	action := "cherry-pick"
+	if seq.Onto != "" {
+		action = "rebase (" + step.Command + ")"
+	}
+
+	switch step.Command {
+	case "squash", "fixup":
+		message := ""
+		if step.Command == "squash" {
+			head, err := getHeadCommit()
+			if err != nil {
+				return PickResult{}, err
+			}
+
+			message, _, err = editMessage(strings.TrimSpace(head.Message)+"\n\n"+strings.TrimSpace(original.Message), []string{
+				"This is the combination of two commits.",
+				"Lines starting with '#' will be ignored, and an empty message aborts.",
+			})
+			if err != nil {
+				return PickResult{}, err
+			}
+		}
+
+		commitId, err := amendHead(index, message, action)
+		if err != nil {
+			return PickResult{}, err
+		}
+
+		return PickResult{Source: step.Id, Commit: commitId, Subject: commitSubject(original)}, nil
+	case "revert":
+		action = "revert"
+	}
+
+	files, err := index.Snapshot()
+	if err != nil {
+		return PickResult{}, err
+	}
+
+	_, headId, err := readHead()
+	if err != nil {
+		return PickResult{}, err
+	}
+
+	head, err := commitFiles(headId)
+	if err != nil {
+		return PickResult{}, err
+	}
+
+	cb := newCommitBuilder()
+	cb.parents(headId)
+
+	if step.Command == "revert" {
+		cb.message(fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s.", commitSubject(original), step.Id))
+	} else {
+		cb.message(original.Message)
+		cb.author(original.Author, original.AuthoredAt)
+	}
+
+	if step.Command == "reword" {
+		message, edited, err := editMessage(original.Message, []string{
+			"Reword the commit message.",
+			"Lines starting with '#' will be ignored, and an empty message aborts.",
+		})
+		if err != nil {
+			return PickResult{}, err
+		}
+		if !edited {
+			return PickResult{}, errors.New("set GOT_EDITOR or EDITOR to reword a commit")
+		}
+		cb.message(message)
+	}
+
+	if strings.TrimSpace(cb.commit.Message) == "" {
+		return PickResult{}, errors.New("aborting because the commit message is empty")
+	}
+
+	result := PickResult{Source: step.Id, Subject: commitSubject(cb.commit)}
+
+	if len(diffTrees(head, files)) == 0 {
+		return result, nil
+	}
+
+	message, err := runPreCommitHooks(index, cb.commit.Message)
+	if err != nil {
+		return PickResult{}, err
+	}
+	cb.message(message)
+
+	if files, err = index.Snapshot(); err != nil {
+		return PickResult{}, err
+	}
+
+	if err = cb.entries(files); err != nil {
+		return PickResult{}, err
+	}
+
+	commit, err := cb.build()
+	if err != nil {
+		return PickResult{}, err
+	}
+
+	if err = updateHead(commit.Id, commitReflogReason(action, commit)); err != nil {
+		return PickResult{}, err
+	}
+
+	index.entries = []indexEntry{}
+	if err = index.Save(); err != nil {
+		return PickResult{}, err
+	}
+
+	// The commit is made, so a failing post-commit hook changes nothing
+	runHook("post-commit")
+
+	result.Commit = commit.Id
+
+	if step.Command == "edit" {
+		return result, ErrSequenceStopped
+	}
+
+	return result, nil
+}
+
+// amendHead replaces the HEAD commit with one holding what is staged, with
+// the same parents and author, running the commit hooks. An empty message
+// keeps HEAD's message.
+func amendHead(index *Index, message, action string) (id, error) {
+	head, err := getHeadCommit()
+	if err != nil {
+		return "", err
+	}
+
+	if head == nil {
+		return "", errors.New("there is no commit to amend")
+	}
+
+	if message == "" {
+		message = head.Message
+	}
+
+	if message, err = runPreCommitHooks(index, message); err != nil {
+		return "", err
+	}
+
+	files, err := index.Snapshot()
+	if err != nil {
+		return "", err
+	}
+
+	cb := newCommitBuilder()
+	cb.message(message)
+	cb.author(head.Author, head.AuthoredAt)
+	cb.parents(head.Parents...)
+
+	if err = cb.entries(files); err != nil {
+		return "", err
+	}
+
+	commit, err := cb.build()
+	if err != nil {
+		return "", err
+	}
+
+	if err = updateHead(commit.Id, commitReflogReason(action, commit)); err != nil {
+		return "", err
+	}
+
+	index.entries = []indexEntry{}
+	if err = index.Save(); err != nil {
+		return "", err
+	}
+
+	runHook("post-commit")
+
+	return commit.Id, nil
+}
+
+// discardChanges puts the index and the tracked files in the working
+// directory back to HEAD.
+func discardChanges() error {
+	index, err := GetIndex()
+	if err != nil {
+		return err
+	}
+
+	staged, err := index.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	_, headId, err := readHead()
+	if err != nil {
+		return err
+	}
+
+	head, err := commitFiles(headId)
+	if err != nil {
+		return err
+	}
+
+	for name, entry := range head {
+		staged[name] = entry
+	}
+
+	if err = overwriteWorkingTree(staged, head); err != nil {
+		return err
+	}
+
+	index.entries = []indexEntry{}
+	return index.Save()
+}
+
+func commitSubject(commit *Commit) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+	return subject
+}
+
+// parseTodo reads a todo list, one "<command> <commit> [subject]" per line,
+// skipping blank lines and comments.
+func parseTodo(content string) ([]sequenceStep, error) {
+	steps := []sequenceStep{}
+
+	for n, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		command, ok := sequenceCommands[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown command %q", n+1, fields[0])
+		}
+
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: %s needs a commit", n+1, command)
+		}
+
+		commitId, err := ResolveCommit(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		steps = append(steps, sequenceStep{Command: command, Id: commitId})
+	}
+
+	return steps, nil
+}
+
+// formatTodo writes steps as a todo list, naming each commit's subject for
+// whoever reads it.
+func formatTodo(steps []sequenceStep) string {
+	todo := ""
+	for _, step := range steps {
+		subject := ""
+		if commit, err := readCommit(step.Id); err == nil {
+			subject = commitSubject(commit)
+		}
+		todo += fmt.Sprintf("%s %s %s\n", step.Command, step.Id, subject)
+	}
+	return todo
+}
+
+func getSequencerPath() (string, error) {
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return "", fmt.Errorf("could not get repo path: %w", err)
+	}
+
+	return filepath.Join(repoPath, SequencerDir), nil
+}
+
+// readSequence loads the sequence in progress, failing when there is none.
+func readSequence() (*sequence, error) {
+	dir, err := getSequencerPath()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{}
+	for _, name := range []string{sequenceHeadFile, sequenceTodoFile, sequenceConflictsFile, sequenceOntoFile, sequenceBranchFile, sequenceStoppedFile} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read sequencer state: %w", err)
+		}
+		files[name] = string(b)
+	}
+
+	head, ok := files[sequenceHeadFile]
+	if !ok {
+		return nil, errors.New("no cherry-pick, revert or rebase is in progress")
+	}
+
+	_, stopped := files[sequenceStoppedFile]
+
+	seq := &sequence{
+		Head:    strings.TrimSpace(head),
+		Onto:    strings.TrimSpace(files[sequenceOntoFile]),
+		Branch:  strings.TrimSpace(files[sequenceBranchFile]),
+		Stopped: stopped,
+	}
+
+	if seq.Todo, err = parseTodo(files[sequenceTodoFile]); err != nil {
+		return nil, fmt.Errorf("could not read sequencer todo list: %w", err)
+	}
+
+	if len(seq.Todo) == 0 && !seq.Stopped {
+		return nil, errors.New("the sequencer has nothing left to do; abort it")
+	}
+
+	for _, name := range strings.Split(files[sequenceConflictsFile], "\n") {
+		if name != "" {
+			seq.Conflicts = append(seq.Conflicts, name)
+		}
+	}
+
+	return seq, nil
+}
+
+// save writes the sequence out.
+func (s *sequence) save() error {
+	dir, err := getSequencerPath()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("could not create sequencer directory: %w", err)
+	}
+
+	conflicts := slices.Clone(s.Conflicts)
+	slices.Sort(conflicts)
+
+	files := map[string]string{
+		sequenceHeadFile:      s.Head + "\n",
+		sequenceTodoFile:      formatTodo(s.Todo),
+		sequenceConflictsFile: strings.Join(conflicts, "\n"),
+	}
+
+	if s.Onto != "" {
+		files[sequenceOntoFile] = s.Onto + "\n"
+		files[sequenceBranchFile] = s.Branch + "\n"
+	}
+
+	for name, content := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			return fmt.Errorf("could not write sequencer state: %w", err)
+		}
+	}
+
+	stoppedPath := filepath.Join(dir, sequenceStoppedFile)
+	if s.Stopped {
+		err = os.WriteFile(stoppedPath, nil, 0666)
+	} else if err = os.Remove(stoppedPath); errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not write sequencer state: %w", err)
+	}
+
+	return nil
+}
+
+func removeSequence() error {
+	dir, err := getSequencerPath()
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,231 @@
+package got
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestIdentity(t *testing.T, name, email string) {
+	t.Helper()
+	writeTestFile(t, filepath.Join(Repo, ConfigFile), "name = "+name+"\nemail = "+email+"\n")
+}
+
+func TestCherryPick(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "one\ntwo\nthree\n")
+	writeTestFile(t, "b.txt", "b\n")
+	commitTestFiles(t, "first", ".")
+
+	if err := Checkout(HeadFile, "feature", false); err != nil {
+		t.Fatalf("could not create branch: %s", err)
+	}
+
+	writeTestIdentity(t, "Ada", "ada@example.com")
+	writeTestFile(t, "a.txt", "one\ntwo\nTHREE\n")
+	commitTestFiles(t, "fix three", "a.txt")
+	fix := mustResolve(t, HeadFile)
+
+	writeTestFile(t, "b.txt", "feature\n")
+	commitTestFiles(t, "change b", "b.txt")
+	changeB := mustResolve(t, HeadFile)
+
+	writeTestFile(t, "c.txt", "c\n")
+	commitTestFiles(t, "add c", "c.txt")
+	addC := mustResolve(t, HeadFile)
+
+	if err := Checkout("main", "", false); err != nil {
+		t.Fatalf("could not check out main: %s", err)
+	}
+
+	writeTestIdentity(t, "Bob", "bob@example.com")
+	writeTestFile(t, "a.txt", "ONE\ntwo\nthree\n")
+	writeTestFile(t, "b.txt", "main\n")
+	commitTestFiles(t, "main changes", "a.txt", "b.txt")
+
+	// The first pick merges cleanly and the second conflicts
+	results, err := CherryPick([]string{fix, changeB, addC})
+	var conflict *MergeConflictError
+	if !errors.As(err, &conflict) || len(conflict.Paths) != 1 || conflict.Paths[0] != "b.txt" {
+		t.Fatalf("picking %s should conflict in b.txt, got %v", changeB, err)
+	}
+
+	if len(results) != 1 || results[0].Source != fix {
+		t.Fatalf("only the fix should have been picked, got %+v", results)
+	}
+
+	picked, err := readCommit(results[0].Commit)
+	if err != nil {
+		t.Fatalf("could not read picked commit: %s", err)
+	}
+	if picked.Author != "Ada <ada@example.com>" || picked.Committer != "Bob <bob@example.com>" || picked.Message != "fix three" {
+		t.Errorf("the pick should keep the original author and message, got %+v", picked)
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "ONE\ntwo\nTHREE\n" {
+		t.Errorf("a.txt should hold both changes, got %q", content)
+	}
+
+	if _, err = ContinueSequence(); err == nil {
+		t.Fatalf("continuing before staging the resolution should fail")
+	}
+
+	if _, err = CherryPick([]string{addC}); err == nil {
+		t.Fatalf("starting a cherry-pick while one is in progress should fail")
+	}
+
+	writeTestFile(t, "b.txt", "resolved\n")
+	stageTestFiles(t, "b.txt")
+
+	if results, err = ContinueSequence(); err != nil {
+		t.Fatalf("could not continue: %s", err)
+	}
+	if len(results) != 2 || results[0].Source != changeB || results[1].Source != addC {
+		t.Fatalf("continuing should commit the resolution and pick the rest, got %+v", results)
+	}
+
+	log, _ := ReadReflog(HeadFile)
+	if reason := log[len(log)-1].Reason; reason != "cherry-pick: add c" {
+		t.Errorf("picks should be logged, got %q", reason)
+	}
+
+	if _, err = os.Stat(filepath.Join(Repo, SequencerDir)); !os.IsNotExist(err) {
+		t.Errorf("the sequencer state should be gone once every commit is picked")
+	}
+
+	// Aborting puts everything back
+	writeTestFile(t, "b.txt", "again\n")
+	commitTestFiles(t, "again", "b.txt")
+	start := mustResolve(t, HeadFile)
+
+	if _, err = CherryPick([]string{changeB}); err == nil {
+		t.Fatalf("picking %s again should conflict", changeB)
+	}
+	if err = AbortSequence(); err != nil {
+		t.Fatalf("could not abort: %s", err)
+	}
+	if head := mustResolve(t, HeadFile); head != start {
+		t.Fatalf("aborting should leave HEAD at %s, got %s", start, head)
+	}
+	if content, _ := os.ReadFile("b.txt"); string(content) != "again\n" {
+		t.Fatalf("aborting should restore b.txt, got %q", content)
+	}
+
+	// Skipping drops the conflicting commit
+	if _, err = CherryPick([]string{changeB}); err == nil {
+		t.Fatalf("picking %s again should conflict", changeB)
+	}
+	if results, err = SkipSequence(); err != nil || len(results) != 0 {
+		t.Fatalf("could not skip: %v %+v", err, results)
+	}
+	if head := mustResolve(t, HeadFile); head != start {
+		t.Fatalf("skipping the only commit should leave HEAD at %s, got %s", start, head)
+	}
+}
+
+func TestCherryPickLocalChanges(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a\n")
+	writeTestFile(t, "b.txt", "b\n")
+	commitTestFiles(t, "first", ".")
+
+	if err := Checkout(HeadFile, "feature", false); err != nil {
+		t.Fatalf("could not create branch: %s", err)
+	}
+
+	writeTestFile(t, "b.txt", "feature b\n")
+	commitTestFiles(t, "change b", "b.txt")
+	changeB := mustResolve(t, HeadFile)
+
+	writeTestFile(t, "a.txt", "feature a\n")
+	commitTestFiles(t, "change a", "a.txt")
+	changeA := mustResolve(t, HeadFile)
+
+	if err := Checkout("main", "", false); err != nil {
+		t.Fatalf("could not check out main: %s", err)
+	}
+	start := mustResolve(t, HeadFile)
+
+	// A pick refused before it changes anything leaves nothing to continue
+	writeTestFile(t, "a.txt", "local\n")
+	if _, err := CherryPick([]string{changeA}); err == nil {
+		t.Fatalf("picking over a local change should fail")
+	}
+	if _, err := os.Stat(filepath.Join(Repo, SequencerDir)); !os.IsNotExist(err) {
+		t.Fatalf("a pick that changed nothing should not leave sequencer state")
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "local\n" || mustResolve(t, HeadFile) != start {
+		t.Fatalf("the failed pick should leave HEAD and a.txt alone, got %q", content)
+	}
+
+	// Once a commit has been picked, the one refused is tried again
+	results, err := CherryPick([]string{changeB, changeA})
+	if err == nil || len(results) != 1 || results[0].Source != changeB {
+		t.Fatalf("only %s should be picked before the local change is in the way, got %+v and %v", changeB, results, err)
+	}
+
+	if _, err = ContinueSequence(); err == nil {
+		t.Fatalf("continuing with the local change still there should fail")
+	}
+
+	writeTestFile(t, "a.txt", "a\n")
+	if results, err = ContinueSequence(); err != nil {
+		t.Fatalf("could not continue: %s", err)
+	}
+	if len(results) != 1 || results[0].Source != changeA || results[0].Commit == "" {
+		t.Fatalf("continuing should pick %s, got %+v", changeA, results)
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "feature a\n" {
+		t.Errorf("a.txt should hold the picked change, got %q", content)
+	}
+}
+
+func TestRevert(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "one\ntwo\nthree\n")
+	commitTestFiles(t, "first", "a.txt")
+
+	writeTestFile(t, "a.txt", "one\nTWO\nthree\n")
+	writeTestFile(t, "b.txt", "b\n")
+	commitTestFiles(t, "shout two", "a.txt", "b.txt")
+	shout := mustResolve(t, HeadFile)
+
+	writeTestFile(t, "a.txt", "one\nTWO\nthree\nfour\n")
+	commitTestFiles(t, "add four", "a.txt")
+
+	results, err := Revert([]string{"HEAD~"})
+	if err != nil {
+		t.Fatalf("could not revert: %s", err)
+	}
+
+	revert, err := readCommit(results[0].Commit)
+	if err != nil {
+		t.Fatalf("could not read revert commit: %s", err)
+	}
+	if want := "Revert \"shout two\"\n\nThis reverts commit " + shout + "."; revert.Message != want {
+		t.Errorf("revert message should be %q, got %q", want, revert.Message)
+	}
+
+	if content, _ := os.ReadFile("a.txt"); string(content) != "one\ntwo\nthree\nfour\n" {
+		t.Errorf("reverting should undo only that commit's change, got %q", content)
+	}
+	if _, err = os.Stat("b.txt"); !os.IsNotExist(err) {
+		t.Errorf("reverting should remove the file the commit added")
+	}
+
+	// Reverting a change that was since built on conflicts
+	writeTestFile(t, "a.txt", "one\nTwo!\nthree\nfour\n")
+	commitTestFiles(t, "exclaim two", "a.txt")
+
+	_, err = Revert([]string{shout})
+	var conflict *MergeConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("reverting a rewritten line should conflict, got %v", err)
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "one\n<<<<<<< HEAD\nTwo!\n=======\ntwo\n>>>>>>> parent of "+FindUniqueAbbrev(shout)+" (shout two)\nthree\nfour\n" {
+		t.Errorf("a.txt should hold conflict markers, got %q", content)
+	}
+}
@@ -0,0 +1,337 @@
+package got
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const stashRef filePath = RefsDir + "/stash"
+
+// A stash is a commit whose tree is the working directory and whose parents
+// are the HEAD commit it was made on and a commit of the index. refs/stash
+// points at the newest one and its log is the stack of them all, so the
+// nth newest can be named stash@{n}.
+
+// StashPush saves the staged and unstaged changes to tracked files, or only
+// those under paths, then reverts them to HEAD. An empty message describes
+// the commit the stash was made on.
+func StashPush(message string, paths []string) (id, error) {
+	headRef, headId, err := readHead()
+	if err != nil {
+		return "", err
+	}
+
+	if headId == "" {
+		return "", errors.New("cannot stash before the first commit")
+	}
+
+	head, err := commitFiles(headId)
+	if err != nil {
+		return "", err
+	}
+
+	index, err := GetIndex()
+	if err != nil {
+		return "", err
+	}
+
+	staged, err := index.Snapshot()
+	if err != nil {
+		return "", err
+	}
+
+	matches := func(name filePath) bool {
+		if len(paths) == 0 {
+			return true
+		}
+		for _, p := range paths {
+			if p = cleanPath(p); p == "." || name == p || strings.HasPrefix(name, p+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	indexFiles := maps.Clone(head)
+	workingFiles := maps.Clone(head)
+	touched := map[filePath]TreeEntry{}
+
+	for _, files := range []map[filePath]TreeEntry{head, staged} {
+		for name := range files {
+			if matches(name) {
+				touched[name] = files[name]
+			}
+		}
+	}
+
+	for name := range touched {
+		delete(indexFiles, name)
+		delete(workingFiles, name)
+
+		entry, ok := staged[name]
+		if !ok {
+			continue
+		}
+		indexFiles[name] = entry
+
+		if _, err := os.Lstat(name); err != nil {
+			continue
+		}
+
+		blob, err := writeBlob(name)
+		if err != nil {
+			return "", err
+		}
+
+		mode, err := workingFileMode(name)
+		if err != nil {
+			return "", err
+		}
+		workingFiles[name] = TreeEntry{Mode: mode, Type: BLOB, Id: blob.Id, Name: name}
+	}
+
+	if len(diffTrees(head, indexFiles)) == 0 && len(diffTrees(head, workingFiles)) == 0 {
+		return "", errors.New("no local changes to save")
+	}
+
+	headCommit, err := readCommit(headId)
+	if err != nil {
+		return "", err
+	}
+
+	branch := "(no branch)"
+	if headRef != "" {
+		branch = strings.TrimPrefix(headRef, RefsDir+"/"+RefHeadsDir+"/")
+	}
+
+	subject := commitSubject(headCommit)
+	if message == "" {
+		message = fmt.Sprintf("WIP on %s: %s %s", branch, FindUniqueAbbrev(headId), subject)
+	} else {
+		message = fmt.Sprintf("On %s: %s", branch, message)
+	}
+
+	indexCommit, err := buildCommit(indexFiles, fmt.Sprintf("index on %s: %s %s", branch, FindUniqueAbbrev(headId), subject), headId)
+	if err != nil {
+		return "", err
+	}
+
+	stash, err := buildCommit(workingFiles, message, headId, indexCommit.Id)
+	if err != nil {
+		return "", err
+	}
+
+	if err = updateRef(stashRef, stash.Id, message); err != nil {
+		return "", err
+	}
+
+	// Put the stashed files back as they are in HEAD
+	current := map[filePath]TreeEntry{}
+	restored := map[filePath]TreeEntry{}
+	for name, entry := range touched {
+		current[name] = entry
+		if h, ok := head[name]; ok {
+			restored[name] = h
+		}
+
+		if found, idx := index.IncludesFile(name); found {
+			index.entries = append(index.entries[:idx], index.entries[idx+1:]...)
+		}
+	}
+
+	if err = overwriteWorkingTree(current, restored); err != nil {
+		return "", err
+	}
+
+	if err = index.Save(); err != nil {
+		return "", err
+	}
+
+	return stash.Id, nil
+}
+
+// StashList returns the stashes, newest first, so that the nth is
+// stash@{n}.
+func StashList() ([]ReflogEntry, error) {
+	entries, err := ReadReflog(stashRef)
+	if err != nil {
+		return nil, err
+	}
+
+	stashes := make([]ReflogEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		stashes = append(stashes, entries[i])
+	}
+
+	return stashes, nil
+}
+
+// StashShow lists the files the named stash changes relative to the commit
+// it was made on.
+func StashShow(name string) ([]FileChange, error) {
+	stash, _, err := readStash(name)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := commitFiles(stash.Parents[0])
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := flattenTree(stash.Tree)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffTrees(base, files), nil
+}
+
+// StashApply merges the changes in the named stash into the working
+// directory, staging files it adds. Conflicts are left marked in the files
+// and reported as a *MergeConflictError.
+func StashApply(name string) error {
+	stash, _, err := readStash(name)
+	if err != nil {
+		return err
+	}
+
+	base, err := commitFiles(stash.Parents[0])
+	if err != nil {
+		return err
+	}
+
+	theirs, err := flattenTree(stash.Tree)
+	if err != nil {
+		return err
+	}
+
+	index, err := GetIndex()
+	if err != nil {
+		return err
+	}
+
+	ours, err := index.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	result, err := mergeTrees(base, ours, theirs, "Updated upstream", "Stashed changes")
+	if err != nil {
+		return err
+	}
+
+	if err = applyMerge(ours, result); err != nil {
+		return err
+	}
+
+	for name := range result.Files {
+		if _, tracked := ours[name]; !tracked {
+			if err = index.UpdateOrAddEntry(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = index.Save(); err != nil {
+		return err
+	}
+
+	if len(result.Conflicts) > 0 {
+		return &MergeConflictError{Paths: result.conflictPaths()}
+	}
+
+	return nil
+}
+
+// StashPop applies the named stash and drops it, unless applying it
+// conflicted.
+func StashPop(name string) (id, error) {
+	if err := StashApply(name); err != nil {
+		var conflict *MergeConflictError
+		if errors.As(err, &conflict) {
+			return "", fmt.Errorf("%w; the stash was kept", err)
+		}
+		return "", err
+	}
+
+	return StashDrop(name)
+}
+
+// StashDrop deletes the named stash from the stack and returns its id.
+func StashDrop(name string) (id, error) {
+	stash, n, err := readStash(name)
+	if err != nil {
+		return "", err
+	}
+
+	remaining, err := dropReflogEntry(stashRef, n)
+	if err != nil {
+		return "", err
+	}
+
+	if len(remaining) == 0 {
+		return stash.Id, deleteRef(stashRef)
+	}
+
+	return stash.Id, writeRef(stashRef, remaining[len(remaining)-1].New)
+}
+
+// readStash loads the stash named like stash@{n}, or by n alone. The
+// empty name is the newest stash.
+func readStash(name string) (*Commit, int, error) {
+	n := 0
+
+	if name != "" {
+		base, selected, ok := parseReflogSelector(name)
+		if ok && (base == "stash" || base == stashRef) {
+			n = selected
+		} else if selected, err := strconv.Atoi(name); err == nil && selected >= 0 {
+			n = selected
+		} else {
+			return nil, 0, fmt.Errorf("%q is not a stash", name)
+		}
+	}
+
+	stashes, err := StashList()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(stashes) == 0 {
+		return nil, 0, errors.New("there are no stashes")
+	}
+
+	if n >= len(stashes) {
+		return nil, 0, fmt.Errorf("stash@{%d} does not exist; there are only %d stashes", n, len(stashes))
+	}
+
+	commit, err := readCommit(stashes[n].New)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(commit.Parents) == 0 {
+		return nil, 0, fmt.Errorf("stash@{%d} is not a stash commit", n)
+	}
+
+	return commit, n, nil
+}
+
+// buildCommit writes a commit of files with the given parents, without
+// moving any ref.
+func buildCommit(files map[filePath]TreeEntry, message string, parents ...id) (*Commit, error) {
+	cb := newCommitBuilder()
+	cb.message(message)
+	cb.parents(parents...)
+
+	if err := cb.entries(files); err != nil {
+		return nil, err
+	}
+
+	return cb.build()
+}
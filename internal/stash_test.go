@@ -0,0 +1,115 @@
+package got
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStash(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "one\ntwo\nthree\n")
+	writeTestFile(t, "b.txt", "b")
+	commitTestFiles(t, "first", ".")
+
+	if _, err := StashPush("", nil); err == nil {
+		t.Fatalf("stashing without changes should fail")
+	}
+
+	writeTestFile(t, "a.txt", "one\ntwo\nTHREE\n")
+	writeTestFile(t, "b.txt", "changed")
+	writeTestFile(t, "c.txt", "new")
+	commitTestFiles(t, "second", "b.txt")
+	index, _ := GetIndex()
+	if err := index.UpdateOrAddEntry("c.txt"); err != nil {
+		t.Fatalf("could not stage c.txt: %s", err)
+	}
+	if err := index.Save(); err != nil {
+		t.Fatalf("could not save index: %s", err)
+	}
+
+	first, err := StashPush("only c", []string{"c.txt"})
+	if err != nil {
+		t.Fatalf("could not stash c.txt: %s", err)
+	}
+	if _, err = os.Stat("c.txt"); !os.IsNotExist(err) {
+		t.Fatalf("stashing c.txt should remove it")
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "one\ntwo\nTHREE\n" {
+		t.Fatalf("stashing c.txt should leave a.txt alone, got %q", content)
+	}
+
+	second, err := StashPush("", nil)
+	if err != nil {
+		t.Fatalf("could not stash: %s", err)
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "one\ntwo\nthree\n" {
+		t.Fatalf("stashing should revert a.txt, got %q", content)
+	}
+
+	stashes, err := StashList()
+	if err != nil {
+		t.Fatalf("could not list stashes: %s", err)
+	}
+	if len(stashes) != 2 || stashes[0].New != second || !strings.HasPrefix(stashes[0].Reason, "WIP on main:") || stashes[1].Reason != "On main: only c" {
+		t.Fatalf("the newest stash should come first, got %+v", stashes)
+	}
+	if mustResolve(t, "stash@{1}") != first {
+		t.Fatalf("stash@{1} should resolve to the first stash")
+	}
+
+	changes, err := StashShow("stash@{1}")
+	if err != nil || len(changes) != 1 || changes[0] != (FileChange{Status: STATUS_ADD, Name: "c.txt"}) {
+		t.Fatalf("the first stash should only add c.txt, got %v (%v)", changes, err)
+	}
+
+	// Committing a change elsewhere in a.txt still lets the stash apply
+	writeTestFile(t, "a.txt", "ONE\ntwo\nthree\n")
+	commitTestFiles(t, "third", "a.txt")
+
+	if _, err = StashPop(""); err != nil {
+		t.Fatalf("could not pop stash: %s", err)
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "ONE\ntwo\nTHREE\n" {
+		t.Fatalf("popping should merge a.txt, got %q", content)
+	}
+
+	if _, err = StashPop(""); err != nil {
+		t.Fatalf("could not pop stash: %s", err)
+	}
+	if content, _ := os.ReadFile("c.txt"); string(content) != "new" {
+		t.Fatalf("popping should bring c.txt back, got %q", content)
+	}
+	if index, _ = GetIndex(); index.Length() != 1 || index.Entries()[0].Status != STATUS_ADD {
+		t.Fatalf("popping should stage the added c.txt, got %v", index.Entries())
+	}
+
+	if _, err = StashDrop(""); err == nil {
+		t.Fatalf("dropping with no stashes should fail")
+	}
+	if _, err = ResolveRevision("stash"); err == nil {
+		t.Fatalf("refs/stash should be gone once the last stash is dropped")
+	}
+
+	// A conflicting change keeps the stash
+	writeTestFile(t, "b.txt", "stashed")
+	if _, err = StashPush("", []string{"b.txt"}); err != nil {
+		t.Fatalf("could not stash b.txt: %s", err)
+	}
+	writeTestFile(t, "b.txt", "committed")
+	commitTestFiles(t, "fourth", "b.txt")
+
+	_, err = StashPop("")
+	var conflict *MergeConflictError
+	if !errors.As(err, &conflict) || len(conflict.Paths) != 1 || conflict.Paths[0] != "b.txt" {
+		t.Fatalf("popping should conflict in b.txt, got %v", err)
+	}
+	if content, _ := os.ReadFile("b.txt"); !strings.Contains(string(content), "<<<<<<< Updated upstream\ncommitted\n=======\nstashed\n>>>>>>> Stashed changes\n") {
+		t.Fatalf("b.txt should hold conflict markers, got %q", content)
+	}
+	if stashes, _ = StashList(); len(stashes) != 1 {
+		t.Fatalf("a conflicting pop should keep the stash, got %d stashes", len(stashes))
+	}
+}
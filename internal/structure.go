@@ -4,8 +4,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
+// cleanPath normalises a path given on the command line to the slash
+// separated form used in the index and in trees.
+func cleanPath(p filePath) filePath {
+	return filepath.ToSlash(filepath.Clean(p))
+}
+
 const (
 	Repo             filePath = ".got"
 	IndexFile        filePath = "index"
@@ -13,70 +20,93 @@ const (
 	RefHeadsDir      filePath = "heads"
 	RefHeadsMainFile filePath = "main"
 	ObjectsDir       filePath = "objects"
+	PackDir          filePath = "pack"
 	HeadFile         filePath = "HEAD"
 	ConfigFile       filePath = "config"
+	IgnoreFile       filePath = ".gotignore"
 )
 
-func getRepoPath() (filePath, error) {
-	wd, err := os.Getwd()
+// repository locates the files of one repository. The zero value is the
+// repository in the working directory, which is what the rest of the
+// package works on. The transports serve a repository somewhere else by
+// naming its directory, since changing into it would move every goroutine
+// in the process along with them.
+type repository struct {
+	// dir is the repository's own directory, such as "/src/project/.got",
+	// or empty for the one in the working directory.
+	dir filePath
+	// bare is set for a repository with no working tree, where no branch
+	// is checked out and so a push may move any of them
+	bare bool
+
+	// pushes lets one push at a time check and move the refs
+	pushes sync.Mutex
+}
+
+// workingRepo is the repository in the working directory.
+var workingRepo = &repository{}
+
+// openRepository returns the repository in the working tree at dir, or
+// the bare repository that dir is.
+func openRepository(dir filePath) (*repository, error) {
+	abs, err := filepath.Abs(dir)
 	if err != nil {
-		return "", fmt.Errorf("could not get working directory: %w", err)
+		return nil, err
+	}
+
+	if _, err = os.Stat(filepath.Join(abs, Repo)); err == nil {
+		return &repository{dir: filepath.Join(abs, Repo)}, nil
 	}
-	return filepath.Join(wd, Repo), nil
+
+	if _, err = os.Stat(filepath.Join(abs, HeadFile)); err == nil {
+		return &repository{dir: abs, bare: true}, nil
+	}
+
+	return nil, fmt.Errorf("%s does not appear to be a got repository", dir)
 }
 
-func getIndexPath() (filePath, error) {
-	workingDir, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("could not get working directory for index: %w", err)
+// path joins parts onto the repository's directory.
+func (r *repository) path(parts ...filePath) (filePath, error) {
+	dir := r.dir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("could not get working directory: %w", err)
+		}
+		dir = filepath.Join(wd, Repo)
 	}
-	return filepath.Join(workingDir, Repo, IndexFile), nil
+
+	return filepath.Join(append([]filePath{dir}, parts...)...), nil
+}
+
+func getRepoPath() (filePath, error) {
+	return workingRepo.path()
+}
+
+func getIndexPath() (filePath, error) {
+	return workingRepo.path(IndexFile)
 }
 
 func getHeadPath() (filePath, error) {
-	workingDir, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("could not get working directory for head: %w", err)
-	}
-	return filepath.Join(workingDir, Repo, HeadFile), nil
+	return workingRepo.path(HeadFile)
 }
 
 func getConfigPath() (filePath, error) {
-	workingDir, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("could not get working directory for config: %w", err)
-	}
-	return filepath.Join(workingDir, Repo, ConfigFile), nil
+	return workingRepo.path(ConfigFile)
 }
 
 func getRefsDirPath() (filePath, error) {
-	workingDir, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("could not get working directory for refs dir: %w", err)
-	}
-	return filepath.Join(workingDir, Repo, RefsDir), nil
+	return workingRepo.path(RefsDir)
 }
 
 func getRefHeadsDirPath() (filePath, error) {
-	workingDir, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("could not get working directory for heads dir: %w", err)
-	}
-	return filepath.Join(workingDir, Repo, RefsDir, RefHeadsDir), nil
+	return workingRepo.path(RefsDir, RefHeadsDir)
 }
 
 func getRefHeadsMainFilePath() (filePath, error) {
-	workingDir, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("could not get working directory for refs head main: %w", err)
-	}
-	return filepath.Join(workingDir, Repo, RefsDir, RefHeadsDir, RefHeadsMainFile), nil
+	return workingRepo.path(RefsDir, RefHeadsDir, RefHeadsMainFile)
 }
 
 func getObjectsDirPath() (filePath, error) {
-	workingDir, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("could not get working directory for objects dir: %w", err)
-	}
-	return filepath.Join(workingDir, Repo, ObjectsDir), nil
+	return workingRepo.path(ObjectsDir)
 }
@@ -0,0 +1,351 @@
+package got
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// A transport carries the fetch and push protocol to a remote repository.
+// The remote side of each call is served by advertiseRefs, uploadPack and
+// receivePack running in the remote repository.
+type transport interface {
+	// listRefs returns the remote's branches and the branch its HEAD is on.
+	listRefs() (*remoteRefs, error)
+	// fetchPack returns a pack of the objects reachable from wants that
+	// are not reachable from haves.
+	fetchPack(wants, haves []id) ([]byte, error)
+	// pushPack stores the pack in the remote and then applies the updates
+	// to its refs.
+	pushPack(pack []byte, updates []refUpdate) error
+	close() error
+}
+
+// remoteRefs is what a repository advertises to those fetching from it.
+type remoteRefs struct {
+	Head filePath
+	Refs map[filePath]id
+}
+
+// refUpdate asks a remote to move Ref from Old to New. Old and New are
+// empty for a ref that does not exist, and a forced update may move a
+// branch to a commit that does not descend from where it was.
+type refUpdate struct {
+	Ref   filePath
+	Old   id
+	New   id
+	Force bool
+}
+
+// ErrNonFastForward is returned when a push would move a branch to a commit
+// that does not descend from where it is.
+var ErrNonFastForward = errors.New("rejected a non-fast-forward update; fetch and rebase first, or force it")
+
+// ErrCurrentBranch is returned when a push would move the branch checked
+// out in the remote, which would leave its index and working directory
+// out of step with it.
+var ErrCurrentBranch = errors.New("refusing to update the branch checked out in the remote; check out another branch there first, or push to a bare repository")
+
+// openTransport picks the transport for a remote's url. Anything that is
+// not a recognised url is the path of a repository on disk.
+func openTransport(url string) (transport, error) {
+	if command, ok := strings.CutPrefix(url, pipeURLPrefix); ok {
+		return openPipeTransport(command)
+	}
+
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return newHTTPTransport(url), nil
+	}
+
+	return openLocalTransport(url)
+}
+
+// isPathURL reports whether url is the path of a repository on disk.
+func isPathURL(url string) bool {
+	return !strings.HasPrefix(url, pipeURLPrefix) && !strings.Contains(url, "://")
+}
+
+// localTransport talks to a repository elsewhere on disk.
+type localTransport struct {
+	repo *repository
+}
+
+func openLocalTransport(dir filePath) (*localTransport, error) {
+	repo, err := openRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localTransport{repo: repo}, nil
+}
+
+func (l *localTransport) listRefs() (*remoteRefs, error) {
+	return l.repo.advertiseRefs()
+}
+
+func (l *localTransport) fetchPack(wants, haves []id) ([]byte, error) {
+	return l.repo.uploadPack(wants, haves)
+}
+
+func (l *localTransport) pushPack(pack []byte, updates []refUpdate) error {
+	return l.repo.receivePack(pack, updates)
+}
+
+func (l *localTransport) close() error {
+	return nil
+}
+
+// withRepo runs fn from inside the repository at dir, moving into dir and
+// back again afterwards.
+func withRepo(dir filePath, fn func() error) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("could not get working directory: %w", err)
+	}
+
+	if err = os.Chdir(dir); err != nil {
+		return fmt.Errorf("could not enter repository %s: %w", dir, err)
+	}
+
+	err = fn()
+
+	if cdErr := os.Chdir(wd); cdErr != nil && err == nil {
+		err = fmt.Errorf("could not return to %s: %w", wd, cdErr)
+	}
+
+	return err
+}
+
+// advertiseRefs lists the branches of this repository and the one HEAD is
+// on.
+func (r *repository) advertiseRefs() (*remoteRefs, error) {
+	headRef, _, err := r.readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := r.listRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	advertised := &remoteRefs{Head: headRef, Refs: map[filePath]id{}}
+	for ref, refId := range refs {
+		if strings.HasPrefix(ref, RefsDir+"/"+RefHeadsDir+"/") {
+			advertised.Refs[ref] = refId
+		}
+	}
+
+	return advertised, nil
+}
+
+// uploadPack packs the objects reachable from wants that are not reachable
+// from whichever of haves this repository also has.
+func (r *repository) uploadPack(wants, haves []id) ([]byte, error) {
+	for _, want := range wants {
+		if ok, err := r.objectExists(want); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, fmt.Errorf("no such object %s", want)
+		}
+	}
+
+	return r.packObjects(wants, haves)
+}
+
+// receivePack stores a pushed pack and applies the ref updates that come
+// with it. Every update is checked before any ref moves: the ref must be a
+// branch other than the one checked out here, if the repository is not
+// bare, and still be where the pusher saw it, and unless forced a branch
+// may only move forward to a descendant.
+func receivePack(pack []byte, updates []refUpdate) error {
+	return workingRepo.receivePack(pack, updates)
+}
+
+func (r *repository) receivePack(pack []byte, updates []refUpdate) error {
+	if err := r.storeReceivedPack(pack); err != nil {
+		return err
+	}
+
+	r.pushes.Lock()
+	defer r.pushes.Unlock()
+
+	headRef, _, err := r.readHead()
+	if err != nil {
+		return err
+	}
+
+	for _, update := range updates {
+		if !isBranchRef(update.Ref) {
+			return fmt.Errorf("refusing to update %q, which is not a branch", update.Ref)
+		}
+
+		if !r.bare && update.Ref == headRef {
+			return fmt.Errorf("%w: %s", ErrCurrentBranch, update.Ref)
+		}
+
+		if update.New == "" {
+			return fmt.Errorf("refusing to delete %s", update.Ref)
+		}
+
+		if ok, err := r.objectExists(update.New); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("the pack is missing %s for %s", update.New, update.Ref)
+		}
+
+		if update.Force {
+			continue
+		}
+
+		current, err := r.readRef(update.Ref)
+		if err != nil {
+			return err
+		}
+
+		if current != update.Old {
+			return fmt.Errorf("%s has moved since it was listed; fetch and try again", update.Ref)
+		}
+
+		if current == "" {
+			continue
+		}
+
+		if ok, err := r.isAncestor(current, update.New); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("%w: %s", ErrNonFastForward, update.Ref)
+		}
+	}
+
+	for _, update := range updates {
+		if err := r.updateRef(update.Ref, update.New, "push"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// packObjects encodes a pack of the objects reachable from wants and not
+// from the haves that exist here. Haves are ref tips, which always have
+// their whole history.
+func packObjects(wants, haves []id) ([]byte, error) {
+	return workingRepo.packObjects(wants, haves)
+}
+
+func (r *repository) packObjects(wants, haves []id) ([]byte, error) {
+	have := []id{}
+	for _, h := range haves {
+		if ok, err := r.objectExists(h); err != nil {
+			return nil, err
+		} else if ok {
+			have = append(have, h)
+		}
+	}
+
+	excluded, err := r.reachableObjects(have)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted, err := r.reachableObjects(wants)
+	if err != nil {
+		return nil, err
+	}
+
+	for objId := range excluded {
+		delete(wanted, objId)
+	}
+
+	ids := make([]id, 0, len(wanted))
+	for objId := range wanted {
+		ids = append(ids, objId)
+	}
+	slices.Sort(ids)
+
+	names, err := r.objectNames(wanted)
+	if err != nil {
+		return nil, err
+	}
+
+	pack, err := r.encodePack(ids, names)
+	if err != nil {
+		return nil, err
+	}
+
+	return pack.data, nil
+}
+
+// storeReceivedPack checks and indexes a pack from another repository and
+// adds it to this one's packs. An empty pack is not kept.
+func storeReceivedPack(pack []byte) error {
+	return workingRepo.storeReceivedPack(pack)
+}
+
+func (r *repository) storeReceivedPack(pack []byte) error {
+	offsets, err := r.indexPack(pack)
+	if err != nil {
+		return fmt.Errorf("could not index received pack: %w", err)
+	}
+
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	_, err = r.storePack(pack, offsets)
+	return err
+}
+
+// objectExists reports whether the object is stored here, loose or packed.
+func objectExists(objId id) (bool, error) {
+	return workingRepo.objectExists(objId)
+}
+
+func (r *repository) objectExists(objId id) (bool, error) {
+	if len(objId) != 40 || !isHex(objId) {
+		return false, nil
+	}
+
+	ids, err := r.findObjectIds(objId)
+	if err != nil {
+		return false, err
+	}
+
+	return len(ids) > 0, nil
+}
+
+// isAncestor reports whether ancestor is descendant or one of the commits
+// it descends from.
+func isAncestor(ancestor, descendant id) (bool, error) {
+	return workingRepo.isAncestor(ancestor, descendant)
+}
+
+func (r *repository) isAncestor(ancestor, descendant id) (bool, error) {
+	seen := map[id]bool{}
+
+	pending := []id{descendant}
+	for len(pending) > 0 {
+		commitId := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if commitId == ancestor {
+			return true, nil
+		}
+
+		if seen[commitId] {
+			continue
+		}
+		seen[commitId] = true
+
+		commit, err := r.readCommit(commitId)
+		if err != nil {
+			return false, err
+		}
+		pending = append(pending, commit.Parents...)
+	}
+
+	return false, nil
+}
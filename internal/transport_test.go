@@ -0,0 +1,143 @@
+package got
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildTestGot builds the got command into a temporary directory, skipping
+// the test when there is no go command to build it with.
+func buildTestGot(t *testing.T, module string) string {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("building got is slow")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command to build got with")
+	}
+
+	bin := filepath.Join(t.TempDir(), "got")
+	build := exec.Command("go", "build", "-o", bin, "./cmd")
+	build.Dir = module
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("could not build got: %s\n%s", err, out)
+	}
+
+	return bin
+}
+
+func TestTransports(t *testing.T) {
+	module, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatalf("could not find the module: %s", err)
+	}
+
+	cases := []struct {
+		name string
+		url  func(t *testing.T, server string) string
+	}{
+		{"local", func(t *testing.T, server string) string {
+			return server
+		}},
+		{"http", func(t *testing.T, server string) string {
+			handler, err := NewServer(server)
+			if err != nil {
+				t.Fatalf("could not create server: %s", err)
+			}
+
+			ts := httptest.NewServer(handler)
+			t.Cleanup(ts.Close)
+			return ts.URL
+		}},
+		{"ext", func(t *testing.T, server string) string {
+			return fmt.Sprintf("%sGOT_TEST_PIPE_REPO='%s' '%s' -test.run='^TestPipeHelper$'", pipeURLPrefix, server, os.Args[0])
+		}},
+		{"ext running got upload-pack", func(t *testing.T, server string) string {
+			return fmt.Sprintf("%s'%s' upload-pack '%s'", pipeURLPrefix, buildTestGot(t, module), server)
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := initTestRepo(t)
+
+			writeTestFile(t, "a.txt", "a\n")
+			commitTestFiles(t, "first", "a.txt")
+			first := mustResolve(t, HeadFile)
+
+			url := c.url(t, server)
+
+			clone := filepath.Join(t.TempDir(), "clone")
+			if err := Clone(url, clone); err != nil {
+				t.Fatalf("could not clone: %s", err)
+			}
+
+			inTestRepo(t, clone, func() {
+				if mustResolve(t, "origin/main") != first {
+					t.Fatalf("the clone should track main at %s", first)
+				}
+				if content, _ := os.ReadFile("a.txt"); string(content) != "a\n" {
+					t.Fatalf("the clone should check out a.txt, got %q", content)
+				}
+				if remotes, _ := ListRemotes(); len(remotes) != 1 || remotes[0].URL != url {
+					t.Fatalf("origin should be %s, got %+v", url, remotes)
+				}
+
+				writeTestFile(t, "b.txt", "b\n")
+				commitTestFiles(t, "second", "b.txt")
+				inTestRepo(t, server, func() { detachTestHead(t) })
+
+				if _, err := Push("origin", "main", false); err != nil {
+					t.Fatalf("could not push: %s", err)
+				}
+			})
+
+			second := mustResolve(t, "main")
+			if second == first {
+				t.Fatalf("the push should move the server's main")
+			}
+
+			checkoutTestBranch(t, "main")
+			writeTestFile(t, "c.txt", "c\n")
+			commitTestFiles(t, "third", "c.txt")
+			detachTestHead(t)
+
+			inTestRepo(t, clone, func() {
+				changes, err := Fetch("origin")
+				if err != nil {
+					t.Fatalf("could not fetch: %s", err)
+				}
+				if len(changes) != 1 || changes[0].Old != second {
+					t.Fatalf("fetch should move origin/main on from %s, got %+v", second, changes)
+				}
+				if content, _ := readBlob(mustResolve(t, "origin/main:c.txt")); string(content) != "c\n" {
+					t.Fatalf("fetch should copy the new objects, got %q", content)
+				}
+
+				// Ask the server directly, so that its own fast-forward
+				// check is what refuses the update
+				transport, err := openTransport(url)
+				if err != nil {
+					t.Fatalf("could not open transport: %s", err)
+				}
+				defer transport.close()
+
+				update := refUpdate{Ref: branchRef("main"), Old: mustResolve(t, "origin/main"), New: first}
+				err = transport.pushPack(mustPack(t), []refUpdate{update})
+				if err == nil || !strings.Contains(err.Error(), ErrNonFastForward.Error()) {
+					t.Fatalf("the server should refuse to move main backwards, got %v", err)
+				}
+
+				if _, err = transport.listRefs(); err != nil {
+					t.Errorf("the session should carry on after a refusal: %s", err)
+				}
+			})
+		})
+	}
+}
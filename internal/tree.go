@@ -0,0 +1,243 @@
+package got
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// The modes a tree entry can have. A symlink is stored as a blob holding
+// the path it points to.
+const (
+	MODE_FILE       = "100644"
+	MODE_EXECUTABLE = "100755"
+	MODE_SYMLINK    = "120000"
+	MODE_TREE       = "040000"
+)
+
+// TreeEntry is a single line of a tree object. When returned from ListTree
+// or a flattened tree, Name holds the full slash separated path.
+type TreeEntry struct {
+	Mode string
+	Type objectType
+	Id   id
+	Name filePath
+}
+
+func parseTree(content []byte) ([]TreeEntry, error) {
+	entries := []TreeEntry{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 4)
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("malformed tree entry %q", scanner.Text())
+		}
+
+		entries = append(entries, TreeEntry{
+			Mode: parts[0],
+			Type: parts[1],
+			Id:   parts[2],
+			Name: parts[3],
+		})
+	}
+
+	return entries, scanner.Err()
+}
+
+// sameEntry reports whether two entries for a file have the same content
+// and mode.
+func sameEntry(a, b TreeEntry) bool {
+	return a.Id == b.Id && a.Mode == b.Mode
+}
+
+// ReadTree returns the entries of the tree object with the given id.
+func ReadTree(id id) ([]TreeEntry, error) {
+	t, content, err := ReadObject(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if t != TREE {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", id, t)
+	}
+
+	return parseTree(content)
+}
+
+// flattenTree returns every blob reachable from the tree, keyed by its full
+// path.
+func flattenTree(id id) (map[filePath]TreeEntry, error) {
+	files := map[filePath]TreeEntry{}
+
+	err := walkTree(id, "", func(entry TreeEntry) (bool, error) {
+		if entry.Type != TREE {
+			files[entry.Name] = entry
+		}
+		return true, nil
+	})
+
+	return files, err
+}
+
+// walkTree calls fn for each entry below the tree in depth first order, with
+// the entry's Name set to its full path. Subtrees are only descended into
+// when fn returns true for them.
+func walkTree(id id, prefix filePath, fn func(TreeEntry) (bool, error)) error {
+	entries, err := ReadTree(id)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entry.Name = path.Join(prefix, entry.Name)
+
+		descend, err := fn(entry)
+		if err != nil {
+			return err
+		}
+
+		if entry.Type == TREE && descend {
+			if err = walkTree(entry.Id, entry.Name, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// buildTree writes the tree objects needed to hold files, keyed by full
+// path, and returns the id of the root tree.
+func buildTree(files map[filePath]TreeEntry) (id, error) {
+	blobs := map[string]TreeEntry{}
+	subtrees := map[string]map[filePath]TreeEntry{}
+
+	for name, entry := range files {
+		dir, rest, nested := strings.Cut(name, "/")
+		if !nested {
+			entry.Name = name
+			blobs[name] = entry
+			continue
+		}
+
+		if subtrees[dir] == nil {
+			subtrees[dir] = map[filePath]TreeEntry{}
+		}
+		subtrees[dir][rest] = entry
+	}
+
+	entries := make([]TreeEntry, 0, len(blobs)+len(subtrees))
+	for _, entry := range blobs {
+		entries = append(entries, entry)
+	}
+
+	for dir, subFiles := range subtrees {
+		subtreeId, err := buildTree(subFiles)
+		if err != nil {
+			return "", err
+		}
+
+		entries = append(entries, TreeEntry{Mode: MODE_TREE, Type: TREE, Id: subtreeId, Name: dir})
+	}
+
+	slices.SortFunc(entries, func(a, b TreeEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	var content string
+	for _, entry := range entries {
+		content += fmt.Sprintf("%v %v %v %v\n", entry.Mode, entry.Type, entry.Id, entry.Name)
+	}
+
+	treeId, treeString, err := formatHexId(content, TREE)
+	if err != nil {
+		return "", err
+	}
+
+	if err = writeObjectData(treeId, treeString); err != nil {
+		return "", err
+	}
+
+	return treeId, nil
+}
+
+// peelToTree returns the tree id for a tree-ish: a tree, or a commit whose
+// tree is used.
+func peelToTree(id id) (id, error) {
+	t, _, err := ReadObject(id)
+	if err != nil {
+		return "", err
+	}
+
+	switch t {
+	case TREE:
+		return id, nil
+	case COMMIT:
+		commit, err := readCommit(id)
+		if err != nil {
+			return "", err
+		}
+		return commit.Tree, nil
+	default:
+		return "", fmt.Errorf("object %s is a %s, not a tree-ish", id, t)
+	}
+}
+
+// ListTree lists the contents of the tree-ish named by treeish. When paths
+// are given only matching entries are listed. Subtrees are expanded when
+// recursive is set or when a path names something inside them.
+func ListTree(treeish string, recursive bool, paths []filePath) ([]TreeEntry, error) {
+	objId, err := ResolveRevision(treeish)
+	if err != nil {
+		return nil, err
+	}
+
+	treeId, err := peelToTree(objId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, p := range paths {
+		paths[i] = cleanPath(p)
+	}
+
+	matches := func(name filePath) bool {
+		if len(paths) == 0 {
+			return true
+		}
+		for _, p := range paths {
+			if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	leadsToMatch := func(name filePath) bool {
+		for _, p := range paths {
+			if strings.HasPrefix(p, name+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	listed := []TreeEntry{}
+	err = walkTree(treeId, "", func(entry TreeEntry) (bool, error) {
+		if entry.Type == TREE && (recursive && matches(entry.Name) || leadsToMatch(entry.Name)) {
+			return true, nil
+		}
+
+		if matches(entry.Name) {
+			listed = append(listed, entry)
+		}
+
+		return false, nil
+	})
+
+	return listed, err
+}
@@ -0,0 +1,213 @@
+package got
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		t.Fatalf("could not create directory for %s: %s", name, err)
+	}
+
+	if err := os.WriteFile(name, []byte(content), 0666); err != nil {
+		t.Fatalf("could not write %s: %s", name, err)
+	}
+}
+
+// stageTestFiles stages the given paths.
+func stageTestFiles(t *testing.T, paths ...string) Index {
+	t.Helper()
+
+	index, err := GetIndex()
+	if err != nil {
+		t.Fatalf("could not get index: %s", err)
+	}
+
+	for _, p := range paths {
+		if err = index.UpdateOrAddEntry(p); err != nil {
+			t.Fatalf("could not add %s: %s", p, err)
+		}
+	}
+
+	if err = index.Save(); err != nil {
+		t.Fatalf("could not save index: %s", err)
+	}
+
+	return index
+}
+
+// commitTestFiles stages the given paths and commits them.
+func commitTestFiles(t *testing.T, msg string, paths ...string) {
+	t.Helper()
+
+	index := stageTestFiles(t, paths...)
+
+	if err := index.Commit(msg, CommitOptions{}); err != nil {
+		t.Fatalf("could not commit: %s", err)
+	}
+}
+
+func TestCommitKeepsEarlierFiles(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a")
+	writeTestFile(t, "src/sub/b.txt", "b")
+	commitTestFiles(t, "first", ".")
+
+	writeTestFile(t, "a.txt", "changed")
+	commitTestFiles(t, "second", "a.txt")
+
+	entries, err := ListTree(HeadFile, true, nil)
+	if err != nil {
+		t.Fatalf("could not list tree: %s", err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+
+	if want := []string{"a.txt", "src/sub/b.txt"}; !slices.Equal(names, want) {
+		t.Fatalf("tree should contain %v but contains %v", want, names)
+	}
+
+	top, err := ListTree(HeadFile, false, nil)
+	if err != nil {
+		t.Fatalf("could not list tree: %s", err)
+	}
+
+	if len(top) != 2 || top[1].Type != TREE || top[1].Name != "src" {
+		t.Fatalf("top level of tree should hold a.txt and src, got %v", top)
+	}
+
+	sub, err := ListTree(HeadFile, false, []string{"src/sub"})
+	if err != nil {
+		t.Fatalf("could not list tree: %s", err)
+	}
+
+	if len(sub) != 1 || sub[0].Name != "src/sub" || sub[0].Type != TREE {
+		t.Fatalf("listing src/sub should give the subtree itself, got %v", sub)
+	}
+}
+
+func TestUntrackedFiles(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, ".gotignore", "build/\n*.log\n")
+	writeTestFile(t, "tracked.txt", "t")
+	writeTestFile(t, "new.txt", "n")
+	writeTestFile(t, "debug.log", "l")
+	writeTestFile(t, "build/out", "o")
+	commitTestFiles(t, "first", ".gotignore", "tracked.txt")
+
+	index, err := GetIndex()
+	if err != nil {
+		t.Fatalf("could not get index: %s", err)
+	}
+
+	others, err := index.UntrackedFiles(false)
+	if err != nil {
+		t.Fatalf("could not list untracked files: %s", err)
+	}
+
+	if want := []string{"new.txt"}; !slices.Equal(others, want) {
+		t.Fatalf("untracked files should be %v but are %v", want, others)
+	}
+
+	ignored, err := index.UntrackedFiles(true)
+	if err != nil {
+		t.Fatalf("could not list ignored files: %s", err)
+	}
+
+	if want := []string{"build/", "debug.log"}; !slices.Equal(ignored, want) {
+		t.Fatalf("ignored files should be %v but are %v", want, ignored)
+	}
+}
+
+func TestFileModes(t *testing.T) {
+	initTestRepo(t)
+
+	writeTestFile(t, "a.txt", "a")
+	writeTestFile(t, "bin/run.sh", "#!/bin/sh\n")
+	if err := os.Chmod("bin/run.sh", 0755); err != nil {
+		t.Fatalf("could not make run.sh executable: %s", err)
+	}
+	if err := os.Symlink("a.txt", "link"); err != nil {
+		t.Fatalf("could not create symlink: %s", err)
+	}
+	commitTestFiles(t, "first", ".")
+
+	first := mustResolve(t, HeadFile)
+
+	entries, err := ListTree(HeadFile, false, nil)
+	if err != nil {
+		t.Fatalf("could not list tree: %s", err)
+	}
+
+	modes := map[string]string{}
+	for _, entry := range entries {
+		modes[entry.Name] = entry.Mode
+	}
+
+	want := map[string]string{"a.txt": MODE_FILE, "bin": MODE_TREE, "link": MODE_SYMLINK}
+	for name, mode := range want {
+		if modes[name] != mode {
+			t.Fatalf("%s should have mode %s but has %s", name, mode, modes[name])
+		}
+	}
+
+	script, err := ListTree(HeadFile, false, []string{"bin/run.sh"})
+	if err != nil || len(script) != 1 || script[0].Mode != MODE_EXECUTABLE {
+		t.Fatalf("bin/run.sh should have mode %s, got %v (%v)", MODE_EXECUTABLE, script, err)
+	}
+
+	if content, _ := readBlob(mustResolve(t, "HEAD:link")); string(content) != "a.txt" {
+		t.Fatalf("the symlink blob should hold its target but holds %q", content)
+	}
+
+	// A change of mode alone is a change to stage
+	if err = os.Chmod("a.txt", 0755); err != nil {
+		t.Fatalf("could not make a.txt executable: %s", err)
+	}
+
+	index := stageTestFiles(t, "a.txt")
+	if len(index.Entries()) != 1 || index.Entries()[0].Status != STATUS_MODIFY {
+		t.Fatalf("making a.txt executable should stage a modification, got %v", index.Entries())
+	}
+
+	if err = index.Commit("second", CommitOptions{}); err != nil {
+		t.Fatalf("could not commit: %s", err)
+	}
+
+	if _, err = index.RemoveFile("link", false, false, false); err != nil {
+		t.Fatalf("could not remove link: %s", err)
+	}
+	if err = index.Save(); err != nil {
+		t.Fatalf("could not save index: %s", err)
+	}
+	if err = os.Chmod("bin/run.sh", 0644); err != nil {
+		t.Fatalf("could not change run.sh: %s", err)
+	}
+	commitTestFiles(t, "third", "bin/run.sh")
+
+	if err = Checkout(first, "", false); err != nil {
+		t.Fatalf("could not checkout first commit: %s", err)
+	}
+
+	if info, err := os.Stat("bin/run.sh"); err != nil || info.Mode().Perm() != 0755 {
+		t.Fatalf("bin/run.sh should be executable again, got %v (%v)", info, err)
+	}
+
+	if info, err := os.Stat("a.txt"); err != nil || info.Mode().Perm() != 0644 {
+		t.Fatalf("a.txt should no longer be executable, got %v (%v)", info, err)
+	}
+
+	if target, err := os.Readlink("link"); err != nil || target != "a.txt" {
+		t.Fatalf("link should be a symlink to a.txt, got %q (%v)", target, err)
+	}
+}
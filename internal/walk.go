@@ -0,0 +1,114 @@
+package got
+
+import (
+	"fmt"
+	"strings"
+)
+
+// objectLink is a reference from one object to another, along with the
+// type the referring object expects it to have and, from a tree, the name
+// it is given.
+type objectLink struct {
+	Id   id
+	Type objectType
+	Name filePath
+}
+
+// objectLinks returns the objects referenced by an object's content: the
+// tree and parents of a commit, or the entries of a tree.
+func objectLinks(t objectType, content []byte) ([]objectLink, error) {
+	links := []objectLink{}
+
+	switch t {
+	case COMMIT:
+		headers, _, _ := strings.Cut(string(content), "\n\n")
+		for _, line := range strings.Split(headers, "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "tree":
+				links = append(links, objectLink{Id: value, Type: TREE})
+			case "parent":
+				links = append(links, objectLink{Id: value, Type: COMMIT})
+			}
+		}
+	case TREE:
+		entries, err := parseTree(content)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			links = append(links, objectLink{Id: entry.Id, Type: entry.Type, Name: entry.Name})
+		}
+	}
+
+	return links, nil
+}
+
+// reachableObjects returns every object reachable from roots, with its
+// type. Roots that cannot be read are an error.
+func reachableObjects(roots []id) (map[id]objectType, error) {
+	return workingRepo.reachableObjects(roots)
+}
+
+func (r *repository) reachableObjects(roots []id) (map[id]objectType, error) {
+	seen := map[id]objectType{}
+	pending := append([]id{}, roots...)
+
+	for len(pending) > 0 {
+		objId := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if _, ok := seen[objId]; ok || objId == "" {
+			continue
+		}
+
+		t, content, err := r.readObject(objId)
+		if err != nil {
+			return nil, fmt.Errorf("could not read object %s: %w", objId, err)
+		}
+		seen[objId] = t
+
+		links, err := objectLinks(t, content)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s %s: %w", t, objId, err)
+		}
+
+		for _, link := range links {
+			pending = append(pending, link.Id)
+		}
+	}
+
+	return seen, nil
+}
+
+// objectNames returns the name each reachable blob and subtree is given in
+// some tree, which is a good hint for which objects will delta well.
+func objectNames(reachable map[id]objectType) (map[id]string, error) {
+	return workingRepo.objectNames(reachable)
+}
+
+func (r *repository) objectNames(reachable map[id]objectType) (map[id]string, error) {
+	names := map[id]string{}
+
+	for objId, t := range reachable {
+		if t != TREE {
+			continue
+		}
+
+		_, content, err := r.readObject(objId)
+		if err != nil {
+			return nil, err
+		}
+
+		links, err := objectLinks(t, content)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, link := range links {
+			names[link.Id] = link.Name
+		}
+	}
+
+	return names, nil
+}